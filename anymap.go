@@ -0,0 +1,49 @@
+package persist
+
+// AnyMap is a dynamically-typed map for callers that do not know the types of
+// their keys and values at compile time, e.g. plugin systems. It is a thin
+// facade over a Map[any, any] whose encoders are provided at runtime.
+//
+// The encoders decide which concrete types come back out of the map: for
+// example, [CBOREncoder] decodes into generic types such as
+// map[interface{}]interface{}, uint64 and string rather than the types that
+// were stored.
+type AnyMap struct {
+	m Map[any, any]
+}
+
+// NewAnyMap returns a new AnyMap over the given driver using the given
+// encoders.
+func NewAnyMap(driver Driver, encs EncoderPair[any, any]) AnyMap {
+	return AnyMap{NewMapFromEncoders(driver, encs)}
+}
+
+// Map returns the underlying Map.
+func (m AnyMap) Map() Map[any, any] {
+	return m.m
+}
+
+// Store stores a value by key. It behaves like [Map.Store].
+func (m AnyMap) Store(k, v any) error {
+	return m.m.Store(k, v)
+}
+
+// Load loads a value by key. It behaves like [Map.Load].
+func (m AnyMap) Load(k any) (any, bool, error) {
+	return m.m.Load(k)
+}
+
+// Delete deletes a value by key. It behaves like [Map.Delete].
+func (m AnyMap) Delete(k any) error {
+	return m.m.Delete(k)
+}
+
+// All returns an iterator over all key-value pairs in the map.
+func (m AnyMap) All() Seq2[any, any] {
+	return m.m.All()
+}
+
+// Close closes the map.
+func (m AnyMap) Close() error {
+	return m.m.Close()
+}
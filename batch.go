@@ -0,0 +1,122 @@
+package persist
+
+// Batch is a set of reads and writes made within a single read-write
+// transaction. Writes are buffered until the batch commits, and reads see the
+// buffered writes, so a Batch always reads its own writes regardless of the
+// driver. A Batch is only valid within the function given to [Map.Batch].
+type Batch[K, V any] struct {
+	m      Map[K, V]
+	tx     DriverReadWriteTx
+	writes map[string]batchWrite
+}
+
+type batchWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// Batch calls f with a Batch over a single read-write transaction. If f
+// returns nil, then all writes made through the Batch are committed
+// atomically. Otherwise, nothing is written and the error returned by f is
+// returned as-is. Note that f may be called more than once if the driver
+// retries the transaction.
+func (m Map[K, V]) Batch(f func(b Batch[K, V]) error) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	var ferr error
+	err := m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		b := Batch[K, V]{m: m, tx: tx, writes: make(map[string]batchWrite)}
+		if ferr = f(b); ferr != nil {
+			return ferr
+		}
+		return b.commit()
+	})
+	if err != nil && err != ferr {
+		return txError(err)
+	}
+	return err
+}
+
+// Load gets a value by key, taking the writes made so far into account. It
+// behaves like [Map.Load].
+func (b Batch[K, V]) Load(k K) (V, bool, error) {
+	var v V
+
+	bk, err := b.m.kencoder.Encode(k, nil)
+	if err != nil {
+		return v, false, &EncodeError{"encode key", err}
+	}
+
+	var bv []byte
+	var ok bool
+
+	if w, buffered := b.writes[string(bk)]; buffered {
+		bv, ok = w.value, !w.deleted
+	} else {
+		bv, ok, err = b.tx.Get(bk)
+		if err != nil {
+			return v, false, &DriverError{"get value", err}
+		}
+	}
+	if !ok {
+		return v, false, nil
+	}
+
+	v, err = b.m.valueEncoder(bk).Decode(bv)
+	if err != nil {
+		return v, false, &EncodeError{"decode value", err}
+	}
+	return v, true, nil
+}
+
+// Store buffers setting a key-value pair.
+func (b Batch[K, V]) Store(k K, v V) error {
+	bk, err := b.m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := b.m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := b.m.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	b.writes[string(bk)] = batchWrite{value: bv}
+	return nil
+}
+
+// Delete buffers deleting a key.
+func (b Batch[K, V]) Delete(k K) error {
+	bk, err := b.m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	b.writes[string(bk)] = batchWrite{deleted: true}
+	return nil
+}
+
+// commit applies all buffered writes to the transaction.
+func (b Batch[K, V]) commit() error {
+	for k, w := range b.writes {
+		if err := b.m.dropMeta(b.tx, []byte(k)); err != nil {
+			return err
+		}
+		if w.deleted {
+			if err := b.tx.Delete([]byte(k)); err != nil {
+				return &DriverError{"delete value", err}
+			}
+			continue
+		}
+		if err := b.tx.Set([]byte(k), w.value); err != nil {
+			return &DriverError{"set value", err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package persist
+
+import (
+	"sort"
+	"time"
+)
+
+// BucketedMap is a map of time-series values grouped into fixed-size time
+// buckets. Each bucket is stored under the Unix time of its start in
+// nanoseconds.
+type BucketedMap[V any] struct {
+	m      Map[int64, V]
+	bucket int64
+}
+
+// NewBucketedMap returns a new BucketedMap over m with buckets of the given
+// size. It panics if bucket is not positive.
+func NewBucketedMap[V any](m Map[int64, V], bucket time.Duration) BucketedMap[V] {
+	if bucket <= 0 {
+		panic("persist: non-positive bucket size for NewBucketedMap")
+	}
+	return BucketedMap[V]{m, int64(bucket)}
+}
+
+// Map returns the underlying map.
+func (m BucketedMap[V]) Map() Map[int64, V] {
+	return m.m
+}
+
+// Bucket returns the start of the bucket that t falls in.
+func (m BucketedMap[V]) Bucket(t time.Time) time.Time {
+	return time.Unix(0, m.bucketKey(t))
+}
+
+func (m BucketedMap[V]) bucketKey(t time.Time) int64 {
+	ns := t.UnixNano()
+	k := ns - ns%m.bucket
+	if ns < 0 && k != ns {
+		k -= m.bucket
+	}
+	return k
+}
+
+// Record atomically records v into the bucket that t falls in. If the bucket
+// is empty, then v is stored as-is, otherwise combine(old, v) is stored. See
+// [Map.Upsert].
+func (m BucketedMap[V]) Record(t time.Time, v V, combine func(old, new V) V) error {
+	_, err := m.m.Upsert(m.bucketKey(t), v, combine)
+	return err
+}
+
+// Load gets the value of the bucket that t falls in.
+func (m BucketedMap[V]) Load(t time.Time) (V, bool, error) {
+	return m.m.Load(m.bucketKey(t))
+}
+
+// Range returns an iterator over the buckets that overlap the time range
+// [from, to) in chronological order. Each bucket is yielded with its start
+// time. All buckets are read within a single transaction.
+func (m BucketedMap[V]) Range(from, to time.Time) Seq2[time.Time, V] {
+	return func(yield func(time.Time, V) bool) {
+		start, end := m.bucketKey(from), to.UnixNano()
+
+		var buckets []Pair[int64, V]
+		m.m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			return m.m.each(tx, func(k int64, v V) error {
+				if k >= start && k < end {
+					buckets = append(buckets, Pair[int64, V]{k, v})
+				}
+				return nil
+			})
+		})
+
+		sort.Slice(buckets, func(i, j int) bool {
+			return buckets[i].Key < buckets[j].Key
+		})
+
+		for _, b := range buckets {
+			if !yield(time.Unix(0, b.Key), b.Value) {
+				return
+			}
+		}
+	}
+}
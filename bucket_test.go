@@ -0,0 +1,53 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestBucketedMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[int64, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	b := NewBucketedMap(m, time.Minute)
+	sum := func(old, new int) int { return old + new }
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(offset time.Duration, v int) {
+		t.Helper()
+		err := b.Record(base.Add(offset), v, sum)
+		assert.NoError(t, err, "Record")
+	}
+
+	record(0, 1)
+	record(30*time.Second, 2)
+	record(time.Minute, 4)
+	record(3*time.Minute+59*time.Second, 8)
+	record(10*time.Minute, 16)
+
+	type bucket struct {
+		start time.Time
+		v     int
+	}
+	var got []bucket
+	b.Range(base.Add(10*time.Second), base.Add(10*time.Minute))(func(start time.Time, v int) bool {
+		got = append(got, bucket{start.UTC(), v})
+		return true
+	})
+
+	assert.Equal(t, []bucket{
+		{base, 3},
+		{base.Add(time.Minute), 4},
+		{base.Add(3 * time.Minute), 8},
+	}, got, "Range")
+
+	// Times before the Unix epoch must round down as well.
+	before := time.Unix(-90, 0)
+	assert.Equal(t, time.Unix(-120, 0), b.Bucket(before), "Bucket before epoch")
+}
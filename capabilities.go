@@ -0,0 +1,66 @@
+package persist
+
+// DriverCapabilities describes the optional features supported by a driver.
+type DriverCapabilities struct {
+	// Ordered is true if Each and EachKey visit keys in ascending byte order.
+	Ordered bool
+	// TTL is true if the driver supports expiring keys.
+	TTL bool
+	// PrefixScan is true if the driver implements [DriverPrefixDeleter].
+	PrefixScan bool
+	// Backup is true if the driver implements [DriverSaver].
+	Backup bool
+	// Watch is true if the driver implements [DriverWatcher].
+	Watch bool
+	// Versioned is true if the driver's transactions implement
+	// [DriverVersionedTx] and [DriverVersionedRWTx].
+	Versioned bool
+	// Persistent is true if the data outlives the driver, i.e. it is not
+	// stored only in memory.
+	Persistent bool
+}
+
+// DriverWithCapabilities is an optional interface that a Driver may implement
+// to report its capabilities.
+type DriverWithCapabilities interface {
+	Driver
+	Capabilities() DriverCapabilities
+}
+
+// Capabilities returns the capabilities of the given driver. If the driver does
+// not implement [DriverWithCapabilities], then the capabilities are derived
+// from the optional interfaces that it implements, and features that cannot be
+// detected this way are reported as unsupported.
+//
+// The capabilities of a wrapped driver are not reported through
+// [DriverUnwrapper], since the wrapper may change what its transactions
+// implement. Wrappers must implement DriverWithCapabilities to report the
+// capabilities that they preserve.
+func Capabilities(d Driver) DriverCapabilities {
+	if c, ok := d.(DriverWithCapabilities); ok {
+		return c.Capabilities()
+	}
+
+	_, prefixScan := d.(DriverPrefixDeleter)
+	_, backup := d.(DriverSaver)
+	_, watch := d.(DriverWatcher)
+
+	return DriverCapabilities{
+		PrefixScan: prefixScan,
+		Backup:     backup,
+		Watch:      watch,
+	}
+}
+
+// Capabilities returns the capabilities of the map's driver.
+func (m Map[K, V]) Capabilities() DriverCapabilities {
+	return Capabilities(m.driver)
+}
+
+// IsOrdered reports whether the map's driver visits keys in ascending order of
+// their encoded bytes, as reported by [DriverCapabilities.Ordered]. Helpers
+// that need ordered keys can rely on the driver's order if so, and must sort
+// the keys themselves otherwise.
+func (m Map[K, V]) IsOrdered() bool {
+	return m.driver != nil && m.Capabilities().Ordered
+}
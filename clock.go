@@ -0,0 +1,16 @@
+package persist
+
+import "time"
+
+// Clock tells the current time. Features that depend on time take a Clock so
+// that tests can control time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the [Clock] that tells the actual time using [time.Now].
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,47 @@
+package persist
+
+// copyBatchSize is the number of pairs that CopyMap stores per transaction.
+const copyBatchSize = 1000
+
+// CopyMap copies all key-value pairs from src into dst and returns the number
+// of copied pairs. Values are decoded using src's encoders and re-encoded using
+// dst's, so this can be used to migrate between drivers or encoders.
+//
+// The whole source is read within a single read-only transaction, while dst is
+// written to in batches, each in its own transaction. If an error occurs, the
+// batches already written are kept. src and dst must not share the same
+// driver.
+func CopyMap[K, V any](dst, src Map[K, V]) (copied int, err error) {
+	if dst.driver == nil || src.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	batch := make([]Pair[K, V], 0, copyBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.StoreMany(pairsSeq(batch)); err != nil {
+			return err
+		}
+		copied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = src.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		err := src.each(tx, func(k K, v V) error {
+			batch = append(batch, Pair[K, V]{k, v})
+			if len(batch) < copyBatchSize {
+				return nil
+			}
+			return flush()
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+	return copied, err
+}
@@ -0,0 +1,48 @@
+package persist
+
+// Counter is an atomic int64 counter that persists to disk.
+type Counter struct {
+	v Value[int64]
+}
+
+// NewCounter returns a new [Counter] using the default CBOR encoder and a
+// provided driver with sane defaults.
+func NewCounter(driverOpener DriverOpenFunc, path string) (Counter, error) {
+	v, err := NewValue[int64](driverOpener, path)
+	if err != nil {
+		return Counter{}, err
+	}
+	return Counter{v}, nil
+}
+
+// WrapCounter wraps a Value in a Counter.
+func WrapCounter(v Value[int64]) Counter { return Counter{v} }
+
+// Load returns the current value of the counter. A counter that was never
+// written to is 0.
+func (c Counter) Load() (int64, error) {
+	n, _, err := c.v.Load()
+	return n, err
+}
+
+// Add atomically adds delta to the counter and returns the new value.
+func (c Counter) Add(delta int64) (int64, error) {
+	return c.v.Update(func(n int64, _ bool) (int64, error) {
+		return n + delta, nil
+	})
+}
+
+// Inc atomically increments the counter and returns the new value.
+func (c Counter) Inc() (int64, error) {
+	return c.Add(1)
+}
+
+// Reset sets the counter back to 0.
+func (c Counter) Reset() error {
+	return c.v.Store(0)
+}
+
+// Close closes the counter.
+func (c Counter) Close() error {
+	return c.v.Close()
+}
@@ -0,0 +1,28 @@
+package persist_test
+
+import (
+	"fmt"
+	"log"
+
+	"libdb.so/persist"
+	"libdb.so/persist/driver/badgerdb"
+)
+
+func Example_counter() {
+	c, err := persist.NewMustCounter(badgerdb.Open, ":memory:")
+	if err != nil {
+		log.Fatalln("cannot create badgerdb-backed counter:", err)
+	}
+	defer c.Close()
+
+	fmt.Println(c.Inc())
+	fmt.Println(c.Add(10))
+
+	c.Reset()
+	fmt.Println(c.Load())
+
+	// Output:
+	// 1
+	// 11
+	// 0
+}
@@ -1,6 +1,8 @@
 package persist
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 )
@@ -26,12 +28,28 @@ var DefaultDriver DriverOpenFunc = CBORDriver
 // read-only and read-write transactions. Note that transactions are assumed to
 // have the properties of a database transaction, i.e. they are atomic and
 // isolated.
+//
+// AcquireRW may call its function more than once, e.g. if the transaction
+// conflicted with another one and had to be retried. The function must
+// therefore not have any side effects other than on the transaction.
 type Driver interface {
 	io.Closer
 	AcquireRO(func(DriverReadOnlyTx) error) error
 	AcquireRW(func(DriverReadWriteTx) error) error
 }
 
+// ErrClosed is returned by drivers that support it when they are used after
+// being closed.
+var ErrClosed = errors.New("persist: driver closed")
+
+// ErrConflict is returned by drivers that support it when a read-write
+// transaction conflicted with another one and was not retried, or still
+// conflicted after being retried. Running the transaction again may succeed.
+var ErrConflict = errors.New("persist: transaction conflict")
+
+// ErrReadOnly is returned by read-only drivers when a write is attempted.
+var ErrReadOnly = errors.New("persist: driver is read-only")
+
 // DriverReadOnlyTx is a read-only transaction.
 type DriverReadOnlyTx interface {
 	Get(k []byte) ([]byte, bool, error)
@@ -45,3 +63,186 @@ type DriverReadWriteTx interface {
 	Set(k, v []byte) error
 	Delete(k []byte) error
 }
+
+// ErrVersionMismatch is returned by [DriverVersionedRWTx.SetIfVersion] when the
+// key's version is not the expected one.
+var ErrVersionMismatch = errors.New("persist: version mismatch")
+
+// DriverVersionedTx is an optional interface that a transaction may implement
+// if the driver tracks a version for each key. Versions allow optimistic
+// concurrency control across transactions and keys: the versions of some keys
+// are read first, then each key is only written if its version is unchanged.
+type DriverVersionedTx interface {
+	DriverReadOnlyTx
+	// GetVersion is like Get, except it also returns the version of the key.
+	// The version changes every time the key is written, and it is 0 if the
+	// key does not exist. The version of a key written earlier in the same
+	// transaction is unspecified.
+	GetVersion(k []byte) (v []byte, version uint64, ok bool, err error)
+}
+
+// DriverVersionedRWTx is an optional interface that a read-write transaction
+// may implement if it implements [DriverVersionedTx].
+type DriverVersionedRWTx interface {
+	DriverReadWriteTx
+	DriverVersionedTx
+	// SetIfVersion is like Set, except it returns [ErrVersionMismatch] without
+	// writing anything if the version of the key is not version. A version of
+	// 0 means that the key must not exist.
+	SetIfVersion(k, v []byte, version uint64) error
+}
+
+// DriverSaver is an optional interface that a Driver may implement to allow
+// saving a copy of the database to a different path. The original database
+// is not affected.
+type DriverSaver interface {
+	Driver
+	// SaveAs writes a snapshot of the current state of the database to the
+	// given path. The snapshot is written atomically, meaning the file at path
+	// is either fully written or not touched at all.
+	SaveAs(path string) error
+}
+
+// DriverCompacter is an optional interface that a Driver may implement if it
+// keeps a log of changes that can be folded back into its main storage.
+type DriverCompacter interface {
+	Driver
+	// Compact folds all logged changes into the main storage and discards
+	// the log.
+	Compact() error
+}
+
+// DriverContextCloser is an optional interface that a Driver may implement if
+// closing it may take a while, e.g. to flush its writes to disk.
+type DriverContextCloser interface {
+	Driver
+	// CloseContext is like Close, except that it returns ctx's error once ctx
+	// is done, even if the driver is still closing.
+	CloseContext(ctx context.Context) error
+}
+
+// DriverSyncer is an optional interface that a Driver may implement if it can
+// commit transactions without waiting for them to reach the disk.
+type DriverSyncer interface {
+	Driver
+	// Sync flushes all committed transactions to disk, making them durable.
+	Sync() error
+}
+
+// DriverSnapshotter is an optional interface that a Driver may implement to
+// hand out read-only transactions that stay open until they are closed, rather
+// than only for the duration of a function call.
+type DriverSnapshotter interface {
+	Driver
+	// Snapshot starts a read-only transaction that sees the database as it
+	// was when Snapshot was called. The returned snapshot must be closed.
+	Snapshot() (DriverSnapshot, error)
+}
+
+// DriverSnapshot is a read-only transaction returned by
+// [DriverSnapshotter.Snapshot].
+type DriverSnapshot interface {
+	DriverReadOnlyTx
+	io.Closer
+}
+
+// DriverStreamer is an optional interface that a Driver may implement if it can
+// scan all of its key-value pairs concurrently, which is much faster than Each
+// for very large databases.
+type DriverStreamer interface {
+	Driver
+	// StreamEach calls f for each key-value pair in a consistent snapshot of
+	// the database. Pairs are visited in no particular order, but f is never
+	// called concurrently. If f returns an error, then the scan stops and the
+	// error is returned. The slices passed to f must not be retained.
+	StreamEach(f func(k, v []byte) error) error
+}
+
+// DriverPrefixDeleter is an optional interface that a Driver may implement to
+// delete all keys with a certain prefix more efficiently than iterating over
+// all keys.
+type DriverPrefixDeleter interface {
+	Driver
+	// DeletePrefix deletes all keys that start with the given prefix and
+	// returns the number of deleted keys. It may return an error wrapping
+	// [errors.ErrUnsupported] for prefixes that it cannot delete, in which
+	// case callers fall back to deleting the keys within a transaction.
+	DeletePrefix(prefix []byte) (int, error)
+}
+
+// DriverChange describes a change made to a single key by a committed
+// read-write transaction.
+type DriverChange struct {
+	Key []byte
+	// Value is the new value of the key. It is nil if Deleted is true.
+	Value []byte
+	// Deleted is true if the key was deleted.
+	Deleted bool
+}
+
+// DriverWatcher is an optional interface that a Driver may implement to allow
+// watching for changes.
+type DriverWatcher interface {
+	Driver
+	// Watch starts calling f with the changes made by each committed
+	// read-write transaction, in commit order, until ctx is done. Watch does
+	// not block. Once ctx is done and f will no longer be called, the returned
+	// channel is closed. The slice passed to f must not be retained.
+	Watch(ctx context.Context, f func([]DriverChange)) (<-chan struct{}, error)
+}
+
+// DriverUnwrapper is implemented by drivers that wrap another driver without
+// changing how its keys and values are stored. The optional interfaces of the
+// wrapped driver, such as [DriverSaver], may then be used directly.
+type DriverUnwrapper interface {
+	Unwrap() Driver
+}
+
+// driverAs finds the first driver in d's chain of [DriverUnwrapper]s that
+// implements T.
+func driverAs[T any](d Driver) (T, bool) {
+	for {
+		if t, ok := d.(T); ok {
+			return t, true
+		}
+		u, ok := d.(DriverUnwrapper)
+		if !ok {
+			var z T
+			return z, false
+		}
+		d = u.Unwrap()
+	}
+}
+
+// DriverOrderedTx is an optional interface that a transaction may implement if
+// the driver stores its keys in byte order. It allows seeking to either end of
+// the key space without scanning everything.
+type DriverOrderedTx interface {
+	DriverReadOnlyTx
+	// EachOrdered is like Each, except keys are visited in ascending byte
+	// order, or in descending byte order if reverse is true.
+	EachOrdered(reverse bool, f func(k, v []byte) error) error
+}
+
+// DriverPrefixTx is an optional interface that a transaction may implement if
+// it can seek to the keys with a certain prefix without scanning everything.
+type DriverPrefixTx interface {
+	DriverReadOnlyTx
+	// EachPrefix is like Each, except only keys that start with prefix are
+	// visited.
+	EachPrefix(prefix []byte, f func(k, v []byte) error) error
+}
+
+// eachPrefix calls f for every key that starts with prefix. It uses
+// [DriverPrefixTx] if tx implements it, or filters Each otherwise.
+func eachPrefix(tx DriverReadOnlyTx, prefix []byte, f func(k, v []byte) error) error {
+	if ptx, ok := tx.(DriverPrefixTx); ok {
+		return ptx.EachPrefix(prefix, f)
+	}
+	return tx.Each(func(k, v []byte) error {
+		if !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		return f(k, v)
+	})
+}
@@ -1,14 +1,159 @@
 package badgerdb
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/z"
 	"libdb.so/persist"
 )
 
 // Open opens a badger database and returns it as a driver.
+//
+// badger only allows a database to be opened once at a time, so opening the
+// same path again while it is still open returns a new driver that shares the
+// existing database. The database is only closed once all drivers sharing it
+// are closed. Options given to the later opens, such as the logger, are
+// ignored in that case.
 func Open(path string) (persist.Driver, error) {
+	return open(path, nil)
+}
+
+var _ persist.DriverOpenFunc = Open
+
+// OpenWith opens a badger database like [Open], except that configure is called
+// with the options that Open would use and returns the options to use instead.
+// This gives full control over badger's options while keeping the defaults,
+// such as the quieter logging. If path is ":memory:", then the options must
+// still have InMemory set.
+func OpenWith(path string, configure func(badger.Options) badger.Options) (persist.Driver, error) {
+	return open(path, configure)
+}
+
+// OpenWithLogger returns a function that opens a badger database like [Open],
+// except all of badger's logs are routed into the given logger. If logger is
+// nil, then all logs are discarded.
+func OpenWithLogger(logger *slog.Logger) persist.DriverOpenFunc {
+	return func(path string) (persist.Driver, error) {
+		return open(path, func(opts badger.Options) badger.Options {
+			if logger == nil {
+				return opts.WithLogger(nil)
+			}
+			return opts.WithLogger(slogLogger{logger})
+		})
+	}
+}
+
+// OpenWithValueThreshold returns a function that opens a badger database like
+// [Open], except that values smaller than threshold bytes are stored in the
+// LSM tree along with their keys, while larger values are stored separately in
+// the value log.
+//
+// Values in the LSM tree are faster to read and leave the value log empty, so
+// it never needs to be garbage collected, but they make compactions more
+// expensive since they are rewritten along with the keys. A high threshold
+// therefore suits small values, while a low one suits large values. badger
+// caps the threshold at 1 MiB.
+func OpenWithValueThreshold(threshold int64) persist.DriverOpenFunc {
+	return func(path string) (persist.Driver, error) {
+		return open(path, func(opts badger.Options) badger.Options {
+			return opts.WithValueThreshold(threshold)
+		})
+	}
+}
+
+// smallValuesThreshold is the value threshold used by OpenSmallValues. It is
+// the highest threshold that badger allows.
+const smallValuesThreshold = 1 << 20
+
+// smallValuesLogFileSize is the value log file size used by OpenSmallValues.
+// The value log is barely used, so there is no point in large files.
+const smallValuesLogFileSize = 16 << 20
+
+// OpenSmallValues opens a badger database like [Open], but tuned for values
+// that are much smaller than 1 MiB: all such values are kept in the LSM tree
+// and the value log files are kept small. See [OpenWithValueThreshold].
+//
+// Current versions of badger already use the highest threshold by default;
+// this pins it so that values stay in the LSM tree regardless.
+var OpenSmallValues persist.DriverOpenFunc = func(path string) (persist.Driver, error) {
+	return open(path, func(opts badger.Options) badger.Options {
+		return opts.
+			WithValueThreshold(smallValuesThreshold).
+			WithValueLogFileSize(smallValuesLogFileSize)
+	})
+}
+
+// OpenWithSyncWrites returns a function that opens a badger database like
+// [Open], except that badger's SyncWrites option is set to sync.
+//
+// If sync is true, then every committed transaction is synced to disk before
+// the commit returns, so no committed write is ever lost, at the cost of much
+// slower writes. If sync is false, which is badger's default, then writes are
+// flushed to disk in the background: a crash of the process loses nothing, but
+// a crash of the machine may lose the most recent writes. Use [Driver.Sync] to
+// force durability at checkpoints in that case.
+func OpenWithSyncWrites(sync bool) persist.DriverOpenFunc {
+	return func(path string) (persist.Driver, error) {
+		return open(path, func(opts badger.Options) badger.Options {
+			return opts.WithSyncWrites(sync)
+		})
+	}
+}
+
+// encryptedIndexCacheSize is the index cache size used by OpenEncrypted.
+// badger requires an index cache when encryption is enabled, since decrypting
+// table indices on every read would be too slow.
+const encryptedIndexCacheSize = 100 << 20
+
+// OpenEncrypted opens a badger database like [Open], except that all data is
+// encrypted at rest using AES with the given key, which must be 16, 24 or 32
+// bytes long to select AES-128, AES-192 or AES-256. Keys are encrypted as well
+// as values.
+//
+// An existing database must be opened with the same key that it was created
+// with. If the database at path is already open, then the driver shares it
+// and key is ignored, see [Open]. Note that backups written by
+// [Driver.SaveAs] are not encrypted.
+func OpenEncrypted(path string, key []byte) (persist.Driver, error) {
+	return open(path, func(opts badger.Options) badger.Options {
+		return opts.
+			WithEncryptionKey(key).
+			WithIndexCacheSize(encryptedIndexCacheSize)
+	})
+}
+
+// OpenExisting opens a badger database like [Open], except it returns
+// [persist.ErrNotFound] if there is no database at path yet instead of creating
+// one. In-memory databases never exist beforehand, so opening ":memory:"
+// always fails.
+func OpenExisting(path string) (persist.Driver, error) {
+	if path != ":memory:" {
+		_, err := os.Stat(filepath.Join(path, badger.ManifestFilename))
+		if err == nil {
+			return Open(path)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", persist.ErrNotFound, path)
+}
+
+var _ persist.DriverOpenFunc = OpenExisting
+
+func open(path string, configure func(badger.Options) badger.Options) (persist.Driver, error) {
 	var opts badger.Options
 	if path == ":memory:" {
 		opts = badger.DefaultOptions("").WithInMemory(true)
@@ -19,22 +164,67 @@ func Open(path string) (persist.Driver, error) {
 	// Quiet the logs unless it's really important.
 	opts = opts.WithLoggingLevel(badger.WARNING)
 
-	db, err := badger.Open(opts)
+	if configure != nil {
+		opts = configure(opts)
+		if path == ":memory:" && !opts.InMemory {
+			return nil, errors.New("persist: options must keep :memory: databases in memory")
+		}
+	}
+
+	if opts.InMemory {
+		db, err := badger.Open(opts)
+		if err != nil {
+			return nil, err
+		}
+		return NewDriver(db), nil
+	}
+
+	return openShared(opts)
+}
+
+// OpenWithGC opens a badger database like [Open] and starts a background
+// goroutine that garbage collects the value log every interval. The goroutine
+// is stopped when the driver is closed. No garbage collection is done for
+// in-memory databases.
+func OpenWithGC(path string, interval time.Duration) (persist.Driver, error) {
+	d, err := Open(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDriver(db), nil
+	driver := d.(*Driver)
+	if !driver.db.Opts().InMemory {
+		driver.startGC(interval)
+	}
+
+	return driver, nil
 }
 
-var _ persist.DriverOpenFunc = Open
+// gcDiscardRatio is the discard ratio passed to RunValueLogGC.
+const gcDiscardRatio = 0.5
 
 // Driver is a driver for a persistent map.
 type Driver struct {
 	db *badger.DB
+	// release is called instead of closing db if db is shared.
+	release func() error
+	closed  atomic.Bool
+
+	stopGC chan struct{}
+	gcDone chan struct{}
 }
 
-var _ persist.Driver = (*Driver)(nil)
+var (
+	_ persist.Driver                 = (*Driver)(nil)
+	_ persist.DriverSaver            = (*Driver)(nil)
+	_ persist.DriverPrefixDeleter    = (*Driver)(nil)
+	_ persist.DriverWatcher          = (*Driver)(nil)
+	_ persist.DriverWithCapabilities = (*Driver)(nil)
+	_ persist.DriverSnapshotter      = (*Driver)(nil)
+	_ persist.DriverSyncer           = (*Driver)(nil)
+	_ persist.DriverStreamer         = (*Driver)(nil)
+	_ persist.DriverContextCloser    = (*Driver)(nil)
+)
 
 // NewDriver returns a new Driver.
 func NewDriver(db *badger.DB) *Driver {
@@ -42,19 +232,323 @@ func NewDriver(db *badger.DB) *Driver {
 }
 
 func (d *Driver) Close() error {
+	if !d.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	if d.stopGC != nil {
+		close(d.stopGC)
+		<-d.gcDone
+	}
+	if d.release != nil {
+		return d.release()
+	}
 	return d.db.Close()
 }
 
+// CloseContext closes the driver like Close, except that it returns ctx's error
+// once ctx is done. badger may take a while to flush its memtables to disk, in
+// which case it keeps closing in the background.
+func (d *Driver) CloseContext(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Close() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Driver) Capabilities() persist.DriverCapabilities {
+	return persist.DriverCapabilities{
+		Ordered:    true,
+		PrefixScan: true,
+		Backup:     true,
+		Watch:      true,
+		Versioned:  true,
+		Persistent: !d.db.Opts().InMemory,
+	}
+}
+
+func (d *Driver) startGC(interval time.Duration) {
+	d.stopGC = make(chan struct{})
+	d.gcDone = make(chan struct{})
+
+	go func() {
+		defer close(d.gcDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stopGC:
+				return
+			case <-ticker.C:
+				// Each run rewrites at most one file, so keep going until
+				// there is nothing left to collect.
+				for d.db.RunValueLogGC(gcDiscardRatio) == nil {
+					select {
+					case <-d.stopGC:
+						return
+					default:
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Sync syncs all committed writes to disk. It is only needed if the database
+// was opened without SyncWrites, see [OpenWithSyncWrites].
+func (d *Driver) Sync() error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+	return wrapClosedErr(d.db.Sync())
+}
+
+// SaveAs writes a full backup of the database to the given path. The backup
+// can be restored using [Driver.Restore] or badger's Load method.
+func (d *Driver) SaveAs(path string) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := d.db.Backup(f, 0); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// reservedPrefix is the prefix of the keys that persist uses internally.
+var reservedPrefix = []byte("\xffpersist\x00")
+
+// DeletePrefix deletes all keys with the given prefix using badger's
+// DropPrefix. DropPrefix blocks all writes while it runs.
+//
+// This is not atomic: the keys are counted in a separate transaction before
+// they are dropped, so the returned count may be off if other writes happen
+// concurrently, and readers may observe the keys being dropped.
+//
+// DropPrefix would also drop the keys that persist uses internally, so an
+// empty prefix, or one that overlaps with those keys, is rejected with an
+// error wrapping [errors.ErrUnsupported]. [persist.Map.DeletePrefix] then
+// falls back to deleting the keys within a transaction.
+func (d *Driver) DeletePrefix(prefix []byte) (int, error) {
+	if d.closed.Load() {
+		return 0, persist.ErrClosed
+	}
+
+	if len(prefix) == 0 || bytes.HasPrefix(prefix, reservedPrefix) || bytes.HasPrefix(reservedPrefix, prefix) {
+		return 0, fmt.Errorf("persist: cannot drop prefix %q: %w", prefix, errors.ErrUnsupported)
+	}
+
+	var n int
+	err := d.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+
+		it := tx.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, wrapClosedErr(err)
+	}
+
+	if err := d.db.DropPrefix(prefix); err != nil {
+		return 0, wrapClosedErr(err)
+	}
+
+	return n, nil
+}
+
+// Watch watches for changes using badger's Subscribe. The subscription is
+// established asynchronously, so changes committed right after Watch returns
+// may be missed.
+//
+// badger does not tell deletions apart from writes of empty values, so writing
+// an empty value is reported as a deletion.
+func (d *Driver) Watch(ctx context.Context, f func([]persist.DriverChange)) (<-chan struct{}, error) {
+	if d.closed.Load() {
+		return nil, persist.ErrClosed
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var changes []persist.DriverChange
+		d.db.Subscribe(ctx, func(kvs *badger.KVList) error {
+			changes = changes[:0]
+			for _, kv := range kvs.Kv {
+				if bytes.HasPrefix(kv.Key, badgerInternalPrefix) {
+					continue
+				}
+				if len(kv.Value) == 0 {
+					changes = append(changes, persist.DriverChange{Key: kv.Key, Deleted: true})
+				} else {
+					changes = append(changes, persist.DriverChange{Key: kv.Key, Value: kv.Value})
+				}
+			}
+			if len(changes) > 0 {
+				f(changes)
+			}
+			return nil
+		}, []pb.Match{{}})
+	}()
+	return done, nil
+}
+
+// StreamEach calls f for each key-value pair using badger's Stream framework,
+// which iterates over the database using multiple goroutines. This is much
+// faster than a regular iteration for large databases, but pairs are visited
+// in no particular order.
+func (d *Driver) StreamEach(f func(k, v []byte) error) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	// Orchestrate may report the cancellation caused by an error from Send
+	// rather than the error itself, so the error returned by f is kept here.
+	var ferr error
+
+	stream := d.db.NewStream()
+	stream.LogPrefix = "persist.StreamEach"
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+		for _, kv := range list.Kv {
+			if kv.StreamDone || bytes.HasPrefix(kv.Key, badgerInternalPrefix) {
+				continue
+			}
+			if err := f(kv.Key, kv.Value); err != nil {
+				ferr = err
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := stream.Orchestrate(context.Background())
+	if ferr != nil {
+		return ferr
+	}
+	return wrapClosedErr(err)
+}
+
+// badgerInternalPrefix is the prefix of keys used internally by badger.
+var badgerInternalPrefix = []byte("!badger!")
+
+// AcquireRO acquires a read-only transaction. It returns [persist.ErrClosed]
+// if the driver is closed.
 func (d *Driver) AcquireRO(f func(persist.DriverReadOnlyTx) error) error {
-	return d.db.View(func(tx *badger.Txn) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	err := d.db.View(func(tx *badger.Txn) error {
 		return f(roTx{db: d.db, tx: tx})
 	})
+	return wrapClosedErr(err)
+}
+
+// Snapshot starts a read-only transaction that is kept open until the
+// snapshot is closed. While it is open, badger cannot discard the old versions
+// of keys written in the meantime.
+func (d *Driver) Snapshot() (persist.DriverSnapshot, error) {
+	if d.closed.Load() {
+		return nil, persist.ErrClosed
+	}
+	return snapshotTx{roTx{db: d.db, tx: d.db.NewTransaction(false)}}, nil
+}
+
+type snapshotTx struct {
+	roTx
 }
 
+func (tx snapshotTx) Close() error {
+	tx.tx.Discard()
+	return nil
+}
+
+// maxConflictRetries is the maximum number of times AcquireRW runs a
+// transaction that conflicts with another one.
+const maxConflictRetries = 100
+
+// conflictBackoff and maxConflictBackoff bound the wait between the retries of
+// a conflicting transaction. The wait starts at conflictBackoff, doubles after
+// every retry up to maxConflictBackoff, and is jittered so that conflicting
+// transactions do not retry in lockstep.
+const (
+	conflictBackoff    = time.Millisecond
+	maxConflictBackoff = 10 * time.Millisecond
+)
+
+// AcquireRW acquires a read-write transaction, retrying it with a short
+// backoff if it conflicts with another one. It returns [persist.ErrClosed] if
+// the driver is closed, or [persist.ErrConflict] if the transaction still
+// conflicts after retrying.
 func (d *Driver) AcquireRW(f func(persist.DriverReadWriteTx) error) error {
-	return d.db.Update(func(tx *badger.Txn) error {
-		return f(rwTx{roTx{db: d.db, tx: tx}})
-	})
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	var err error
+	backoff := conflictBackoff
+	for i := 0; i < maxConflictRetries; i++ {
+		if i > 0 {
+			// Wait for a random duration in [backoff/2, backoff).
+			time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2))))
+			backoff = min(backoff*2, maxConflictBackoff)
+		}
+
+		err = d.db.Update(func(tx *badger.Txn) error {
+			return f(rwTx{roTx{db: d.db, tx: tx}})
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			return wrapClosedErr(err)
+		}
+	}
+	return fmt.Errorf("%w: %w", persist.ErrConflict, err)
+}
+
+// wrapClosedErr wraps badger's ErrDBClosed with persist.ErrClosed. This
+// covers transactions that race with Close.
+func wrapClosedErr(err error) error {
+	if errors.Is(err, badger.ErrDBClosed) {
+		return fmt.Errorf("%w: %w", persist.ErrClosed, err)
+	}
+	return err
 }
 
 type roTx struct {
@@ -62,7 +556,10 @@ type roTx struct {
 	tx *badger.Txn
 }
 
-var _ persist.DriverReadOnlyTx = roTx{}
+var (
+	_ persist.DriverOrderedTx = roTx{}
+	_ persist.DriverPrefixTx  = roTx{}
+)
 
 func (tx roTx) Get(k []byte) ([]byte, bool, error) {
 	item, err := tx.tx.Get(k)
@@ -76,9 +573,28 @@ func (tx roTx) Get(k []byte) ([]byte, bool, error) {
 	return v, true, err
 }
 
+// GetVersion is like Get, except it also returns the version of the key, which
+// is the timestamp of the transaction that last wrote it.
+func (tx roTx) GetVersion(k []byte) ([]byte, uint64, bool, error) {
+	item, err := tx.tx.Get(k)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+	v, err := yoinkItemValue(item)
+	return v, item.Version(), true, err
+}
+
 func (tx roTx) Each(f func(k, v []byte) error) error {
+	return tx.EachOrdered(false, f)
+}
+
+func (tx roTx) EachOrdered(reverse bool, f func(k, v []byte) error) error {
 	opts := badger.DefaultIteratorOptions
 	opts.PrefetchValues = true
+	opts.Reverse = reverse
 
 	it := tx.tx.NewIterator(opts)
 	defer it.Close()
@@ -99,6 +615,30 @@ func (tx roTx) Each(f func(k, v []byte) error) error {
 	return nil
 }
 
+// EachPrefix implements [persist.DriverPrefixTx] by seeking to prefix.
+func (tx roTx) EachPrefix(prefix []byte, f func(k, v []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	opts.Prefix = prefix
+
+	it := tx.tx.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		item := it.Item()
+
+		v, err := yoinkItemValue(item)
+		if err != nil {
+			return err
+		}
+
+		if err := f(item.Key(), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (tx roTx) EachKey(f func(k []byte) error) error {
 	opts := badger.DefaultIteratorOptions
 	opts.PrefetchValues = false
@@ -131,12 +671,40 @@ type rwTx struct {
 	roTx
 }
 
-var _ persist.DriverReadWriteTx = rwTx{}
+var _ persist.DriverVersionedRWTx = rwTx{}
 
 func (tx rwTx) Set(k, v []byte) error {
-	return tx.tx.Set(k, v)
+	return wrapTxErr(tx.tx.Set(k, v))
+}
+
+// SetIfVersion sets k to v if its version is version. Reading the version adds
+// k to the transaction's read set, so the transaction conflicts with any other
+// that writes k before it commits. It is then retried and sees the new version.
+func (tx rwTx) SetIfVersion(k, v []byte, version uint64) error {
+	var current uint64
+
+	item, err := tx.tx.Get(k)
+	switch {
+	case err == nil:
+		current = item.Version()
+	case !errors.Is(err, badger.ErrKeyNotFound):
+		return err
+	}
+
+	if current != version {
+		return persist.ErrVersionMismatch
+	}
+	return tx.Set(k, v)
 }
 
 func (tx rwTx) Delete(k []byte) error {
-	return tx.tx.Delete(k)
+	return wrapTxErr(tx.tx.Delete(k))
+}
+
+// wrapTxErr wraps badger's ErrTxnTooBig with persist.ErrTxTooLarge.
+func wrapTxErr(err error) error {
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		return fmt.Errorf("%w: %w", persist.ErrTxTooLarge, err)
+	}
+	return err
 }
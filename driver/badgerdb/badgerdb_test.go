@@ -0,0 +1,711 @@
+package badgerdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/dgraph-io/badger/v4"
+	"libdb.so/persist"
+)
+
+func TestOpenWithGC(t *testing.T) {
+	d, err := OpenWithGC(t.TempDir(), time.Millisecond)
+	assert.NoError(t, err, "OpenWithGC")
+
+	// Let the GC run a few times.
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan error)
+	go func() { done <- d.Close() }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err, "Close")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the GC goroutine")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	caps := persist.Capabilities(d)
+	assert.True(t, caps.Ordered, "Ordered")
+	assert.False(t, caps.Persistent, "Persistent")
+
+	var counts valueCounts
+	assert.Equal(t, caps, persist.Capabilities(persist.WithMetrics(d, &counts)), "WithMetrics")
+	assert.Equal(t, caps, persist.Capabilities(persist.WithRetry(d, persist.RetryPolicy{})), "WithRetry")
+
+	// Wrappers that do not report their capabilities may change what their
+	// transactions implement, so nothing is reported through them.
+	assert.Equal(t, persist.DriverCapabilities{}, persist.Capabilities(unwrapOnly{d}), "unwrapOnly")
+}
+
+// unwrapOnly is a driver wrapper that does not report its capabilities.
+type unwrapOnly struct {
+	persist.Driver
+}
+
+func (d unwrapOnly) Unwrap() persist.Driver { return d.Driver }
+
+func TestOpenShared(t *testing.T) {
+	dir := t.TempDir()
+
+	d1, err := Open(dir)
+	assert.NoError(t, err, "Open 1")
+
+	d2, err := Open(dir)
+	assert.NoError(t, err, "Open 2")
+
+	m1 := persist.NewMapFromEncoders(d1, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+	m2 := persist.NewMapFromEncoders(d2, persist.EncoderPair[string, string]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[string](),
+	})
+
+	err = m1.Store("int", 42)
+	assert.NoError(t, err, "Store int")
+
+	err = m2.Store("string", "hello")
+	assert.NoError(t, err, "Store string")
+
+	err = d1.Close()
+	assert.NoError(t, err, "Close 1")
+
+	// Closing twice must not release the database for the other driver.
+	err = d1.Close()
+	assert.NoError(t, err, "Close 1 again")
+
+	v, ok, err := m2.Load("string")
+	assert.NoError(t, err, "Load after first Close")
+	assert.True(t, ok, "Load after first Close")
+	assert.Equal(t, "hello", v, "Load after first Close")
+
+	err = d2.Close()
+	assert.NoError(t, err, "Close 2")
+
+	// The database must be fully closed now, so it can be opened again.
+	d3, err := Open(dir)
+	assert.NoError(t, err, "Open 3")
+
+	m3 := persist.NewMapFromEncoders(d3, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	n, ok, err := m3.Load("int")
+	assert.NoError(t, err, "Load after reopen")
+	assert.True(t, ok, "Load after reopen")
+	assert.Equal(t, 42, n, "Load after reopen")
+
+	err = d3.Close()
+	assert.NoError(t, err, "Close 3")
+}
+
+func TestStoreManyTxTooBig(t *testing.T) {
+	// A small memtable makes badger's transaction size limit small enough to
+	// hit quickly.
+	opts := badger.DefaultOptions("").
+		WithInMemory(true).
+		WithMemTableSize(1 << 20).
+		WithValueThreshold(1 << 10).
+		WithLogger(nil)
+
+	db, err := badger.Open(opts)
+	assert.NoError(t, err, "badger.Open")
+
+	m := persist.NewMapFromEncoders(NewDriver(db), persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	const n = 20000
+
+	// Make sure that the batch does not fit in a single transaction.
+	err = NewDriver(db).AcquireRW(func(tx persist.DriverReadWriteTx) error {
+		for i := 0; i < n; i++ {
+			if err := tx.Set([]byte(strconv.Itoa(i)), []byte{0}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.IsError(t, err, persist.ErrTxTooLarge, "single transaction")
+
+	err = m.StoreMany(func(yield func(string, int) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(strconv.Itoa(i), i) {
+				return
+			}
+		}
+	})
+	assert.NoError(t, err, "StoreMany")
+
+	var count int
+	m.Keys()(func(string) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, n, count, "stored keys")
+}
+
+func TestSkipUnchangedWrites(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	db := d.(*Driver).db
+
+	version := func() uint64 {
+		var v uint64
+		err := db.View(func(tx *badger.Txn) error {
+			item, err := tx.Get([]byte("key"))
+			if err != nil {
+				return err
+			}
+			v = item.Version()
+			return nil
+		})
+		assert.NoError(t, err, "get version")
+		return v
+	}
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, map[string]int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[map[string]int](),
+	}).WithSkipUnchangedWrites()
+
+	value := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}
+
+	err = m.Store("key", value)
+	assert.NoError(t, err, "Store 1")
+	v1 := version()
+
+	err = m.Store("key", value)
+	assert.NoError(t, err, "Store 2")
+	assert.Equal(t, v1, version(), "unchanged Store must not write")
+
+	value["e"] = 5
+
+	err = m.Store("key", value)
+	assert.NoError(t, err, "Store 3")
+	assert.NotEqual(t, v1, version(), "changed Store must write")
+}
+
+func TestClosed(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	err = m.Store("a", 1)
+	assert.NoError(t, err, "Store before Close")
+
+	err = m.Close()
+	assert.NoError(t, err, "Close")
+
+	err = m.Store("a", 2)
+	assert.IsError(t, err, persist.ErrClosed, "Store after Close")
+
+	_, _, err = m.Load("a")
+	assert.IsError(t, err, persist.ErrClosed, "Load after Close")
+
+	err = m.Close()
+	assert.NoError(t, err, "Close again")
+}
+
+func TestDeletePrefix(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	for _, k := range []string{"a/1", "a/2", "b"} {
+		assert.NoError(t, m.Store(k, 1), "Store %q", k)
+	}
+
+	reserved := []byte("\xffpersist\x00test")
+	err = d.AcquireRW(func(tx persist.DriverReadWriteTx) error {
+		return tx.Set(reserved, []byte{1})
+	})
+	assert.NoError(t, err, "Set reserved")
+
+	for _, prefix := range []string{"", "\xff", "\xffpersist\x00te"} {
+		_, err := d.(*Driver).DeletePrefix([]byte(prefix))
+		assert.IsError(t, err, errors.ErrUnsupported, "DeletePrefix %q", prefix)
+	}
+
+	n, err := m.DeletePrefix("a/")
+	assert.NoError(t, err, "DeletePrefix a/")
+	assert.Equal(t, 2, n, "DeletePrefix a/")
+
+	// Map falls back to deleting within a transaction, which leaves reserved
+	// keys alone.
+	n, err = m.DeletePrefix("")
+	assert.NoError(t, err, "DeletePrefix empty")
+	assert.Equal(t, 1, n, "DeletePrefix empty")
+
+	err = d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+		_, ok, err := tx.Get(reserved)
+		assert.True(t, ok, "reserved key kept")
+		return err
+	})
+	assert.NoError(t, err, "Get reserved")
+}
+
+func TestOpenWithValueThreshold(t *testing.T) {
+	// In-memory databases always keep values in the LSM tree, so these must
+	// be on disk.
+	d, err := OpenWithValueThreshold(1 << 10)(t.TempDir())
+	assert.NoError(t, err, "OpenWithValueThreshold")
+	defer d.Close()
+
+	assert.Equal(t, int64(1<<10), d.(*Driver).db.Opts().ValueThreshold, "ValueThreshold")
+
+	d, err = OpenSmallValues(t.TempDir())
+	assert.NoError(t, err, "OpenSmallValues")
+	defer d.Close()
+
+	opts := d.(*Driver).db.Opts()
+	assert.Equal(t, int64(smallValuesThreshold), opts.ValueThreshold, "small ValueThreshold")
+	assert.Equal(t, int64(smallValuesLogFileSize), opts.ValueLogFileSize, "small ValueLogFileSize")
+
+	_, err = OpenWithValueThreshold(1 << 30)(t.TempDir())
+	assert.Error(t, err, "threshold above badger's limit")
+}
+
+func TestOpenWithSyncWrites(t *testing.T) {
+	for _, sync := range []bool{true, false} {
+		d, err := OpenWithSyncWrites(sync)(t.TempDir())
+		assert.NoError(t, err, "OpenWithSyncWrites")
+		assert.Equal(t, sync, d.(*Driver).db.Opts().SyncWrites, "SyncWrites")
+
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+		assert.NoError(t, m.Store("a", 1), "Store")
+		assert.NoError(t, m.Sync(), "Sync")
+
+		assert.NoError(t, m.Close(), "Close")
+		assert.IsError(t, m.Sync(), persist.ErrClosed, "Sync after Close")
+	}
+}
+
+func TestOpenWith(t *testing.T) {
+	path := t.TempDir()
+
+	d, err := OpenWith(path, func(opts badger.Options) badger.Options {
+		assert.Equal(t, path, opts.Dir, "default Dir")
+		return opts.WithNumVersionsToKeep(3)
+	})
+	assert.NoError(t, err, "OpenWith")
+	defer d.Close()
+
+	assert.Equal(t, 3, d.(*Driver).db.Opts().NumVersionsToKeep, "NumVersionsToKeep")
+
+	_, err = OpenWith(":memory:", func(opts badger.Options) badger.Options {
+		return opts.WithInMemory(false)
+	})
+	assert.Error(t, err, "OpenWith :memory: without InMemory")
+}
+
+func TestOpenExisting(t *testing.T) {
+	path := t.TempDir() + "/db"
+
+	_, err := OpenExisting(path)
+	assert.IsError(t, err, persist.ErrNotFound, "OpenExisting before Open")
+
+	_, err = OpenExisting(":memory:")
+	assert.IsError(t, err, persist.ErrNotFound, "OpenExisting :memory:")
+
+	d, err := Open(path)
+	assert.NoError(t, err, "Open")
+	assert.NoError(t, d.Close(), "Close")
+
+	d, err = OpenExisting(path)
+	assert.NoError(t, err, "OpenExisting after Open")
+	assert.NoError(t, d.Close(), "Close")
+}
+
+func TestOpenEncrypted(t *testing.T) {
+	path := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+
+	d, err := OpenEncrypted(path, key)
+	assert.NoError(t, err, "OpenEncrypted")
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, string]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.StringEncoder[string](),
+	})
+	assert.NoError(t, m.Store("secret", "hunter2"), "Store")
+	assert.NoError(t, m.Close(), "Close")
+
+	_, err = OpenEncrypted(path, bytes.Repeat([]byte{2}, 32))
+	assert.Error(t, err, "OpenEncrypted with wrong key")
+
+	_, err = Open(path)
+	assert.Error(t, err, "Open without key")
+
+	d, err = OpenEncrypted(path, key)
+	assert.NoError(t, err, "OpenEncrypted again")
+	defer d.Close()
+
+	m = persist.NewMapFromEncoders(d, m.Encoder())
+	v, err := m.Get("secret")
+	assert.NoError(t, err, "Get")
+	assert.Equal(t, "hunter2", v, "Get")
+}
+
+func TestRestore(t *testing.T) {
+	encs := persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	}
+	backup := filepath.Join(t.TempDir(), "backup")
+
+	src, err := Open(":memory:")
+	assert.NoError(t, err, "Open source")
+	defer src.Close()
+
+	m := persist.NewMapFromEncoders(src, encs)
+	assert.NoError(t, m.Store("a", 1), "Store")
+	assert.NoError(t, m.SaveAs(backup), "SaveAs")
+
+	err = src.(*Driver).Restore(backup)
+	assert.Error(t, err, "Restore into a non-empty database")
+
+	dst, err := Open(":memory:")
+	assert.NoError(t, err, "Open destination")
+	defer dst.Close()
+
+	garbage := filepath.Join(t.TempDir(), "garbage")
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a badger backup\n"), 0644), "WriteFile")
+
+	var versionErr *BackupVersionError
+	err = dst.(*Driver).Restore(garbage)
+	assert.True(t, errors.As(err, &versionErr), "Restore garbage: %v", err)
+	assert.Equal(t, garbage, versionErr.Path, "BackupVersionError path")
+	assert.NotZero(t, versionErr.Expected, "BackupVersionError expected version")
+
+	assert.NoError(t, dst.(*Driver).Restore(backup), "Restore")
+
+	v, err := persist.NewMapFromEncoders(dst, encs).Get("a")
+	assert.NoError(t, err, "Get")
+	assert.Equal(t, 1, v, "Get")
+}
+
+func TestStreamEach(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	want := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		want[strconv.Itoa(i)] = i
+	}
+	assert.NoError(t, m.StoreMany(func(yield func(string, int) bool) {
+		for k, v := range want {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}), "StoreMany")
+	assert.NoError(t, m.Delete("0"), "Delete")
+	delete(want, "0")
+
+	got := make(map[string]int)
+	err = m.AllStream(func(k string, v int) error {
+		got[k] = v
+		return nil
+	})
+	assert.NoError(t, err, "AllStream")
+	assert.Equal(t, want, got, "AllStream")
+
+	var n int
+	err = m.AllStream(func(string, int) error {
+		n++
+		if n == 10 {
+			return persist.StopIteration
+		}
+		return nil
+	})
+	assert.NoError(t, err, "AllStream stops early")
+	assert.Equal(t, 10, n, "AllStream stops early")
+
+	errBoom := errors.New("boom")
+	err = m.AllStream(func(string, int) error { return errBoom })
+	assert.IsError(t, err, errBoom, "AllStream returns errors from f")
+
+	assert.NoError(t, d.AcquireRW(func(tx persist.DriverReadWriteTx) error {
+		return tx.Set([]byte("bad"), []byte{0xff})
+	}), "Set bad value")
+
+	err = m.AllStream(func(string, int) error { return nil })
+	var encodeErr *persist.EncodeError
+	assert.True(t, errors.As(err, &encodeErr), "AllStream returns decode errors: %v", err)
+	assert.Equal(t, 10, n, "AllStream stops early")
+}
+
+func TestCloseContext(t *testing.T) {
+	d, err := Open(t.TempDir())
+	assert.NoError(t, err, "Open")
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+	assert.NoError(t, m.Store("a", 1), "Store")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assert.NoError(t, m.CloseContext(ctx), "CloseContext")
+	assert.IsError(t, m.Store("a", 2), persist.ErrClosed, "Store after CloseContext")
+}
+
+func TestVersions(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	_, version, ok, err := m.LoadVersion("a")
+	assert.NoError(t, err, "LoadVersion missing")
+	assert.False(t, ok, "LoadVersion missing")
+	assert.Equal(t, uint64(0), version, "version of missing key")
+
+	assert.NoError(t, m.StoreIfVersion("a", 1, 0), "StoreIfVersion new key")
+	assert.IsError(t, m.StoreIfVersion("a", 1, 0), persist.ErrVersionMismatch, "StoreIfVersion existing key")
+
+	v, version, ok, err := m.LoadVersion("a")
+	assert.NoError(t, err, "LoadVersion")
+	assert.True(t, ok, "LoadVersion")
+	assert.Equal(t, 1, v, "LoadVersion")
+
+	assert.NoError(t, m.Store("a", 2), "Store")
+	assert.IsError(t, m.StoreIfVersion("a", 3, version), persist.ErrVersionMismatch, "StoreIfVersion stale")
+
+	_, version, _, err = m.LoadVersion("a")
+	assert.NoError(t, err, "LoadVersion")
+	assert.NoError(t, m.StoreIfVersion("a", 3, version), "StoreIfVersion current")
+
+	v, _, err = m.Load("a")
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, 3, v, "Load")
+
+	_, versionA, _, err := m.LoadVersion("a")
+	assert.NoError(t, err, "LoadVersion a")
+
+	// Nothing is stored if any of the keys changed.
+	err = m.StoreManyIfVersion([]persist.VersionedPair[string, int]{
+		{Key: "a", Value: 4, Version: versionA},
+		{Key: "b", Value: 4, Version: 0},
+		{Key: "a", Value: 5, Version: 0},
+	})
+	assert.IsError(t, err, persist.ErrVersionMismatch, "StoreManyIfVersion stale")
+
+	var batchErr *persist.BatchError[string]
+	assert.True(t, errors.As(err, &batchErr), "StoreManyIfVersion BatchError")
+	assert.Equal(t, 2, batchErr.Index, "StoreManyIfVersion BatchError index")
+
+	_, ok, err = m.Load("b")
+	assert.NoError(t, err, "Load b")
+	assert.False(t, ok, "Load b after failed StoreManyIfVersion")
+
+	err = m.StoreManyIfVersion([]persist.VersionedPair[string, int]{
+		{Key: "a", Value: 4, Version: versionA},
+		{Key: "b", Value: 4, Version: 0},
+	})
+	assert.NoError(t, err, "StoreManyIfVersion current")
+
+	for _, k := range []string{"a", "b"} {
+		v, _, err := m.Load(k)
+		assert.NoError(t, err, "Load %q", k)
+		assert.Equal(t, 4, v, "Load %q", k)
+	}
+}
+
+// valueCounts counts the values observed through persist.MetricsHooks.
+type valueCounts struct {
+	reads, writes int
+}
+
+func (c *valueCounts) ObserveTx(persist.TxMode, time.Duration, error) {}
+
+func (c *valueCounts) ObserveValue(op persist.ValueOp, _ int) {
+	if op == persist.ValueWrite {
+		c.writes++
+	} else {
+		c.reads++
+	}
+}
+
+func TestVersionsWithMetrics(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	var counts valueCounts
+
+	m := persist.NewMapFromEncoders(persist.WithMetrics(d, &counts), persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	assert.NoError(t, m.StoreIfVersion("a", 1, 0), "StoreIfVersion new key")
+
+	v, version, ok, err := m.LoadVersion("a")
+	assert.NoError(t, err, "LoadVersion")
+	assert.True(t, ok, "LoadVersion")
+	assert.Equal(t, 1, v, "LoadVersion")
+
+	assert.IsError(t, m.StoreIfVersion("a", 2, 0), persist.ErrVersionMismatch, "StoreIfVersion stale")
+	assert.NoError(t, m.StoreIfVersion("a", 2, version), "StoreIfVersion current")
+
+	err = m.StoreManyIfVersion([]persist.VersionedPair[string, int]{{Key: "b", Value: 1}})
+	assert.NoError(t, err, "StoreManyIfVersion")
+
+	assert.Equal(t, valueCounts{reads: 1, writes: 4}, counts, "observed values")
+}
+
+func TestFirstLastWithMetrics(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	var counts valueCounts
+
+	m := persist.NewMapFromEncoders(persist.WithMetrics(d, &counts), persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	})
+
+	for i, k := range []string{"b", "a", "c"} {
+		assert.NoError(t, m.Store(k, i), "Store %q", k)
+	}
+
+	counts = valueCounts{}
+
+	k, _, ok, err := m.First()
+	assert.NoError(t, err, "First")
+	assert.True(t, ok, "First")
+	assert.Equal(t, "a", k, "First")
+
+	k, _, ok, err = m.Last()
+	assert.NoError(t, err, "Last")
+	assert.True(t, ok, "Last")
+	assert.Equal(t, "c", k, "Last")
+
+	// Each must be a single step of the ordered iterator, not a full scan.
+	assert.Equal(t, valueCounts{reads: 2}, counts, "observed values")
+}
+
+func TestIndexedMapWithMetrics(t *testing.T) {
+	d, err := Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	var counts valueCounts
+
+	m := persist.NewMapFromEncoders(persist.WithMetrics(d, &counts), persist.EncoderPair[string, string]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.StringEncoder[string](),
+	})
+
+	im, err := persist.NewIndexedMap(m, func(v string) string { return v })
+	assert.NoError(t, err, "NewIndexedMap")
+
+	for _, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, im.Store(k, "color "+k), "Store %q", k)
+	}
+
+	counts = valueCounts{}
+
+	vs, err := im.LookupByIndex("color b")
+	assert.NoError(t, err, "LookupByIndex")
+	assert.Equal(t, []string{"color b"}, vs, "LookupByIndex")
+
+	// Only the index entry and its value are read, rather than everything.
+	assert.Equal(t, valueCounts{reads: 2}, counts, "observed values")
+}
+
+func TestOpenManaged(t *testing.T) {
+	path := t.TempDir()
+
+	d, err := OpenManaged(path)
+	assert.NoError(t, err, "OpenManaged")
+
+	encs := persist.EncoderPair[string, int]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[int](),
+	}
+	m := persist.NewMapFromEncoders(d, encs)
+
+	assert.NoError(t, m.Store("a", 1), "Store a 1")
+	v1 := d.Version()
+	assert.NoError(t, m.Store("a", 2), "Store a 2")
+	assert.NoError(t, m.Store("b", 2), "Store b 2")
+	assert.Equal(t, v1+2, d.Version(), "Version")
+
+	old := persist.NewMapFromEncoders(d.At(v1), encs)
+
+	v, _, err := old.Load("a")
+	assert.NoError(t, err, "Load a at v1")
+	assert.Equal(t, 1, v, "Load a at v1")
+
+	ok, err := old.Contains("b")
+	assert.NoError(t, err, "Contains b at v1")
+	assert.False(t, ok, "b did not exist at v1")
+
+	v, _, err = m.Load("a")
+	assert.NoError(t, err, "Load a latest")
+	assert.Equal(t, 2, v, "Load a latest")
+
+	// Write at an explicit version in the future.
+	future := persist.NewMapFromEncoders(d.At(100), encs)
+	assert.NoError(t, future.Store("a", 100), "Store a at 100")
+	assert.Equal(t, uint64(100), d.Version(), "Version after explicit write")
+
+	v, _, err = persist.NewMapFromEncoders(d.At(99), encs).Load("a")
+	assert.NoError(t, err, "Load a at 99")
+	assert.Equal(t, 2, v, "Load a at 99")
+
+	assert.NoError(t, d.Close(), "Close")
+
+	d, err = OpenManaged(path)
+	assert.NoError(t, err, "reopen")
+	defer d.Close()
+	assert.Equal(t, uint64(100), d.Version(), "Version after reopen")
+}
@@ -0,0 +1,32 @@
+package badgerdb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// slogLogger adapts a *slog.Logger into a badger.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+var _ badger.Logger = slogLogger{}
+
+func (l slogLogger) Errorf(f string, v ...any)   { l.log(slog.LevelError, f, v) }
+func (l slogLogger) Warningf(f string, v ...any) { l.log(slog.LevelWarn, f, v) }
+func (l slogLogger) Infof(f string, v ...any)    { l.log(slog.LevelInfo, f, v) }
+func (l slogLogger) Debugf(f string, v ...any)   { l.log(slog.LevelDebug, f, v) }
+
+func (l slogLogger) log(level slog.Level, f string, v []any) {
+	ctx := context.Background()
+	if !l.l.Enabled(ctx, level) {
+		return
+	}
+	// badger likes to end its messages with a newline.
+	msg := strings.TrimSpace(fmt.Sprintf(f, v...))
+	l.l.Log(ctx, level, msg, "component", "badger")
+}
@@ -0,0 +1,167 @@
+package badgerdb
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v4"
+	"libdb.so/persist"
+)
+
+// ManagedDriver is a driver over a badger database opened in managed mode,
+// where every write is committed at an explicit version and reads can see the
+// database as it was at any version. This allows time-travel queries such as
+// "the state as of version N", e.g. for event sourcing.
+//
+// Used as a plain [persist.Driver], it reads the latest version and commits
+// each read-write transaction at the next version. Use [ManagedDriver.At] to
+// read or write at a specific version instead.
+//
+// Old versions are never discarded, so the database only ever grows.
+type ManagedDriver struct {
+	db *badger.DB
+	// mu serializes read-write transactions so that versions are committed
+	// in order.
+	mu      sync.Mutex
+	version atomic.Uint64
+	closed  atomic.Bool
+}
+
+var (
+	_ persist.Driver                 = (*ManagedDriver)(nil)
+	_ persist.DriverWithCapabilities = (*ManagedDriver)(nil)
+)
+
+// OpenManaged opens a badger database in managed mode. The database must
+// always be opened in managed mode, since the versions of a database opened
+// normally are unrelated to the versions used here.
+func OpenManaged(path string) (*ManagedDriver, error) {
+	var opts badger.Options
+	if path == ":memory:" {
+		opts = badger.DefaultOptions("").WithInMemory(true)
+	} else {
+		opts = badger.DefaultOptions(path)
+	}
+	opts = opts.WithLoggingLevel(badger.WARNING)
+
+	db, err := badger.OpenManaged(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ManagedDriver{db: db}
+	d.version.Store(db.MaxVersion())
+	return d, nil
+}
+
+// Version returns the latest version that was committed.
+func (d *ManagedDriver) Version() uint64 {
+	return d.version.Load()
+}
+
+// At returns a driver that reads the database as it was at the given version
+// and commits read-write transactions at that version. Closing the returned
+// driver does nothing.
+//
+// Writing at a version below [ManagedDriver.Version] rewrites history: the
+// write is seen by reads at later versions unless the key was written again
+// after it.
+func (d *ManagedDriver) At(version uint64) persist.Driver {
+	return managedView{d, version}
+}
+
+func (d *ManagedDriver) Close() error {
+	if !d.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return d.db.Close()
+}
+
+func (d *ManagedDriver) Capabilities() persist.DriverCapabilities {
+	return persist.DriverCapabilities{
+		Ordered:    true,
+		Versioned:  true,
+		Persistent: !d.db.Opts().InMemory,
+	}
+}
+
+// AcquireRO acquires a read-only transaction at the latest version.
+func (d *ManagedDriver) AcquireRO(f func(persist.DriverReadOnlyTx) error) error {
+	return d.acquireROAt(math.MaxUint64, f)
+}
+
+// AcquireRW acquires a read-write transaction that is committed at the version
+// after the latest one.
+func (d *ManagedDriver) AcquireRW(f func(persist.DriverReadWriteTx) error) error {
+	return d.acquireRWAt(0, f)
+}
+
+func (d *ManagedDriver) acquireROAt(version uint64, f func(persist.DriverReadOnlyTx) error) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	tx := d.db.NewTransactionAt(version, false)
+	defer tx.Discard()
+
+	return wrapClosedErr(f(roTx{db: d.db, tx: tx}))
+}
+
+// acquireRWAt runs a read-write transaction that reads and commits at the
+// given version, or at the version after the latest one if version is 0.
+func (d *ManagedDriver) acquireRWAt(version uint64, f func(persist.DriverReadWriteTx) error) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	readTs, commitTs := version, version
+	if version == 0 {
+		readTs = d.version.Load()
+		commitTs = readTs + 1
+	}
+
+	// Read-write transactions never run concurrently, so they cannot
+	// conflict.
+	if err := d.commitAt(readTs, commitTs, f); err != nil {
+		return wrapClosedErr(err)
+	}
+
+	if commitTs > d.version.Load() {
+		d.version.Store(commitTs)
+	}
+	return nil
+}
+
+func (d *ManagedDriver) commitAt(readTs, commitTs uint64, f func(persist.DriverReadWriteTx) error) error {
+	tx := d.db.NewTransactionAt(readTs, true)
+	defer tx.Discard()
+
+	if err := f(rwTx{roTx{db: d.db, tx: tx}}); err != nil {
+		return err
+	}
+	return tx.CommitAt(commitTs, nil)
+}
+
+// managedView is a ManagedDriver pinned to a single version.
+type managedView struct {
+	d       *ManagedDriver
+	version uint64
+}
+
+func (v managedView) Close() error { return nil }
+
+func (v managedView) AcquireRO(f func(persist.DriverReadOnlyTx) error) error {
+	return v.d.acquireROAt(v.version, f)
+}
+
+func (v managedView) AcquireRW(f func(persist.DriverReadWriteTx) error) error {
+	if v.version == 0 {
+		return errors.New("persist: cannot write at version 0")
+	}
+	return v.d.acquireRWAt(v.version, f)
+}
@@ -0,0 +1,168 @@
+package badgerdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"libdb.so/persist"
+)
+
+// restoreMaxPendingWrites is the number of pending writes allowed while
+// restoring a backup.
+const restoreMaxPendingWrites = 256
+
+// BackupVersionError is returned by [Driver.Restore] when a backup cannot be
+// decoded by the version of badger that this package is built with. This
+// usually means that the backup was written by an incompatible version of
+// badger, e.g. when moving backups between environments. Backups do not record
+// the version that wrote them, so only the expected version is known.
+type BackupVersionError struct {
+	// Path is the path of the backup.
+	Path string
+	// Expected is the version of badger that this package is built with.
+	Expected string
+	// Err is the decoding error.
+	Err error
+}
+
+func (e *BackupVersionError) Error() string {
+	return fmt.Sprintf(
+		"persist: backup %s cannot be read by badger %s, it was likely written by another badger version: %v",
+		e.Path, e.Expected, e.Err)
+}
+
+func (e *BackupVersionError) Unwrap() error {
+	return e.Err
+}
+
+// badgerVersion returns the version of the badger module that this package is
+// built with.
+func badgerVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, dep := range info.Deps {
+			if dep.Path != "github.com/dgraph-io/badger/v4" {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return "v4"
+}
+
+// Restore loads a backup written by [Driver.SaveAs] into the database. The
+// backup is checked before anything is loaded: if it cannot be decoded, then a
+// [*BackupVersionError] is returned.
+//
+// The database must be empty, since keys written after the backup was taken
+// would shadow the restored ones.
+func (d *Driver) Restore(path string) error {
+	if d.closed.Load() {
+		return persist.ErrClosed
+	}
+
+	empty, err := d.isEmpty()
+	if err != nil {
+		return wrapClosedErr(err)
+	}
+	if !empty {
+		return errors.New("persist: cannot restore into a non-empty database")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer f.Close()
+
+	if err := checkBackup(f, path); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek backup: %w", err)
+	}
+
+	if err := d.db.Load(f, restoreMaxPendingWrites); err != nil {
+		return wrapClosedErr(fmt.Errorf("load backup: %w", err))
+	}
+
+	return nil
+}
+
+func (d *Driver) isEmpty() (bool, error) {
+	empty := true
+	err := d.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := tx.NewIterator(opts)
+		defer it.Close()
+
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// checkBackup checks that the backup in f, opened from path, can be decoded.
+// It follows the format read by badger's Load: a sequence of key-value lists,
+// each prefixed with its size. badger itself allocates whatever size it reads,
+// so this must be done before loading a backup that may be in another format.
+func checkBackup(f *os.File, path string) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat backup: %w", err)
+	}
+	remaining := stat.Size()
+
+	br := bufio.NewReader(f)
+	var buf []byte
+
+	for {
+		var sz uint64
+		if err := binary.Read(br, binary.LittleEndian, &sz); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read backup: %w", err)
+		}
+		remaining -= 8
+
+		if sz > uint64(remaining) {
+			return &BackupVersionError{
+				Path:     path,
+				Expected: badgerVersion(),
+				Err:      fmt.Errorf("list of %d bytes exceeds the remaining %d bytes", sz, remaining),
+			}
+		}
+		remaining -= int64(sz)
+
+		if uint64(cap(buf)) < sz {
+			buf = make([]byte, sz)
+		}
+		if _, err := io.ReadFull(br, buf[:sz]); err != nil {
+			return fmt.Errorf("read backup: %w", err)
+		}
+
+		var list pb.KVList
+		if err := list.Unmarshal(buf[:sz]); err != nil {
+			return &BackupVersionError{
+				Path:     path,
+				Expected: badgerVersion(),
+				Err:      err,
+			}
+		}
+	}
+}
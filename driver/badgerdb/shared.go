@@ -0,0 +1,65 @@
+package badgerdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// sharedDB is a database opened by one or more drivers.
+type sharedDB struct {
+	db   *badger.DB
+	refs int
+}
+
+var (
+	sharedMu  sync.Mutex
+	sharedDBs = map[string]*sharedDB{}
+)
+
+// openShared returns a driver over the database in opts.Dir, opening it only
+// if it is not already open.
+func openShared(opts badger.Options) (*Driver, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve path: %w", err)
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	shared, ok := sharedDBs[dir]
+	if !ok {
+		db, err := badger.Open(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		shared = &sharedDB{db: db}
+		sharedDBs[dir] = shared
+	}
+
+	shared.refs++
+
+	d := NewDriver(shared.db)
+	d.release = func() error { return releaseShared(dir) }
+	return d, nil
+}
+
+// releaseShared drops a reference to the database at dir and closes it if it
+// was the last one.
+func releaseShared(dir string) error {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	shared := sharedDBs[dir]
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+
+	delete(sharedDBs, dir)
+	return shared.db.Close()
+}
@@ -0,0 +1,312 @@
+// Package fsdir provides a driver that stores each key as its own file in a
+// directory. The file name is the hex-encoded key and the file contents are the
+// value. This trades performance for the ability to inspect and track
+// individual entries using regular tools.
+//
+// Since file names are limited to 255 bytes on most file systems, keys are
+// limited to [MaxKeySize] bytes.
+package fsdir
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"libdb.so/persist"
+)
+
+// Open opens the directory at path as a driver, creating it if needed. If path
+// is ":memory:", then the files are kept in memory instead.
+//
+// Each file is written atomically using a temporary file and a rename. A
+// read-write transaction buffers its changes and applies them when it
+// commits, but a crash midway through applying them may leave only some of
+// them on disk.
+func Open(path string) (persist.Driver, error) {
+	if path == ":memory:" {
+		return &Driver{files: memFiles{}}, nil
+	}
+
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return nil, fmt.Errorf("fsdir: create directory: %w", err)
+	}
+
+	return &Driver{files: dirFiles(path)}, nil
+}
+
+var _ persist.DriverOpenFunc = Open
+
+// MaxKeySize is the maximum size of a key in bytes. Its hex encoding is as
+// long as the longest file name allowed by most file systems. Writing a longer
+// key fails with an error wrapping [persist.ErrKeyTooLarge]. The limit applies
+// to in-memory drivers as well, so that they behave the same.
+//
+// Note that keys used internally by persist, such as those of
+// [persist.IndexedMap], are longer than the keys they are derived from.
+const MaxKeySize = 127
+
+// Driver is a driver that stores each key as a file.
+type Driver struct {
+	mu    sync.RWMutex
+	files files
+}
+
+var _ persist.DriverWithCapabilities = (*Driver)(nil)
+
+func (d *Driver) Close() error { return nil }
+
+func (d *Driver) Capabilities() persist.DriverCapabilities {
+	_, inMemory := d.files.(memFiles)
+	return persist.DriverCapabilities{Persistent: !inMemory}
+}
+
+func (d *Driver) AcquireRO(f func(persist.DriverReadOnlyTx) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return f(roTx{d.files})
+}
+
+func (d *Driver) AcquireRW(f func(persist.DriverReadWriteTx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx := &rwTx{
+		roTx:    roTx{d.files},
+		pending: make(map[string][]byte),
+	}
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	// Apply in a stable order so that a partial failure is easier to reason
+	// about.
+	names := make([]string, 0, len(tx.pending))
+	for name := range tx.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := tx.pending[name]
+		if v == nil {
+			if err := d.files.remove(name); err != nil {
+				return fmt.Errorf("fsdir: remove %s: %w", name, err)
+			}
+		} else {
+			if err := d.files.write(name, v); err != nil {
+				return fmt.Errorf("fsdir: write %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+type roTx struct {
+	files files
+}
+
+func (tx roTx) Get(k []byte) ([]byte, bool, error) {
+	if len(k) > MaxKeySize {
+		return nil, false, nil
+	}
+	v, err := tx.files.read(hex.EncodeToString(k))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (tx roTx) Each(f func(k, v []byte) error) error {
+	return tx.EachKey(func(k []byte) error {
+		v, err := tx.files.read(hex.EncodeToString(k))
+		if err != nil {
+			return err
+		}
+		return f(k, v)
+	})
+}
+
+func (tx roTx) EachKey(f func(k []byte) error) error {
+	names, err := tx.files.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		k, err := hex.DecodeString(name)
+		if err != nil {
+			// Not one of ours, e.g. a temporary file.
+			continue
+		}
+		if err := f(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rwTx is a read-write transaction. Changes are buffered in pending until
+// the transaction commits, where a nil value means deletion.
+type rwTx struct {
+	roTx
+	pending map[string][]byte
+}
+
+func (tx *rwTx) Get(k []byte) ([]byte, bool, error) {
+	if v, ok := tx.pending[hex.EncodeToString(k)]; ok {
+		return v, v != nil, nil
+	}
+	return tx.roTx.Get(k)
+}
+
+func (tx *rwTx) Each(f func(k, v []byte) error) error {
+	return tx.EachKey(func(k []byte) error {
+		v, _, err := tx.Get(k)
+		if err != nil {
+			return err
+		}
+		return f(k, v)
+	})
+}
+
+func (tx *rwTx) EachKey(f func(k []byte) error) error {
+	err := tx.roTx.EachKey(func(k []byte) error {
+		if _, ok := tx.pending[hex.EncodeToString(k)]; ok {
+			return nil
+		}
+		return f(k)
+	})
+	if err != nil {
+		return err
+	}
+	for name, v := range tx.pending {
+		if v == nil {
+			continue
+		}
+		k, _ := hex.DecodeString(name)
+		if err := f(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *rwTx) Set(k, v []byte) error {
+	if len(k) > MaxKeySize {
+		return fmt.Errorf("fsdir: %d bytes exceeds limit of %d: %w", len(k), MaxKeySize, persist.ErrKeyTooLarge)
+	}
+	// Never store nil, since that means deletion.
+	tx.pending[hex.EncodeToString(k)] = append([]byte{}, v...)
+	return nil
+}
+
+func (tx *rwTx) Delete(k []byte) error {
+	if len(k) > MaxKeySize {
+		// Such a key cannot have been stored.
+		return nil
+	}
+	tx.pending[hex.EncodeToString(k)] = nil
+	return nil
+}
+
+// files is a flat collection of named files.
+type files interface {
+	read(name string) ([]byte, error)
+	write(name string, data []byte) error
+	remove(name string) error
+	list() ([]string, error)
+}
+
+// dirFiles stores files in a directory on disk.
+type dirFiles string
+
+func (dir dirFiles) read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(dir), name))
+}
+
+// write writes data into a temporary file and renames it over the file with
+// the given name. The temporary file is not named after it, since that would
+// leave less room for the name.
+func (dir dirFiles) write(name string, data []byte) error {
+	f, err := os.CreateTemp(string(dir), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(string(dir), name))
+}
+
+func (dir dirFiles) remove(name string) error {
+	err := os.Remove(filepath.Join(string(dir), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (dir dirFiles) list() ([]string, error) {
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// memFiles stores files in memory. It relies on the driver's lock for
+// synchronization.
+type memFiles map[string][]byte
+
+func (m memFiles) read(name string) ([]byte, error) {
+	v, ok := m[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return v, nil
+}
+
+func (m memFiles) write(name string, data []byte) error {
+	m[name] = data
+	return nil
+}
+
+func (m memFiles) remove(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func (m memFiles) list() ([]string, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,103 @@
+package fsdir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/persist"
+)
+
+var encs = persist.EncoderPair[string, []byte]{
+	Key:   persist.StringEncoder[string](),
+	Value: persist.BytesEncoder[[]byte](),
+}
+
+func TestLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := Open(dir)
+	assert.NoError(t, err, "Open")
+
+	m := persist.NewMapFromEncoders(d, encs)
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", []byte("hello")), "Store a")
+	assert.NoError(t, m.Store("bc", []byte("world")), "Store bc")
+
+	b, err := os.ReadFile(filepath.Join(dir, "61"))
+	assert.NoError(t, err, "ReadFile a")
+	assert.Equal(t, "hello", string(b), "file of a")
+
+	b, err = os.ReadFile(filepath.Join(dir, "6263"))
+	assert.NoError(t, err, "ReadFile bc")
+	assert.Equal(t, "world", string(b), "file of bc")
+
+	assert.NoError(t, m.Delete("a"), "Delete a")
+
+	_, err = os.Stat(filepath.Join(dir, "61"))
+	assert.True(t, os.IsNotExist(err), "file of a after Delete")
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := Open(dir)
+	assert.NoError(t, err, "Open")
+
+	m := persist.NewMapFromEncoders(d, encs)
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", []byte("1")), "Store a")
+	assert.NoError(t, m.Store("a", []byte("2")), "Store a again")
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err, "ReadDir")
+	assert.Equal(t, 1, len(entries), "no temporary files are left behind")
+
+	// A temporary file left behind by a crash is not mistaken for a key.
+	err = os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("3"), 0666)
+	assert.NoError(t, err, "WriteFile temporary file")
+
+	var keys []string
+	m.Keys()(func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []string{"a"}, keys, "Keys")
+
+	v, err := m.Get("a")
+	assert.NoError(t, err, "Get a")
+	assert.Equal(t, "2", string(v), "Get a")
+}
+
+func TestLongKeys(t *testing.T) {
+	for _, path := range []string{t.TempDir(), ":memory:"} {
+		d, err := Open(path)
+		assert.NoError(t, err, "Open %q", path)
+
+		m := persist.NewMapFromEncoders(d, encs)
+
+		longest := strings.Repeat("k", MaxKeySize)
+		assert.NoError(t, m.Store(longest, []byte("v")), "Store longest key")
+
+		v, err := m.Get(longest)
+		assert.NoError(t, err, "Get longest key")
+		assert.Equal(t, "v", string(v), "Get longest key")
+
+		tooLong := longest + "k"
+		err = m.Store(tooLong, []byte("v"))
+		assert.IsError(t, err, persist.ErrKeyTooLarge, "Store too long key")
+
+		_, ok, err := m.Load(tooLong)
+		assert.NoError(t, err, "Load too long key")
+		assert.False(t, ok, "Load too long key")
+
+		assert.NoError(t, m.Delete(tooLong), "Delete too long key")
+		assert.NoError(t, m.Delete(longest), "Delete longest key")
+
+		assert.NoError(t, m.Close(), "Close")
+	}
+}
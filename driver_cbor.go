@@ -1,58 +1,586 @@
 package persist
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/fxamacker/cbor/v2"
 )
 
 // CBORDriver is a driver that stores data in a CBOR file.
-var CBORDriver DriverOpenFunc = openCBORDriver
+//
+// Closing the driver is its durability barrier: once Close returns nil,
+// everything that was committed is on disk. Using the driver after it is
+// closed returns [ErrClosed].
+var CBORDriver DriverOpenFunc = CBORDriverWith(CBORDriverOptions{})
+
+// CBORDriverOptions are options for [CBORDriverWith].
+type CBORDriverOptions struct {
+	// TextKeys makes the driver write keys that are valid UTF-8 as CBOR text
+	// strings instead of byte strings, so that they are readable when the file
+	// is inspected using generic CBOR tools. Keys that are not valid UTF-8 are
+	// still written as byte strings.
+	//
+	// Note that this is mostly useful with key encoders such as
+	// [StringEncoder]: keys encoded by [CBOREncoder] carry their CBOR head.
+	//
+	// Files are read the same way regardless of this option.
+	TextKeys bool
+	// Journal makes the driver append the changes made by each read-write
+	// transaction to a journal file next to the main file, named after it
+	// with a ".journal" suffix, instead of rewriting the main file. The
+	// journal is synced after every transaction, so writes are durable
+	// without costing a rewrite of the whole map.
+	//
+	// The journal is folded back into the main file when the driver is
+	// opened, or when [Map.Compact] is called. A transaction that was only
+	// partially appended when the process crashed is discarded.
+	//
+	// A leftover journal is always replayed when the file is opened, even if
+	// this option is not set.
+	Journal bool
+	// KeepOpen makes the driver keep the main file open and overwrite it in
+	// place after every read-write transaction, instead of reopening and
+	// truncating it each time. This saves a few syscalls per transaction,
+	// which matters under high write rates. It has no effect in journal mode.
+	//
+	// The file is overwritten from the start and then truncated to the new
+	// size, so it is never empty, but a crash in the middle of a write may
+	// leave it holding a mix of the old and new contents, which cannot be
+	// decoded. Without this option, a crash at the wrong time may leave the
+	// file empty or partially written instead. Use Journal if writes must
+	// survive crashes. The file is synced when the driver is closed.
+	KeepOpen bool
+	// FlushInterval makes the driver write the main file in the background at
+	// most once per interval, rather than after every read-write transaction.
+	// This avoids a disk write for every single change when many changes are
+	// made in quick succession. It has no effect in journal mode.
+	//
+	// Changes are only kept in memory until they are written, so a crash may
+	// lose the changes made up to FlushInterval before it. Closing the driver
+	// or calling [Map.Sync] writes them immediately.
+	FlushInterval time.Duration
+	// MustExist makes opening fail with [ErrNotFound] if the file does not
+	// exist yet, instead of creating it. This catches a mistyped path that
+	// would otherwise silently start an empty database.
+	MustExist bool
+	// Less orders the keys visited by Each and EachKey. If nil, then keys are
+	// visited in ascending byte order. It only affects iteration, not how the
+	// file is written.
+	Less func(a, b []byte) bool
+}
+
+// CBORDriverWithAutoFlush returns a function that opens a driver like
+// [CBORDriver] that writes changes in the background at most once per
+// interval. See [CBORDriverOptions.FlushInterval].
+func CBORDriverWithAutoFlush(interval time.Duration) DriverOpenFunc {
+	return CBORDriverWith(CBORDriverOptions{FlushInterval: interval})
+}
+
+// CBORDriverExisting opens a driver like [CBORDriver], except it returns
+// [ErrNotFound] if the file does not exist instead of creating it. See
+// [CBORDriverOptions.MustExist].
+var CBORDriverExisting DriverOpenFunc = CBORDriverWith(CBORDriverOptions{MustExist: true})
+
+// CBORDriverWith returns a function that opens a driver like [CBORDriver] with
+// the given options.
+func CBORDriverWith(opts CBORDriverOptions) DriverOpenFunc {
+	return func(path string) (Driver, error) {
+		return openCBORDriver(path, opts)
+	}
+}
 
 type cborDriver struct {
-	path string
-	mu   sync.RWMutex
-	m    map[cbor.ByteString]cbor.RawMessage
+	path     string
+	opts     CBORDriverOptions
+	mu       sync.RWMutex
+	m        map[cbor.ByteString]cbor.RawMessage
+	watchers driverWatchers
+
+	// journal is the journal file opened for appending, or nil if the driver
+	// is not in journal mode. journalSize is its size after the last
+	// successful append.
+	journal     *os.File
+	journalSize int64
+
+	// file is the main file if the KeepOpen option is set and the driver is
+	// not in journal mode, or nil otherwise.
+	file *os.File
+
+	// dirty is true if there are changes that were not written to the main
+	// file yet. It is only used if FlushInterval is set.
+	dirty     bool
+	stopFlush chan struct{}
+	flushDone chan struct{}
+
+	closed bool
+	// readOnly is true if the driver was opened using OpenCBORFromFS.
+	readOnly bool
+}
+
+var (
+	_ DriverCompacter = (*cborDriver)(nil)
+	_ DriverSyncer    = (*cborDriver)(nil)
+)
+
+// OpenCBORFromFS opens a read-only driver over the CBOR file with the given
+// name in fsys, which must have been written by [CBORDriver]. The whole file is
+// read into memory, and read-write transactions fail with [ErrReadOnly]. This
+// allows shipping default data within the binary using [embed.FS].
+//
+// Journals are not supported, so the file must have been compacted, which is
+// the case after the driver that wrote it was closed.
+func OpenCBORFromFS(fsys fs.FS, name string) (Driver, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("persist: open file: %w", err)
+	}
+	defer f.Close()
+
+	d := &cborDriver{
+		m:        make(map[cbor.ByteString]cbor.RawMessage),
+		readOnly: true,
+	}
+
+	if err := d.decode(f); err != nil {
+		return nil, err
+	}
+
+	return d, nil
 }
 
-func openCBORDriver(path string) (Driver, error) {
+func openCBORDriver(path string, opts CBORDriverOptions) (Driver, error) {
 	d := &cborDriver{
 		path: path,
+		opts: opts,
 		m:    make(map[cbor.ByteString]cbor.RawMessage),
 	}
 
-	f, err := os.Open(d.path)
+	exists, err := d.load()
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("persist: read file: %w", err)
-		}
+		return nil, err
+	}
+	if !exists && opts.MustExist {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	replayed, err := d.replayJournal()
+	if err != nil {
+		return nil, err
+	}
 
-		if err := d.AcquireRW(func(DriverReadWriteTx) error { return nil }); err != nil {
+	if !exists || replayed {
+		if err := d.compact(); err != nil {
 			return nil, err
 		}
+	}
+
+	if opts.Journal {
+		d.journal, err = os.OpenFile(d.journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("persist: open journal: %w", err)
+		}
 	} else {
+		if opts.KeepOpen {
+			if err := d.openFile(); err != nil {
+				return nil, err
+			}
+		}
+		if opts.FlushInterval > 0 {
+			d.startAutoFlush(opts.FlushInterval)
+		}
+	}
+
+	return d, nil
+}
+
+// load reads the main file into d.m. It reports whether the file exists.
+func (d *cborDriver) load() (bool, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("persist: read file: %w", err)
+	}
+	defer f.Close()
+
+	if err := d.decode(f); err != nil {
+		return true, err
+	}
+
+	if err := f.Close(); err != nil {
+		return true, fmt.Errorf("persist: close file: %w", err)
+	}
+
+	return true, nil
+}
+
+// openFile opens the main file to be kept open, closing the previous one.
+func (d *cborDriver) openFile() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("persist: open file: %w", err)
+	}
+	if d.file != nil {
+		d.file.Close()
+	}
+	d.file = f
+	return nil
+}
+
+// writeFile writes the whole map into the main file. The caller must hold the
+// lock.
+func (d *cborDriver) writeFile() error {
+	b, err := d.marshal()
+	if err != nil {
+		return fmt.Errorf("persist: marshal CBOR: %w", err)
+	}
+
+	if d.file != nil {
+		err = d.overwriteFile(b)
+	} else {
+		err = os.WriteFile(d.path, b, 0666)
+	}
+	if err != nil {
+		return fmt.Errorf("persist: write file: %w", err)
+	}
+
+	d.dirty = false
+	return nil
+}
+
+// startAutoFlush starts writing the main file every interval if it is dirty.
+func (d *cborDriver) startAutoFlush(interval time.Duration) {
+	d.stopFlush = make(chan struct{})
+	d.flushDone = make(chan struct{})
+
+	go func() {
+		defer close(d.flushDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stopFlush:
+				return
+			case <-ticker.C:
+				d.mu.Lock()
+				if d.dirty && !d.closed {
+					// On failure, the file stays dirty and is retried on
+					// the next tick. Close reports the error if it persists.
+					d.writeFile()
+				}
+				d.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// overwriteFile overwrites the kept-open main file with b in place.
+func (d *cborDriver) overwriteFile(b []byte) error {
+	if _, err := d.file.WriteAt(b, 0); err != nil {
+		return err
+	}
+	return d.file.Truncate(int64(len(b)))
+}
+
+// decode decodes a whole file from r into d.m.
+func (d *cborDriver) decode(r io.Reader) error {
+	var m map[cborFileKey]cbor.RawMessage
+	if err := cbor.NewDecoder(r).Decode(&m); err != nil {
+		return fmt.Errorf("persist: decode CBOR: %w", err)
+	}
+
+	for k, v := range m {
+		v, err := unwrapCBORValue(v)
+		if err != nil {
+			return fmt.Errorf("persist: decode CBOR: key %q: %w", k, err)
+		}
+		d.m[cbor.ByteString(k)] = v
+	}
+
+	return nil
+}
+
+func (d *cborDriver) journalPath() string {
+	return d.path + ".journal"
+}
+
+// cborJournalOp is a single change recorded in the journal. Each transaction
+// is appended to the journal as one array of these.
+type cborJournalOp struct {
+	_       struct{} `cbor:",toarray"`
+	Key     cbor.ByteString
+	Value   cbor.RawMessage
+	Deleted bool
+}
+
+// replayJournal applies the journal, if any, over d.m. It reports whether any
+// transaction was replayed. A truncated transaction at the end of the journal
+// is ignored.
+func (d *cborDriver) replayJournal() (bool, error) {
+	f, err := os.Open(d.journalPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("persist: read journal: %w", err)
+	}
+	defer f.Close()
+
+	var replayed bool
+	dec := cbor.NewDecoder(f)
+
+	for {
+		var ops []cborJournalOp
+		if err := dec.Decode(&ops); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return false, fmt.Errorf("persist: decode journal: %w", err)
+		}
+
+		for _, op := range ops {
+			if op.Deleted {
+				delete(d.m, op.Key)
+				continue
+			}
+			v, err := unwrapCBORValue(op.Value)
+			if err != nil {
+				return false, fmt.Errorf("persist: decode journal: key %q: %w", op.Key, err)
+			}
+			d.m[op.Key] = v
+		}
+		replayed = true
+	}
+
+	return replayed, nil
+}
+
+// appendJournal appends the given changes to the journal as one transaction
+// and syncs it. If this fails, the journal is truncated back so that it does
+// not end with a partial transaction.
+func (d *cborDriver) appendJournal(changes []DriverChange) error {
+	ops := make([]cborJournalOp, len(changes))
+	for i, c := range changes {
+		ops[i] = cborJournalOp{
+			Key:     cbor.ByteString(c.Key),
+			Deleted: c.Deleted,
+		}
+		if !c.Deleted {
+			ops[i].Value = wrapCBORValue(c.Value)
+		}
+	}
+
+	b, err := cbor.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("persist: marshal journal: %w", err)
+	}
+
+	if _, err := d.journal.Write(b); err != nil {
+		d.journal.Truncate(d.journalSize)
+		return fmt.Errorf("persist: write journal: %w", err)
+	}
+
+	if err := d.journal.Sync(); err != nil {
+		d.journal.Truncate(d.journalSize)
+		return fmt.Errorf("persist: sync journal: %w", err)
+	}
+
+	d.journalSize += int64(len(b))
+	return nil
+}
+
+// Compact writes the whole map into the main file and empties the journal.
+func (d *cborDriver) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	return d.compact()
+}
+
+func (d *cborDriver) compact() error {
+	b, err := d.marshal()
+	if err != nil {
+		return fmt.Errorf("persist: marshal CBOR: %w", err)
+	}
+
+	// The main file must be fully written before the journal is discarded.
+	// If the process crashes in between, then replaying the journal over the
+	// new main file yields the same state.
+	if err := writeFileAtomic(d.path, b); err != nil {
+		return err
+	}
+	d.dirty = false
+
+	// The kept-open file was replaced by the rename.
+	if d.file != nil {
+		if err := d.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if d.journal == nil {
+		if err := os.Remove(d.journalPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("persist: remove journal: %w", err)
+		}
+		return nil
+	}
+
+	if err := d.journal.Truncate(0); err != nil {
+		return fmt.Errorf("persist: truncate journal: %w", err)
+	}
+	d.journalSize = 0
+
+	return nil
+}
+
+// Sync writes the changes that are not on disk yet and syncs the files.
+func (d *cborDriver) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if d.readOnly {
+		return nil
+	}
+
+	if d.dirty {
+		if err := d.writeFile(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case d.journal != nil:
+		if err := d.journal.Sync(); err != nil {
+			return fmt.Errorf("persist: sync journal: %w", err)
+		}
+	case d.file != nil:
+		if err := d.file.Sync(); err != nil {
+			return fmt.Errorf("persist: sync file: %w", err)
+		}
+	default:
+		f, err := os.Open(d.path)
+		if err != nil {
+			return fmt.Errorf("persist: open file: %w", err)
+		}
 		defer f.Close()
 
-		if err := cbor.NewDecoder(f).Decode(&d.m); err != nil {
-			return nil, fmt.Errorf("persist: decode CBOR: %w", err)
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("persist: sync file: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// Close flushes everything that is not on disk yet and returns the error if
+// that fails.
+func (d *cborDriver) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	// The auto-flush goroutine takes the lock, so it must be stopped without
+	// holding it.
+	if d.stopFlush != nil {
+		close(d.stopFlush)
+		<-d.flushDone
+	}
 
-		if err := f.Close(); err != nil {
-			return nil, fmt.Errorf("persist: close file: %w", err)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.flush()
+}
+
+// flush makes all committed state durable and releases the journal and the
+// kept-open file, writing the changes that are not on disk yet first.
+func (d *cborDriver) flush() error {
+	var writeErr error
+	if d.dirty {
+		writeErr = d.writeFile()
+	}
+
+	if d.file != nil {
+		file := d.file
+		d.file = nil
+
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("persist: sync file: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("persist: close file: %w", err)
 		}
 	}
 
-	return d, nil
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if d.journal == nil {
+		return nil
+	}
+
+	journal := d.journal
+	d.journal = nil
+
+	if err := journal.Sync(); err != nil {
+		journal.Close()
+		return fmt.Errorf("persist: sync journal: %w", err)
+	}
+
+	if err := journal.Close(); err != nil {
+		return fmt.Errorf("persist: close journal: %w", err)
+	}
+
+	return nil
 }
 
-func (d *cborDriver) Close() error { return nil }
+func (d *cborDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		Ordered:    d.opts.Less == nil,
+		Backup:     true,
+		Watch:      true,
+		Persistent: true,
+	}
+}
 
 func (d *cborDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
+	if d.closed {
+		return ErrClosed
+	}
+
 	return f(d)
 }
 
@@ -60,17 +588,168 @@ func (d *cborDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	if err := f(d); err != nil {
+	if d.closed {
+		return ErrClosed
+	}
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	tx := &cborRWTx{cborDriver: d}
+
+	if err := f(tx); err != nil {
+		tx.rollback()
 		return err
 	}
 
-	b, err := cbor.Marshal(d.m)
+	if d.journal != nil {
+		changes := tx.changes()
+		if len(changes) > 0 {
+			if err := d.appendJournal(changes); err != nil {
+				tx.rollback()
+				return err
+			}
+		}
+
+		if d.watchers.active() {
+			d.watchers.publish(changes)
+		}
+
+		return nil
+	}
+
+	if d.opts.FlushInterval > 0 {
+		d.dirty = d.dirty || len(tx.undo) > 0
+	} else if err := d.writeFile(); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	if d.watchers.active() {
+		d.watchers.publish(tx.changes())
+	}
+
+	return nil
+}
+
+func (d *cborDriver) Watch(ctx context.Context, f func([]DriverChange)) (<-chan struct{}, error) {
+	return d.watchers.watch(ctx, f), nil
+}
+
+func (d *cborDriver) SaveAs(path string) error {
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrClosed
+	}
+	b, err := d.marshal()
+	d.mu.RUnlock()
+
 	if err != nil {
 		return fmt.Errorf("persist: marshal CBOR: %w", err)
 	}
 
-	if err := os.WriteFile(d.path, b, 0666); err != nil {
-		return fmt.Errorf("persist: write file: %w", err)
+	return writeFileAtomic(path, b)
+}
+
+// marshal encodes the whole map into the file format. The caller must hold the
+// lock.
+func (d *cborDriver) marshal() ([]byte, error) {
+	m := make(map[any]cbor.RawMessage, len(d.m))
+	for k, v := range d.m {
+		if d.opts.TextKeys && utf8.ValidString(string(k)) {
+			m[string(k)] = wrapCBORValue(v)
+		} else {
+			m[k] = wrapCBORValue(v)
+		}
+	}
+	return cbor.Marshal(m)
+}
+
+// cborFileKey is a key of the map stored in a CBOR driver file. Unlike
+// cbor.ByteString, it can be decoded from both byte strings and text strings.
+type cborFileKey string
+
+func (k *cborFileKey) UnmarshalCBOR(b []byte) error {
+	if len(b) > 0 && b[0]>>5 == cborMajorTextString {
+		var s string
+		if err := cborDecMode.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*k = cborFileKey(s)
+		return nil
+	}
+
+	var bs cbor.ByteString
+	if err := bs.UnmarshalCBOR(b); err != nil {
+		return err
+	}
+	*k = cborFileKey(bs)
+	return nil
+}
+
+// cborRawTag is the CBOR tag that wraps values that cannot be written into a
+// CBOR driver file as they are, i.e. values that are not a single well-formed
+// CBOR data item, such as those of [BytesEncoder]. The number is unassigned.
+const cborRawTag = 0x70727374
+
+// cborRawTagHead is the encoded head of cborRawTag.
+var cborRawTagHead = appendCBORHead(nil, cborMajorTag, cborRawTag)
+
+// wrapCBORValue returns v in the form that it is written into a CBOR driver
+// file. Values that are not well-formed CBOR are wrapped in a byte string
+// tagged with cborRawTag, as are values that already carry the tag so that
+// they are not mistaken for wrapped ones.
+func wrapCBORValue(v []byte) []byte {
+	if !bytes.HasPrefix(v, cborRawTagHead) && cbor.Wellformed(v) == nil {
+		return v
+	}
+	b := make([]byte, 0, len(cborRawTagHead)+9+len(v))
+	b = append(b, cborRawTagHead...)
+	b = appendCBORHead(b, cborMajorByteString, uint64(len(v)))
+	return append(b, v...)
+}
+
+// unwrapCBORValue reverses wrapCBORValue.
+func unwrapCBORValue(v []byte) ([]byte, error) {
+	b, ok := bytes.CutPrefix(v, cborRawTagHead)
+	if !ok {
+		return v, nil
+	}
+	major, n, indefinite, hlen, err := readCBORHead(b)
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMajorByteString || indefinite || n != uint64(len(b)-hlen) {
+		return nil, errors.New("malformed raw value")
+	}
+	return b[hlen:], nil
+}
+
+// writeFileAtomic writes b into a temporary file next to path and renames it
+// over path, so path is never observed partially written.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("persist: create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return fmt.Errorf("persist: write temp file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("persist: sync temp file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("persist: close temp file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("persist: rename temp file: %w", err)
 	}
 
 	return nil
@@ -82,7 +761,12 @@ func (d *cborDriver) Get(k []byte) ([]byte, bool, error) {
 }
 
 func (d *cborDriver) Each(f func(k, v []byte) error) error {
-	for k, v := range d.m {
+	for _, k := range d.sortedKeys() {
+		v, ok := d.m[k]
+		if !ok {
+			// Deleted by f within a read-write transaction.
+			continue
+		}
 		if err := f([]byte(k), v); err != nil {
 			return err
 		}
@@ -91,7 +775,10 @@ func (d *cborDriver) Each(f func(k, v []byte) error) error {
 }
 
 func (d *cborDriver) EachKey(f func(k []byte) error) error {
-	for k := range d.m {
+	for _, k := range d.sortedKeys() {
+		if _, ok := d.m[k]; !ok {
+			continue
+		}
 		if err := f([]byte(k)); err != nil {
 			return err
 		}
@@ -99,12 +786,86 @@ func (d *cborDriver) EachKey(f func(k []byte) error) error {
 	return nil
 }
 
-func (d *cborDriver) Set(k, v []byte) error {
-	d.m[cbor.ByteString(k)] = v
+// sortedKeys returns all keys ordered using the Less option.
+func (d *cborDriver) sortedKeys() []cbor.ByteString {
+	keys := make([]cbor.ByteString, 0, len(d.m))
+	for k := range d.m {
+		keys = append(keys, k)
+	}
+
+	if d.opts.Less != nil {
+		sort.Slice(keys, func(i, j int) bool {
+			return d.opts.Less([]byte(keys[i]), []byte(keys[j]))
+		})
+	} else {
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	}
+
+	return keys
+}
+
+// cborRWTx is a read-write transaction over a cborDriver. Changes are applied
+// to the driver's map directly, but the previous state of every touched key is
+// remembered so that the transaction can be rolled back.
+type cborRWTx struct {
+	*cborDriver
+	undo []cborUndo
+}
+
+type cborUndo struct {
+	k  cbor.ByteString
+	v  cbor.RawMessage
+	ok bool
+}
+
+func (tx *cborRWTx) Set(k, v []byte) error {
+	tx.save(cbor.ByteString(k))
+	tx.m[cbor.ByteString(k)] = v
 	return nil
 }
 
-func (d *cborDriver) Delete(k []byte) error {
-	delete(d.m, cbor.ByteString(k))
+func (tx *cborRWTx) Delete(k []byte) error {
+	tx.save(cbor.ByteString(k))
+	delete(tx.m, cbor.ByteString(k))
 	return nil
 }
+
+func (tx *cborRWTx) save(k cbor.ByteString) {
+	v, ok := tx.m[k]
+	tx.undo = append(tx.undo, cborUndo{k, v, ok})
+}
+
+// changes returns the net changes made within the transaction.
+func (tx *cborRWTx) changes() []DriverChange {
+	changes := make([]DriverChange, 0, len(tx.undo))
+	seen := make(map[cbor.ByteString]struct{}, len(tx.undo))
+
+	for _, u := range tx.undo {
+		if _, ok := seen[u.k]; ok {
+			continue
+		}
+		seen[u.k] = struct{}{}
+
+		v, ok := tx.m[u.k]
+		changes = append(changes, DriverChange{
+			Key:     []byte(u.k),
+			Value:   v,
+			Deleted: !ok,
+		})
+	}
+
+	return changes
+}
+
+// rollback undoes all changes made within the transaction.
+func (tx *cborRWTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		u := tx.undo[i]
+		if u.ok {
+			tx.m[u.k] = u.v
+		} else {
+			delete(tx.m, u.k)
+		}
+	}
+	tx.undo = nil
+}
@@ -0,0 +1,465 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORMmapDriver is a driver that stores data in a CBOR file using the same
+// format as [CBORDriver], but instead of decoding the whole file into memory,
+// it memory-maps the file and only keeps an index of where each value lives.
+// Values are copied out of the mapping and decoded on demand.
+//
+// This driver is meant for large, read-mostly datasets. Every committed
+// read-write transaction still rewrites the whole file, so writes are at least
+// as expensive as they are with [CBORDriver].
+var CBORMmapDriver DriverOpenFunc = openCBORMmapDriver
+
+type cborMmapDriver struct {
+	path     string
+	mu       sync.RWMutex
+	data     []byte
+	index    map[string]cborSpan
+	watchers driverWatchers
+	closed   bool
+}
+
+// cborSpan is the location of a raw CBOR value within the mapped file.
+type cborSpan struct {
+	off int
+	len int
+}
+
+func openCBORMmapDriver(path string) (Driver, error) {
+	d := &cborMmapDriver{path: path}
+
+	if err := d.mmap(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		d.index = make(map[string]cborSpan)
+		if err := d.AcquireRW(func(DriverReadWriteTx) error { return nil }); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// mmap maps the file at d.path and rebuilds the index. The previous mapping,
+// if any, is not released.
+func (d *cborMmapDriver) mmap() error {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("persist: open file: %w", err)
+	}
+	defer f.Close()
+
+	data, err := mmapFile(f)
+	if err != nil {
+		return fmt.Errorf("persist: mmap file: %w", err)
+	}
+
+	index, err := indexCBORMap(data)
+	if err != nil {
+		munmapFile(data)
+		return fmt.Errorf("persist: index CBOR: %w", err)
+	}
+
+	d.data = data
+	d.index = index
+	return nil
+}
+
+func (d *cborMmapDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	data := d.data
+	d.data = nil
+	d.index = nil
+
+	if err := munmapFile(data); err != nil {
+		return fmt.Errorf("persist: munmap file: %w", err)
+	}
+	return nil
+}
+
+func (d *cborMmapDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		Watch:      true,
+		Persistent: true,
+	}
+}
+
+func (d *cborMmapDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	return f(&cborMmapTx{d: d})
+}
+
+func (d *cborMmapDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	tx := &cborMmapTx{
+		d:    d,
+		sets: make(map[string][]byte),
+		dels: make(map[string]struct{}),
+	}
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	if d.data != nil && len(tx.sets) == 0 && len(tx.dels) == 0 {
+		return nil
+	}
+
+	if err := d.commit(tx); err != nil {
+		return err
+	}
+
+	if d.watchers.active() {
+		d.watchers.publish(tx.changes())
+	}
+
+	return nil
+}
+
+func (d *cborMmapDriver) Watch(ctx context.Context, f func([]DriverChange)) (<-chan struct{}, error) {
+	return d.watchers.watch(ctx, f), nil
+}
+
+// commit writes the state of the database with tx applied into a new file,
+// then replaces the current file and mapping with it.
+func (d *cborMmapDriver) commit(tx *cborMmapTx) error {
+	f, err := os.CreateTemp(filepath.Dir(d.path), "."+filepath.Base(d.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("persist: create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	n := uint64(len(tx.sets))
+	for k := range tx.d.index {
+		if !tx.shadowed(k) {
+			n++
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	var head []byte
+
+	head = appendCBORHead(head[:0], cborMajorMap, n)
+	w.Write(head)
+
+	err = tx.eachFile(func(k, v []byte) error {
+		head = appendCBORHead(head[:0], cborMajorByteString, uint64(len(k)))
+		w.Write(head)
+		w.Write(k)
+		_, err := w.Write(v)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("persist: write temp file: %w", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("persist: write temp file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("persist: sync temp file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("persist: close temp file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), d.path); err != nil {
+		return fmt.Errorf("persist: rename temp file: %w", err)
+	}
+
+	old := d.data
+	if err := d.mmap(); err != nil {
+		return err
+	}
+
+	if err := munmapFile(old); err != nil {
+		return fmt.Errorf("persist: munmap file: %w", err)
+	}
+
+	return nil
+}
+
+// cborMmapTx is a transaction over a cborMmapDriver. Read-write transactions
+// buffer their changes in sets and dels until they are committed. Values in
+// sets are kept as given; they are only wrapped using wrapCBORValue once they
+// are written into the file.
+type cborMmapTx struct {
+	d    *cborMmapDriver
+	sets map[string][]byte
+	dels map[string]struct{}
+}
+
+// changes returns the changes buffered in the transaction.
+func (tx *cborMmapTx) changes() []DriverChange {
+	changes := make([]DriverChange, 0, len(tx.sets)+len(tx.dels))
+	for k, v := range tx.sets {
+		changes = append(changes, DriverChange{Key: []byte(k), Value: v})
+	}
+	for k := range tx.dels {
+		changes = append(changes, DriverChange{Key: []byte(k), Deleted: true})
+	}
+	return changes
+}
+
+func (tx *cborMmapTx) Get(k []byte) ([]byte, bool, error) {
+	if v, ok := tx.sets[string(k)]; ok {
+		return v, true, nil
+	}
+	if _, ok := tx.dels[string(k)]; ok {
+		return nil, false, nil
+	}
+	span, ok := tx.d.index[string(k)]
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := tx.d.value(span)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (tx *cborMmapTx) Each(f func(k, v []byte) error) error {
+	for k, span := range tx.d.index {
+		if tx.shadowed(k) {
+			continue
+		}
+		v, err := tx.d.value(span)
+		if err != nil {
+			return err
+		}
+		if err := f([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	for k, v := range tx.sets {
+		if err := f([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *cborMmapTx) EachKey(f func(k []byte) error) error {
+	return tx.eachFile(func(k, _ []byte) error { return f(k) })
+}
+
+// eachFile calls f with every key and its value in the form that it is
+// written into the file. Values from the mapping are passed without copying
+// them, so they must not be retained.
+func (tx *cborMmapTx) eachFile(f func(k, v []byte) error) error {
+	for k, span := range tx.d.index {
+		if tx.shadowed(k) {
+			continue
+		}
+		if err := f([]byte(k), tx.d.data[span.off:span.off+span.len]); err != nil {
+			return err
+		}
+	}
+	for k, v := range tx.sets {
+		if err := f([]byte(k), wrapCBORValue(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shadowed reports whether the mapped value of k is replaced or deleted within
+// the transaction.
+func (tx *cborMmapTx) shadowed(k string) bool {
+	if _, ok := tx.sets[k]; ok {
+		return true
+	}
+	_, ok := tx.dels[k]
+	return ok
+}
+
+// value returns a copy of the value at span in the mapping. The mapping is
+// replaced on every commit, so values must not alias it.
+func (d *cborMmapDriver) value(span cborSpan) ([]byte, error) {
+	v, err := unwrapCBORValue(d.data[span.off : span.off+span.len])
+	if err != nil {
+		return nil, fmt.Errorf("persist: decode CBOR: %w", err)
+	}
+	return bytes.Clone(v), nil
+}
+
+func (tx *cborMmapTx) Set(k, v []byte) error {
+	delete(tx.dels, string(k))
+	tx.sets[string(k)] = append([]byte(nil), v...)
+	return nil
+}
+
+func (tx *cborMmapTx) Delete(k []byte) error {
+	delete(tx.sets, string(k))
+	tx.dels[string(k)] = struct{}{}
+	return nil
+}
+
+const (
+	cborMajorByteString = 2
+	cborMajorTextString = 3
+	cborMajorMap        = 5
+	cborMajorTag        = 6
+)
+
+// cborIndefinite is the additional information value for indefinite-length
+// items.
+const cborIndefinite = 31
+
+// indexCBORMap walks a CBOR map of byte string keys and returns where each
+// value lives in data. Values are checked for well-formedness but are not
+// decoded.
+func indexCBORMap(data []byte) (map[string]cborSpan, error) {
+	major, n, indefinite, hlen, err := readCBORHead(data)
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMajorMap {
+		return nil, fmt.Errorf("expected map, got major type %d", major)
+	}
+
+	index := make(map[string]cborSpan)
+	off := hlen
+
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite {
+			if off >= len(data) {
+				return nil, errors.New("unexpected EOF")
+			}
+			if data[off] == 0xFF {
+				off++
+				break
+			}
+		}
+
+		major, klen, kindefinite, hlen, err := readCBORHead(data[off:])
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if major != cborMajorByteString && major != cborMajorTextString || kindefinite {
+			return nil, fmt.Errorf("key %d: expected definite string, got major type %d", i, major)
+		}
+		off += hlen
+		if uint64(len(data)-off) < klen {
+			return nil, fmt.Errorf("key %d: unexpected EOF", i)
+		}
+		k := string(data[off : off+int(klen)])
+		off += int(klen)
+
+		rest, err := cbor.UnmarshalFirst(data[off:], &cborSkip{})
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %w", i, err)
+		}
+		vlen := len(data) - off - len(rest)
+
+		index[k] = cborSpan{off: off, len: vlen}
+		off += vlen
+	}
+
+	if off != len(data) {
+		return nil, errors.New("trailing data after map")
+	}
+
+	return index, nil
+}
+
+// readCBORHead reads the head of a CBOR data item. It returns the major type,
+// the argument, whether the item is indefinite-length and the length of the
+// head.
+func readCBORHead(b []byte) (major byte, arg uint64, indefinite bool, n int, err error) {
+	if len(b) == 0 {
+		return 0, 0, false, 0, errors.New("unexpected EOF")
+	}
+
+	major = b[0] >> 5
+	ai := b[0] & 0x1F
+
+	switch {
+	case ai < 24:
+		return major, uint64(ai), false, 1, nil
+	case ai == cborIndefinite:
+		return major, 0, true, 1, nil
+	case ai > 27:
+		return 0, 0, false, 0, fmt.Errorf("invalid additional information %d", ai)
+	}
+
+	size := 1 << (ai - 24)
+	if len(b) < 1+size {
+		return 0, 0, false, 0, errors.New("unexpected EOF")
+	}
+
+	switch size {
+	case 1:
+		arg = uint64(b[1])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(b[1:]))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(b[1:]))
+	case 8:
+		arg = binary.BigEndian.Uint64(b[1:])
+	}
+
+	return major, arg, false, 1 + size, nil
+}
+
+// appendCBORHead appends the head of a definite-length CBOR data item.
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= 0xFF:
+		return append(b, major|24, byte(arg))
+	case arg <= 0xFFFF:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(arg))
+	case arg <= 0xFFFFFFFF:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), arg)
+	}
+}
+
+// cborSkip is a cbor.Unmarshaler that discards its input. It is used to
+// find the end of a data item without decoding it.
+type cborSkip struct{}
+
+func (cborSkip) UnmarshalCBOR([]byte) error { return nil }
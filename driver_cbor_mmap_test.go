@@ -0,0 +1,146 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestCBORMmapDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	// Write using the regular CBOR driver first to ensure both drivers
+	// share the same format.
+	m, err := NewMap[string, testStruct](CBORDriver, path)
+	assert.NoError(t, err, "NewMap CBORDriver")
+
+	err = m.Store("key1", testStruct{Data: "data", Int: 42})
+	assert.NoError(t, err, "Store 1")
+
+	err = m.Close()
+	assert.NoError(t, err, "Close CBORDriver")
+
+	m, err = NewMap[string, testStruct](CBORMmapDriver, path)
+	assert.NoError(t, err, "NewMap CBORMmapDriver")
+	defer m.Close()
+
+	v, ok, err := m.Load("key1")
+	assert.NoError(t, err, "Load 1")
+	assert.True(t, ok, "Load 1")
+	assert.Equal(t, testStruct{Data: "data", Int: 42}, v, "Load 1")
+
+	err = m.Store("key2", testStruct{Int: 1})
+	assert.NoError(t, err, "Store 2")
+
+	v, ok, err = m.Load("key2")
+	assert.NoError(t, err, "Load 2")
+	assert.True(t, ok, "Load 2")
+	assert.Equal(t, testStruct{Int: 1}, v, "Load 2")
+
+	assertCBORFile(t, path, map[cbor.ByteString]testStruct{
+		cborKey("key1"): {Data: "data", Int: 42},
+		cborKey("key2"): {Int: 1},
+	})
+
+	_, _, err = m.LoadAndDelete("key1")
+	assert.NoError(t, err, "LoadAndDelete")
+
+	_, ok, err = m.Load("key1")
+	assert.NoError(t, err, "Load deleted")
+	assert.False(t, ok, "Load deleted")
+
+	assertCBORFile(t, path, map[cbor.ByteString]testStruct{
+		cborKey("key2"): {Int: 1},
+	})
+}
+
+func TestCBORMmapDriverNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	d, err := CBORMmapDriver(path)
+	assert.NoError(t, err, "CBORMmapDriver")
+	defer d.Close()
+
+	assertCBORFile(t, path, map[cbor.ByteString]testStruct{})
+}
+
+func TestCBORMmapDriverClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORMmapDriver, path)
+	assert.NoError(t, err, "NewMap")
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	assert.NoError(t, m.Close(), "Close")
+	assert.NoError(t, m.Close(), "Close again")
+
+	err = m.Store("c", 3)
+	assert.IsError(t, err, ErrClosed, "Store after Close")
+
+	_, _, err = m.Load("a")
+	assert.IsError(t, err, ErrClosed, "Load after Close")
+
+	assertCBORFile(t, path, map[cbor.ByteString]int{
+		cborKey("a"): 1,
+		cborKey("b"): 2,
+	})
+}
+
+func TestCBORMmapDriverRawValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	values := map[string][]byte{
+		"empty":   {},
+		"invalid": {0xFF, 0x01},
+		"tagged":  append(append([]byte(nil), cborRawTagHead...), 0x40),
+		"cbor":    {0x01},
+	}
+
+	d, err := CBORMmapDriver(path)
+	assert.NoError(t, err, "CBORMmapDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, []byte]{
+		Key:   StringEncoder[string](),
+		Value: BytesEncoder[[]byte](),
+	})
+
+	for k, v := range values {
+		assert.NoError(t, m.Store(k, v), "Store "+k)
+	}
+
+	var got []byte
+	err = d.AcquireRO(func(tx DriverReadOnlyTx) error {
+		got, _, err = tx.Get([]byte("invalid"))
+		return err
+	})
+	assert.NoError(t, err, "Get invalid")
+
+	// Commit again so that the mapping is replaced.
+	assert.NoError(t, m.Store("other", []byte("x")), "Store other")
+	assert.Equal(t, []byte{0xFF, 0x01}, got, "Get invalid after remap")
+
+	assert.NoError(t, m.Close(), "Close")
+
+	for _, open := range []DriverOpenFunc{CBORMmapDriver, CBORDriver} {
+		d, err := open(path)
+		assert.NoError(t, err, "reopen")
+
+		m := NewMapFromEncoders(d, EncoderPair[string, []byte]{
+			Key:   StringEncoder[string](),
+			Value: BytesEncoder[[]byte](),
+		})
+
+		for k, v := range values {
+			got, ok, err := m.Load(k)
+			assert.NoError(t, err, "Load "+k)
+			assert.True(t, ok, "Load "+k)
+			assert.Equal(t, v, got, "Load "+k)
+		}
+
+		assert.NoError(t, m.Close(), "Close")
+	}
+}
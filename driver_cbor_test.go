@@ -1,9 +1,12 @@
 package persist
 
 import (
+	"bytes"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/fxamacker/cbor/v2"
@@ -84,3 +87,389 @@ func assertCBORFile[T any](t *testing.T, path string, v T) {
 	assert.NoError(t, err, "Unmarshal")
 	assert.Equal(t, v, m, "Unmarshal")
 }
+
+func TestCBORDriverSaveAs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.cbor")
+	copyPath := filepath.Join(dir, "copy.cbor")
+
+	m, err := NewMap[string, testStruct](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	err = m.Store("key1", testStruct{Data: "data", Int: 42})
+	assert.NoError(t, err, "Store")
+
+	err = m.SaveAs(copyPath)
+	assert.NoError(t, err, "SaveAs")
+
+	err = m.Store("key2", testStruct{Int: 1})
+	assert.NoError(t, err, "Store after SaveAs")
+
+	assertCBORFile(t, copyPath, map[cbor.ByteString]testStruct{
+		cborKey("key1"): {Data: "data", Int: 42},
+	})
+
+	assertCBORFile(t, path, map[cbor.ByteString]testStruct{
+		cborKey("key1"): {Data: "data", Int: 42},
+		cborKey("key2"): {Int: 1},
+	})
+}
+
+func TestCBORDriverTextKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	encs := EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	}
+
+	d, err := CBORDriverWith(CBORDriverOptions{TextKeys: true})(path)
+	assert.NoError(t, err, "CBORDriverWith")
+
+	m := NewMapFromEncoders(d, encs)
+
+	err = m.Store("text", 1)
+	assert.NoError(t, err, "Store text")
+
+	err = m.Store("\xff\xfe", 2)
+	assert.NoError(t, err, "Store bytes")
+
+	err = m.Close()
+	assert.NoError(t, err, "Close")
+
+	assertCBORFile(t, path, map[any]int{
+		"text":                      1,
+		cbor.ByteString("\xff\xfe"): 2,
+	})
+
+	// Both kinds of keys must be readable with and without the option.
+	for _, open := range []DriverOpenFunc{
+		CBORDriverWith(CBORDriverOptions{TextKeys: true}),
+		CBORDriver,
+	} {
+		d, err := open(path)
+		assert.NoError(t, err, "reopen")
+
+		m := NewMapFromEncoders(d, encs)
+
+		v, err := m.Get("text")
+		assert.NoError(t, err, "Get text")
+		assert.Equal(t, 1, v, "Get text")
+
+		v, err = m.Get("\xff\xfe")
+		assert.NoError(t, err, "Get bytes")
+		assert.Equal(t, 2, v, "Get bytes")
+
+		err = m.Close()
+		assert.NoError(t, err, "Close")
+	}
+}
+
+func TestCBORDriverJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+	journalPath := path + ".journal"
+
+	open := CBORDriverWith(CBORDriverOptions{Journal: true})
+	encs := EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	}
+
+	d, err := open(path)
+	assert.NoError(t, err, "open 1")
+	m := NewMapFromEncoders(d, encs)
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+	assert.NoError(t, m.Delete("a"), "Delete a")
+
+	// Writes only go to the journal.
+	assertCBORFile(t, path, map[cbor.ByteString]int{})
+
+	journal, err := os.ReadFile(journalPath)
+	assert.NoError(t, err, "read journal")
+	assert.NotEqual(t, 0, len(journal), "journal size")
+
+	assert.NoError(t, m.Close(), "Close 1")
+
+	// Simulate a crash in the middle of appending a transaction that stores a
+	// again.
+	partial, err := cbor.Marshal([]cborJournalOp{{Key: "a", Value: cbor.RawMessage{0x01}}})
+	assert.NoError(t, err, "marshal journal op")
+
+	err = os.WriteFile(journalPath, append(journal, partial[:len(partial)-1]...), 0666)
+	assert.NoError(t, err, "write partial journal")
+
+	d, err = open(path)
+	assert.NoError(t, err, "open 2")
+	m = NewMapFromEncoders(d, encs)
+
+	_, err = m.Get("a")
+	assert.IsError(t, err, ErrNotFound, "Get a")
+
+	v, err := m.Get("b")
+	assert.NoError(t, err, "Get b")
+	assert.Equal(t, 2, v, "Get b")
+
+	// The journal is compacted on open.
+	assertCBORFile(t, path, map[cbor.ByteString]int{"b": 2})
+	assertFileSize(t, journalPath, 0)
+
+	assert.NoError(t, m.Store("c", 3), "Store c")
+	assert.NoError(t, m.Compact(), "Compact")
+
+	assertCBORFile(t, path, map[cbor.ByteString]int{"b": 2, "c": 3})
+	assertFileSize(t, journalPath, 0)
+
+	assert.NoError(t, m.Store("d", 4), "Store d")
+	assert.NoError(t, m.Close(), "Close 2")
+
+	// A leftover journal is replayed even without the option.
+	d, err = CBORDriver(path)
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	_, err = os.Stat(journalPath)
+	assert.True(t, os.IsNotExist(err), "journal removed")
+	assertCBORFile(t, path, map[cbor.ByteString]int{"b": 2, "c": 3, "d": 4})
+}
+
+func assertFileSize(t *testing.T, path string, size int64) {
+	t.Helper()
+
+	s, err := os.Stat(path)
+	assert.NoError(t, err, "Stat")
+	assert.Equal(t, size, s.Size(), "file size")
+}
+
+func TestCBORDriverClose(t *testing.T) {
+	for _, journal := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "test.cbor")
+
+		d, err := CBORDriverWith(CBORDriverOptions{Journal: journal})(path)
+		assert.NoError(t, err, "open")
+
+		m := NewMapFromEncoders(d, EncoderPair[string, int]{
+			Key:   StringEncoder[string](),
+			Value: CBOREncoder[int](),
+		})
+
+		assert.NoError(t, m.Store("a", 1), "Store")
+		assert.NoError(t, m.Close(), "Close")
+		assert.NoError(t, m.Close(), "Close again")
+
+		err = m.Store("b", 2)
+		assert.IsError(t, err, ErrClosed, "Store after Close")
+
+		_, _, err = m.Load("a")
+		assert.IsError(t, err, ErrClosed, "Load after Close")
+
+		d, err = CBORDriver(path)
+		assert.NoError(t, err, "reopen")
+		assertCBORFile(t, path, map[cbor.ByteString]int{"a": 1})
+		assert.NoError(t, d.Close(), "Close reopened")
+	}
+}
+
+func TestCBORDriverKeepOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	d, err := CBORDriverWith(CBORDriverOptions{KeepOpen: true})(path)
+	assert.NoError(t, err, "open")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, string]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[string](),
+	})
+
+	assert.NoError(t, m.Store("a", "a long value that is shrunk later"), "Store a")
+	assert.NoError(t, m.Store("b", "b"), "Store b")
+	assert.NoError(t, m.Store("a", "a"), "Store a again")
+	assertCBORFile(t, path, map[cbor.ByteString]string{"a": "a", "b": "b"})
+
+	// Compact replaces the file, which must then be reopened.
+	assert.NoError(t, m.Compact(), "Compact")
+	assert.NoError(t, m.Delete("b"), "Delete b")
+	assertCBORFile(t, path, map[cbor.ByteString]string{"a": "a"})
+
+	assert.NoError(t, m.Close(), "Close")
+	assertCBORFile(t, path, map[cbor.ByteString]string{"a": "a"})
+}
+
+func TestCBORDriverAutoFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	d, err := CBORDriverWithAutoFlush(time.Hour)(path)
+	assert.NoError(t, err, "open")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	})
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assertCBORFile(t, path, map[cbor.ByteString]int{})
+
+	assert.NoError(t, m.Sync(), "Sync")
+	assertCBORFile(t, path, map[cbor.ByteString]int{"a": 1})
+
+	assert.NoError(t, m.Store("b", 2), "Store b")
+	assert.NoError(t, m.Close(), "Close")
+	assertCBORFile(t, path, map[cbor.ByteString]int{"a": 1, "b": 2})
+
+	d, err = CBORDriverWithAutoFlush(time.Millisecond)(path)
+	assert.NoError(t, err, "reopen")
+	defer d.Close()
+
+	m = NewMapFromEncoders(d, m.Encoder())
+	assert.NoError(t, m.Delete("a"), "Delete a")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// The file may be read while it is being rewritten, in which case
+		// it cannot be decoded yet.
+		var got map[cbor.ByteString]int
+		b, err := os.ReadFile(path)
+		assert.NoError(t, err, "ReadFile")
+		if cbor.Unmarshal(b, &got) == nil && len(got) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("change was not flushed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOpenCBORFromFS(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewMap[string, int](CBORDriver, filepath.Join(dir, "seed.cbor"))
+	assert.NoError(t, err, "NewMap")
+	assert.NoError(t, m.Store("a", 1), "Store")
+	assert.NoError(t, m.Close(), "Close")
+
+	d, err := OpenCBORFromFS(os.DirFS(dir), "seed.cbor")
+	assert.NoError(t, err, "OpenCBORFromFS")
+	defer d.Close()
+
+	m = NewMapFromEncoders(d, m.Encoder())
+
+	v, ok, err := m.Load("a")
+	assert.NoError(t, err, "Load")
+	assert.True(t, ok, "Load")
+	assert.Equal(t, 1, v, "Load")
+
+	assert.IsError(t, m.Store("b", 2), ErrReadOnly, "Store")
+	assert.IsError(t, m.Compact(), ErrReadOnly, "Compact")
+
+	_, err = OpenCBORFromFS(os.DirFS(dir), "missing.cbor")
+	assert.IsError(t, err, fs.ErrNotExist, "OpenCBORFromFS missing")
+}
+
+func TestCBORDriverExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cbor")
+
+	_, err := CBORDriverExisting(path)
+	assert.IsError(t, err, ErrNotFound, "CBORDriverExisting before CBORDriver")
+	_, err = os.Stat(path)
+	assert.IsError(t, err, fs.ErrNotExist, "file created")
+
+	d, err := CBORDriver(path)
+	assert.NoError(t, err, "CBORDriver")
+	assert.NoError(t, d.Close(), "Close")
+
+	d, err = CBORDriverExisting(path)
+	assert.NoError(t, err, "CBORDriverExisting after CBORDriver")
+	assert.NoError(t, d.Close(), "Close")
+}
+
+func TestCBORDriverFirstEmptyKey(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	m := NewMapFromEncoders(d, EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	})
+
+	assert.NoError(t, m.Store("b", 2), "Store b")
+	assert.NoError(t, m.Store("", 1), "Store empty")
+
+	k, v, ok, err := m.First()
+	assert.NoError(t, err, "First")
+	assert.True(t, ok, "First")
+	assert.Equal(t, "", k, "First key")
+	assert.Equal(t, 1, v, "First value")
+
+	k, _, ok, err = m.Last()
+	assert.NoError(t, err, "Last")
+	assert.True(t, ok, "Last")
+	assert.Equal(t, "b", k, "Last key")
+}
+
+func TestCBORDriverLess(t *testing.T) {
+	encs := EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	}
+
+	keys := func(d Driver) []string {
+		var keys []string
+		NewMapFromEncoders(d, encs).Keys()(func(k string) bool {
+			keys = append(keys, k)
+			return true
+		})
+		return keys
+	}
+
+	store := func(d Driver) {
+		m := NewMapFromEncoders(d, encs)
+		for i, k := range []string{"b", "ccc", "a", "dd"} {
+			assert.NoError(t, m.Store(k, i), "Store")
+		}
+	}
+
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	store(d)
+	assert.Equal(t, []string{"a", "b", "ccc", "dd"}, keys(d), "default order")
+	assert.True(t, Capabilities(d).Ordered, "default Ordered")
+	assert.True(t, NewMapFromEncoders(d, encs).IsOrdered(), "default IsOrdered")
+
+	byLength := func(a, b []byte) bool {
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	}
+
+	d, err = CBORDriverWith(CBORDriverOptions{Less: byLength})(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriverWith")
+	defer d.Close()
+
+	store(d)
+	assert.Equal(t, []string{"a", "b", "dd", "ccc"}, keys(d), "custom order")
+	assert.False(t, Capabilities(d).Ordered, "custom Ordered")
+
+	m := NewMapFromEncoders(d, encs)
+	assert.False(t, m.IsOrdered(), "custom IsOrdered")
+
+	// "aaa" is visited after "b", so First must not stop early.
+	assert.NoError(t, m.Delete("a"), "Delete a")
+	assert.NoError(t, m.Store("aaa", 0), "Store aaa")
+
+	k, _, ok, err := m.First()
+	assert.NoError(t, err, "First")
+	assert.True(t, ok, "First")
+	assert.Equal(t, "aaa", k, "First key")
+
+	k, _, ok, err = m.Last()
+	assert.NoError(t, err, "Last")
+	assert.True(t, ok, "Last")
+	assert.Equal(t, "dd", k, "Last key")
+}
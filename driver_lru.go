@@ -0,0 +1,208 @@
+package persist
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// LRUMemoryDriver returns a function that opens an in-memory driver holding at
+// most maxEntries keys. Once a read-write transaction leaves more keys than
+// that, the least recently used ones are evicted when it commits. Keys count as
+// used when they are written or read using Get, but not when they are visited
+// by Each or EachKey. This makes it a cache with the same API as any other
+// driver.
+//
+// The driver can only be opened with the ":memory:" path, and nothing is kept
+// once it is closed. Each and EachKey visit keys in ascending byte order.
+// Transactions are serialized, including read-only ones, since reading a key
+// updates its recency. It panics if maxEntries is not positive.
+func LRUMemoryDriver(maxEntries int) DriverOpenFunc {
+	if maxEntries <= 0 {
+		panic("persist: non-positive capacity for LRUMemoryDriver")
+	}
+	return func(path string) (Driver, error) {
+		if path != ":memory:" {
+			return nil, errors.New("persist: LRUMemoryDriver only supports the :memory: path")
+		}
+		return &lruDriver{
+			max:   maxEntries,
+			m:     make(map[string]*list.Element),
+			order: list.New(),
+		}, nil
+	}
+}
+
+type lruDriver struct {
+	mu  sync.Mutex
+	max int
+	m   map[string]*list.Element
+	// order holds the entries from the most recently used to the least
+	// recently used.
+	order  *list.List
+	closed bool
+}
+
+type lruEntry struct {
+	k string
+	v []byte
+}
+
+var _ DriverWithCapabilities = (*lruDriver)(nil)
+
+func (d *lruDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	d.m = nil
+	d.order = nil
+	return nil
+}
+
+func (d *lruDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{Ordered: true}
+}
+
+func (d *lruDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	return f(d)
+}
+
+func (d *lruDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	tx := &lruRWTx{lruDriver: d}
+
+	if err := f(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	for len(d.m) > d.max {
+		d.remove(d.order.Back().Value.(*lruEntry).k)
+	}
+
+	return nil
+}
+
+func (d *lruDriver) Get(k []byte) ([]byte, bool, error) {
+	e, ok := d.m[string(k)]
+	if !ok {
+		return nil, false, nil
+	}
+	d.order.MoveToFront(e)
+	return e.Value.(*lruEntry).v, true, nil
+}
+
+func (d *lruDriver) Each(f func(k, v []byte) error) error {
+	for _, k := range d.sortedKeys() {
+		e, ok := d.m[k]
+		if !ok {
+			// Deleted by f within a read-write transaction.
+			continue
+		}
+		if err := f([]byte(k), e.Value.(*lruEntry).v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *lruDriver) EachKey(f func(k []byte) error) error {
+	for _, k := range d.sortedKeys() {
+		if _, ok := d.m[k]; !ok {
+			continue
+		}
+		if err := f([]byte(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *lruDriver) sortedKeys() []string {
+	keys := make([]string, 0, len(d.m))
+	for k := range d.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// set sets k to v and marks it as the most recently used.
+func (d *lruDriver) set(k string, v []byte) {
+	if e, ok := d.m[k]; ok {
+		e.Value.(*lruEntry).v = v
+		d.order.MoveToFront(e)
+		return
+	}
+	d.m[k] = d.order.PushFront(&lruEntry{k, v})
+}
+
+func (d *lruDriver) remove(k string) {
+	if e, ok := d.m[k]; ok {
+		d.order.Remove(e)
+		delete(d.m, k)
+	}
+}
+
+type lruRWTx struct {
+	*lruDriver
+	undo []lruUndo
+}
+
+type lruUndo struct {
+	k  string
+	v  []byte
+	ok bool
+}
+
+func (tx *lruRWTx) Set(k, v []byte) error {
+	tx.save(string(k))
+	tx.set(string(k), bytes.Clone(v))
+	return nil
+}
+
+func (tx *lruRWTx) Delete(k []byte) error {
+	tx.save(string(k))
+	tx.remove(string(k))
+	return nil
+}
+
+func (tx *lruRWTx) save(k string) {
+	var u lruUndo
+	if e, ok := tx.m[k]; ok {
+		u = lruUndo{k, e.Value.(*lruEntry).v, true}
+	} else {
+		u = lruUndo{k: k}
+	}
+	tx.undo = append(tx.undo, u)
+}
+
+// rollback undoes all changes made within the transaction. Changes in recency
+// are kept.
+func (tx *lruRWTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		u := tx.undo[i]
+		if u.ok {
+			tx.set(u.k, u.v)
+		} else {
+			tx.remove(u.k)
+		}
+	}
+	tx.undo = nil
+}
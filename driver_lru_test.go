@@ -0,0 +1,50 @@
+package persist
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestLRUMemoryDriver(t *testing.T) {
+	_, err := LRUMemoryDriver(2)("test.db")
+	assert.Error(t, err, "LRUMemoryDriver with a path")
+
+	m, err := NewMap[string, int](LRUMemoryDriver(2), ":memory:")
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	// Reading a makes b the least recently used.
+	_, err = m.Get("a")
+	assert.NoError(t, err, "Get a")
+
+	assert.NoError(t, m.Store("c", 3), "Store c")
+
+	var keys []string
+	m.Keys()(func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []string{"a", "c"}, keys, "keys after eviction")
+
+	// A rolled back transaction neither writes nor evicts anything.
+	errRollback := errors.New("rollback")
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		assert.NoError(t, tx.Set([]byte("d"), nil), "Set d")
+		assert.NoError(t, tx.Set([]byte("e"), nil), "Set e")
+		return errRollback
+	})
+	assert.IsError(t, err, errRollback, "AcquireRW")
+
+	ok, err := m.Contains("a")
+	assert.NoError(t, err, "Contains a")
+	assert.True(t, ok, "Contains a")
+
+	ok, err = m.Contains("d")
+	assert.NoError(t, err, "Contains d")
+	assert.False(t, ok, "Contains d")
+}
@@ -0,0 +1,893 @@
+package persist_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/persist"
+	"libdb.so/persist/driver/badgerdb"
+	"libdb.so/persist/driver/fsdir"
+)
+
+// testDrivers lists all bundled drivers.
+var testDrivers = []struct {
+	name string
+	open persist.DriverOpenFunc
+	// memory is true if the driver supports the ":memory:" path.
+	memory bool
+}{
+	{"cbor", persist.CBORDriver, false},
+	{"cbor-mmap", persist.CBORMmapDriver, false},
+	{"badgerdb", badgerdb.Open, true},
+	{"fsdir", fsdir.Open, false},
+	{"fsdir-memory", fsdir.Open, true},
+	{"lru-memory", persist.LRUMemoryDriver(1 << 20), true},
+}
+
+// eachDriver runs f as a subtest for each bundled driver, each with a freshly
+// opened database.
+func eachDriver(t *testing.T, f func(t *testing.T, d persist.Driver)) {
+	for _, test := range testDrivers {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			path := ":memory:"
+			if !test.memory {
+				path = filepath.Join(t.TempDir(), "db")
+			}
+
+			d, err := test.open(path)
+			assert.NoError(t, err, "open driver")
+			t.Cleanup(func() { d.Close() })
+
+			f(t, d)
+		})
+	}
+}
+
+var intEncoder = persist.CBOREncoder[int]()
+
+func TestDriverIsolation(t *testing.T) {
+	const (
+		writers = 4
+		readers = 4
+		writes  = 25
+	)
+
+	keyA := []byte("a")
+	keyB := []byte("b")
+
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		errs := make(chan error, writers+readers)
+
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < writes; j++ {
+					err := d.AcquireRW(func(tx persist.DriverReadWriteTx) error {
+						v, _, err := tx.Get(keyA)
+						if err != nil {
+							return err
+						}
+						var n int
+						if v != nil {
+							n, err = intEncoder.Decode(v)
+							if err != nil {
+								return err
+							}
+						}
+						b, err := intEncoder.Encode(n+1, nil)
+						if err != nil {
+							return err
+						}
+						// Write a and b separately. Readers must never see
+						// them differ.
+						if err := tx.Set(keyA, b); err != nil {
+							return err
+						}
+						return tx.Set(keyB, b)
+					})
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		var rwg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			rwg.Add(1)
+			go func() {
+				defer rwg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					err := d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+						a, _, err := tx.Get(keyA)
+						if err != nil {
+							return err
+						}
+						b, _, err := tx.Get(keyB)
+						if err != nil {
+							return err
+						}
+						if string(a) != string(b) {
+							return errors.New("read inconsistent state")
+						}
+						return nil
+					})
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(done)
+		rwg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		err := d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+			v, _, err := tx.Get(keyA)
+			if err != nil {
+				return err
+			}
+			n, err := intEncoder.Decode(v)
+			assert.Equal(t, writers*writes, n, "lost updates")
+			return err
+		})
+		assert.NoError(t, err, "AcquireRO")
+	})
+}
+
+func TestDriverRollback(t *testing.T) {
+	errRollback := errors.New("rollback")
+	v1, _ := intEncoder.Encode(1, nil)
+	v2, _ := intEncoder.Encode(2, nil)
+
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		err := d.AcquireRW(func(tx persist.DriverReadWriteTx) error {
+			return tx.Set([]byte("a"), v1)
+		})
+		assert.NoError(t, err, "AcquireRW")
+
+		err = d.AcquireRW(func(tx persist.DriverReadWriteTx) error {
+			if err := tx.Set([]byte("a"), v2); err != nil {
+				return err
+			}
+			if err := tx.Set([]byte("b"), v2); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		assert.IsError(t, err, errRollback, "AcquireRW")
+
+		err = d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+			v, ok, err := tx.Get([]byte("a"))
+			assert.True(t, ok, "a must still exist")
+			assert.Equal(t, v1, v, "a must be rolled back")
+
+			_, ok, _ = tx.Get([]byte("b"))
+			assert.False(t, ok, "b must be rolled back")
+			return err
+		})
+		assert.NoError(t, err, "AcquireRO")
+	})
+}
+
+func TestMapDeletePrefix(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		for _, k := range []string{"tenant/1/a", "tenant/1/b", "tenant/2/a", "other"} {
+			err := m.Store(k, 1)
+			assert.NoError(t, err, "Store %q", k)
+		}
+
+		n, err := m.DeletePrefix("tenant/1/")
+		assert.NoError(t, err, "DeletePrefix")
+		assert.Equal(t, 2, n, "DeletePrefix count")
+
+		for k, expect := range map[string]bool{
+			"tenant/1/a": false,
+			"tenant/1/b": false,
+			"tenant/2/a": true,
+			"other":      true,
+		} {
+			_, ok, err := m.Load(k)
+			assert.NoError(t, err, "Load %q", k)
+			assert.Equal(t, expect, ok, "Load %q", k)
+		}
+	})
+}
+
+func TestIndexedMapNamed(t *testing.T) {
+	type item struct {
+		Color string
+		Size  int
+	}
+
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, item]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[item](),
+		})
+
+		byColor, err := persist.NewNamedIndexedMap(m, "color", func(v item) string { return v.Color })
+		assert.NoError(t, err, "NewNamedIndexedMap color")
+
+		bySize, err := persist.NewNamedIndexedMap(m, "size", func(v item) int { return v.Size })
+		assert.NoError(t, err, "NewNamedIndexedMap size")
+
+		assert.NoError(t, byColor.Store("a", item{"red", 1}), "Store a")
+		assert.NoError(t, bySize.Store("b", item{"red", 2}), "Store b")
+
+		// Rebuilding one index leaves the other alone.
+		assert.NoError(t, byColor.Reindex(), "Reindex color")
+
+		vs, err := bySize.LookupByIndex(2)
+		assert.NoError(t, err, "LookupByIndex 2")
+		assert.Equal(t, []item{{"red", 2}}, vs, "LookupByIndex 2")
+
+		vs, err = byColor.LookupByIndex("red")
+		assert.NoError(t, err, "LookupByIndex red")
+		assert.Equal(t, 2, len(vs), "LookupByIndex red")
+
+		// Changing a value behind the index's back leaves a stale entry,
+		// which is skipped.
+		assert.NoError(t, m.Store("a", item{"blue", 1}), "Store a directly")
+
+		vs, err = byColor.LookupByIndex("red")
+		assert.NoError(t, err, "LookupByIndex red after Store")
+		assert.Equal(t, []item{{"red", 2}}, vs, "LookupByIndex red after Store")
+	})
+}
+
+func TestMapDeleteWhere(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		for i, k := range []string{"a", "b", "c", "d"} {
+			err := m.Store(k, i)
+			assert.NoError(t, err, "Store %q", k)
+		}
+
+		n, err := m.DeleteWhere(func(_ string, v int) bool { return v%2 == 0 })
+		assert.NoError(t, err, "DeleteWhere")
+		assert.Equal(t, 2, n, "DeleteWhere count")
+
+		for k, expect := range map[string]bool{
+			"a": false,
+			"b": true,
+			"c": false,
+			"d": true,
+		} {
+			_, ok, err := m.Load(k)
+			assert.NoError(t, err, "Load %q", k)
+			assert.Equal(t, expect, ok, "Load %q", k)
+		}
+	})
+}
+
+func TestMapRemapKeys(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		for i, k := range []string{"v1:a", "v1:b", "v2:a", "other"} {
+			err := m.Store(k, i)
+			assert.NoError(t, err, "Store %q", k)
+		}
+
+		toV2 := func(k string) (string, bool) {
+			rest, ok := strings.CutPrefix(k, "v1:")
+			return "v2:" + rest, ok
+		}
+
+		_, err := m.RemapKeys(toV2)
+		assert.IsError(t, err, persist.ErrKeyExists, "RemapKeys onto v2:a")
+
+		// Shift v2:a out of the way within the same remap.
+		n, err := m.RemapKeys(func(k string) (string, bool) {
+			if k == "v2:a" {
+				return "v3:a", true
+			}
+			return toV2(k)
+		})
+		assert.NoError(t, err, "RemapKeys")
+		assert.Equal(t, 3, n, "RemapKeys count")
+
+		for k, expect := range map[string]int{
+			"v2:a":  0,
+			"v2:b":  1,
+			"v3:a":  2,
+			"other": 3,
+		} {
+			v, err := m.Get(k)
+			assert.NoError(t, err, "Get %q", k)
+			assert.Equal(t, expect, v, "Get %q", k)
+		}
+
+		for _, k := range []string{"v1:a", "v1:b"} {
+			ok, err := m.Contains(k)
+			assert.NoError(t, err, "Contains %q", k)
+			assert.False(t, ok, "Contains %q", k)
+		}
+	})
+}
+
+func TestMapStoreWithMeta(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		err := m.StoreWithMeta("a", 1, []byte("text/plain"))
+		assert.Error(t, err, "StoreWithMeta without WithMetadata")
+
+		m = m.WithMetadata()
+
+		err = m.StoreWithMeta("a", 1, []byte("text/plain"))
+		assert.NoError(t, err, "StoreWithMeta")
+
+		v, meta, ok, err := m.LoadWithMeta("a")
+		assert.NoError(t, err, "LoadWithMeta")
+		assert.True(t, ok, "LoadWithMeta")
+		assert.Equal(t, 1, v, "LoadWithMeta value")
+		assert.Equal(t, []byte("text/plain"), meta, "LoadWithMeta meta")
+
+		var keys []string
+		m.Keys()(func(k string) bool {
+			keys = append(keys, k)
+			return true
+		})
+		assert.Equal(t, []string{"a"}, keys, "metadata must not be visited")
+
+		// Replacing the value drops its metadata.
+		assert.NoError(t, m.Store("a", 2), "Store")
+
+		_, meta, ok, err = m.LoadWithMeta("a")
+		assert.NoError(t, err, "LoadWithMeta after Store")
+		assert.True(t, ok, "LoadWithMeta after Store")
+		assert.Zero(t, meta, "LoadWithMeta meta after Store")
+
+		_, _, ok, err = m.LoadWithMeta("b")
+		assert.NoError(t, err, "LoadWithMeta missing")
+		assert.False(t, ok, "LoadWithMeta missing")
+
+		// Every way of deleting a value drops its metadata.
+		deletes := map[string]func(k string) error{
+			"Delete": m.Delete,
+			"LoadAndDelete": func(k string) error {
+				_, _, err := m.LoadAndDelete(k)
+				return err
+			},
+			"DeletePrefix": func(k string) error {
+				_, err := m.DeletePrefix(k)
+				return err
+			},
+			"DeleteWhere": func(k string) error {
+				_, err := m.DeleteWhere(func(key string, _ int) bool { return key == k })
+				return err
+			},
+		}
+		for name, del := range deletes {
+			err := m.StoreWithMeta("c", 3, []byte("text/plain"))
+			assert.NoError(t, err, "StoreWithMeta before %s", name)
+
+			assert.NoError(t, del("c"), name)
+			assert.Equal(t, 0, countMetaKeys(t, d), "metadata after %s", name)
+		}
+	})
+}
+
+// countMetaKeys returns the number of sidecar keys written by StoreWithMeta.
+func countMetaKeys(t *testing.T, d persist.Driver) int {
+	t.Helper()
+
+	var n int
+	err := d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+		return tx.EachKey(func(k []byte) error {
+			if strings.HasPrefix(string(k), "\xffpersist\x00meta\x00") {
+				n++
+			}
+			return nil
+		})
+	})
+	assert.NoError(t, err, "count metadata")
+	return n
+}
+
+func TestMapChanges(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		if _, ok := d.(persist.DriverWatcher); !ok {
+			t.Skip("driver does not implement DriverWatcher")
+		}
+
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := m.Changes(ctx)
+		assert.NoError(t, err, "Changes")
+
+		// Some drivers subscribe asynchronously, so keep writing until the
+		// subscription picks something up.
+	warmup:
+		for {
+			err := m.Store("warmup", 0)
+			assert.NoError(t, err, "Store warmup")
+
+			select {
+			case c := <-ch:
+				assert.Equal(t, "warmup", c.Key, "warmup change")
+				break warmup
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		// Drain any extra warmup changes.
+	drain:
+		for {
+			select {
+			case <-ch:
+			case <-time.After(50 * time.Millisecond):
+				break drain
+			}
+		}
+
+		err = m.Store("a", 1)
+		assert.NoError(t, err, "Store a")
+
+		err = m.Delete("a")
+		assert.NoError(t, err, "Delete a")
+
+		assert.Equal(t, persist.Change[string, int]{Op: persist.ChangeSet, Key: "a", Value: 1}, <-ch, "set change")
+		assert.Equal(t, persist.Change[string, int]{Op: persist.ChangeDelete, Key: "a"}, <-ch, "delete change")
+
+		cancel()
+
+		for range ch {
+		}
+	})
+}
+
+func TestMapUpdateAll(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		for i, k := range []string{"a", "b", "c"} {
+			err := m.Store(k, i)
+			assert.NoError(t, err, "Store %q", k)
+		}
+
+		err := m.UpdateAll(func(k string, v int) (int, bool, error) {
+			return v * 10, k != "b", nil
+		})
+		assert.NoError(t, err, "UpdateAll")
+
+		got := map[string]int{}
+		m.All()(func(k string, v int) bool {
+			got[k] = v
+			return true
+		})
+		assert.Equal(t, map[string]int{"a": 0, "c": 20}, got, "UpdateAll result")
+	})
+}
+
+func TestNilRoundTrip(t *testing.T) {
+	type config struct{ Name string }
+
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		ptrs := persist.NewMapFromEncoders(d, persist.EncoderPair[string, *config]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[*config](),
+		})
+
+		v := persist.NewMappedValue(ptrs, "config")
+
+		c, ok, err := v.Load()
+		assert.NoError(t, err, "Load never stored")
+		assert.False(t, ok, "Load never stored")
+		assert.Zero(t, c, "Load never stored")
+
+		err = v.Store(nil)
+		assert.NoError(t, err, "Store nil")
+
+		c, ok, err = v.Load()
+		assert.NoError(t, err, "Load stored nil")
+		assert.True(t, ok, "Load stored nil")
+		assert.Zero(t, c, "Load stored nil")
+
+		slices := persist.NewMapFromEncoders(d, persist.EncoderPair[string, []string]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[[]string](),
+		})
+
+		err = slices.Store("nil", nil)
+		assert.NoError(t, err, "Store nil slice")
+
+		err = slices.Store("empty", []string{})
+		assert.NoError(t, err, "Store empty slice")
+
+		s, ok, err := slices.Load("nil")
+		assert.NoError(t, err, "Load nil slice")
+		assert.True(t, ok, "Load nil slice")
+		assert.True(t, s == nil, "nil slice must stay nil")
+
+		s, ok, err = slices.Load("empty")
+		assert.NoError(t, err, "Load empty slice")
+		assert.True(t, ok, "Load empty slice")
+		assert.True(t, s != nil && len(s) == 0, "empty slice must stay empty")
+	})
+}
+
+func TestMapFirstLast(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		_, _, ok, err := m.First()
+		assert.NoError(t, err, "First on empty map")
+		assert.False(t, ok, "First on empty map")
+
+		for i, k := range []string{"b", "a", "d", "c"} {
+			err := m.Store(k, i)
+			assert.NoError(t, err, "Store %q", k)
+		}
+
+		k, v, ok, err := m.First()
+		assert.NoError(t, err, "First")
+		assert.True(t, ok, "First")
+		assert.Equal(t, "a", k, "First key")
+		assert.Equal(t, 1, v, "First value")
+
+		k, v, ok, err = m.Last()
+		assert.NoError(t, err, "Last")
+		assert.True(t, ok, "Last")
+		assert.Equal(t, "d", k, "Last key")
+		assert.Equal(t, 2, v, "Last value")
+	})
+}
+
+func TestCopyMap(t *testing.T) {
+	src, err := persist.NewMap[string, int](persist.CBORDriver, filepath.Join(t.TempDir(), "src"))
+	assert.NoError(t, err, "NewMap src")
+	defer src.Close()
+
+	want := map[string]int{}
+	for i := 0; i < 2500; i++ {
+		k := strconv.Itoa(i)
+		want[k] = i
+	}
+
+	err = src.StoreMany(func(yield func(string, int) bool) {
+		for k, v := range want {
+			if !yield(k, v) {
+				return
+			}
+		}
+	})
+	assert.NoError(t, err, "StoreMany")
+
+	dst, err := persist.NewMap[string, int](badgerdb.Open, ":memory:")
+	assert.NoError(t, err, "NewMap dst")
+	defer dst.Close()
+
+	n, err := persist.CopyMap(dst, src)
+	assert.NoError(t, err, "CopyMap")
+	assert.Equal(t, len(want), n, "CopyMap count")
+
+	got := map[string]int{}
+	dst.All()(func(k string, v int) bool {
+		got[k] = v
+		return true
+	})
+	assert.Equal(t, want, got, "copied contents")
+}
+
+func TestNewValueFromEncoder(t *testing.T) {
+	d, err := badgerdb.Open(":memory:")
+	assert.NoError(t, err, "Open")
+
+	v := persist.NewValueFromEncoder(d, persist.BytesEncoder[[]byte]())
+	defer v.Close()
+
+	err = v.Store([]byte("raw"))
+	assert.NoError(t, err, "Store")
+
+	b, ok, err := v.Load()
+	assert.NoError(t, err, "Load")
+	assert.True(t, ok, "Load")
+	assert.Equal(t, []byte("raw"), b, "Load")
+
+	// The value must be stored as-is, without any CBOR wrapping.
+	err = d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+		return tx.EachKey(func(k []byte) error {
+			raw, _, err := tx.Get(k)
+			assert.Equal(t, []byte("raw"), raw, "raw value")
+			return err
+		})
+	})
+	assert.NoError(t, err, "AcquireRO")
+}
+
+func TestJSONWithCBORFallbackEncoder(t *testing.T) {
+	type config struct {
+		Name  string
+		Count int
+	}
+
+	d, err := badgerdb.Open(":memory:")
+	assert.NoError(t, err, "Open")
+	defer d.Close()
+
+	old := persist.NewMapFromEncoders(d, persist.EncoderPair[string, config]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.CBOREncoder[config](),
+	})
+	err = old.Store("old", config{Name: "old", Count: 1})
+	assert.NoError(t, err, "Store old")
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, config]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.JSONWithCBORFallbackEncoder[config](),
+	})
+	err = m.Store("new", config{Name: "new", Count: 2})
+	assert.NoError(t, err, "Store new")
+
+	got := make(map[string]config)
+	err = m.View(func(r persist.MapReader[string, config]) error {
+		return r.Each(func(k string, v config) error {
+			got[k] = v
+			return nil
+		})
+	})
+	assert.NoError(t, err, "Each")
+	assert.Equal(t, map[string]config{
+		"old": {Name: "old", Count: 1},
+		"new": {Name: "new", Count: 2},
+	}, got, "Each")
+
+	// New values are written as JSON.
+	err = d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+		b, _, err := tx.Get([]byte("new"))
+		assert.Equal(t, "\n{\n  \"Name\": \"new\",\n  \"Count\": 2\n}", string(b), "raw new")
+		return err
+	})
+	assert.NoError(t, err, "AcquireRO")
+}
+
+func TestValueSubscribe(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+		v := persist.NewMappedValue(m, "value")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := v.Subscribe(ctx)
+		assert.NoError(t, err, "Subscribe")
+
+		// Some drivers subscribe asynchronously, so keep writing until the
+		// subscription picks something up.
+	warmup:
+		for {
+			err := v.Store(0)
+			assert.NoError(t, err, "Store warmup")
+
+			select {
+			case <-ch:
+				break warmup
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		// Writes to other keys are not reported.
+		err = m.Store("other", 1)
+		assert.NoError(t, err, "Store other")
+
+		err = v.Store(2)
+		assert.NoError(t, err, "Store 2")
+
+		timeout := time.After(5 * time.Second)
+		for got := -1; got != 2; {
+			select {
+			case got = <-ch:
+				assert.True(t, got == 0 || got == 2, "unexpected value %d", got)
+			case <-timeout:
+				t.Fatal("timed out waiting for value")
+			}
+		}
+
+		cancel()
+
+		for range ch {
+		}
+	})
+}
+
+func TestMapSnapshot(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		err := m.Store("a", 1)
+		assert.NoError(t, err, "Store a")
+
+		s, err := m.Snapshot()
+		assert.NoError(t, err, "Snapshot")
+
+		err = m.Store("a", 2)
+		assert.NoError(t, err, "Store a again")
+
+		err = m.Store("b", 3)
+		assert.NoError(t, err, "Store b")
+
+		v, ok, err := s.Get("a")
+		assert.NoError(t, err, "Get a")
+		assert.True(t, ok, "Get a")
+		assert.Equal(t, 1, v, "Get a")
+
+		_, ok, err = s.Get("b")
+		assert.NoError(t, err, "Get b")
+		assert.False(t, ok, "Get b")
+
+		got := make(map[string]int)
+		s.All()(func(k string, v int) bool {
+			got[k] = v
+			return true
+		})
+		assert.Equal(t, map[string]int{"a": 1}, got, "All")
+
+		err = s.Close()
+		assert.NoError(t, err, "Close")
+	})
+}
+
+func TestPrefixedDriver(t *testing.T) {
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		newMap := func(prefix string) persist.Map[string, int] {
+			return persist.NewMapFromEncoders(
+				persist.PrefixedDriver(d, []byte(prefix)),
+				persist.EncoderPair[string, int]{
+					Key:   persist.StringEncoder[string](),
+					Value: intEncoder,
+				},
+			)
+		}
+
+		a := newMap("a/")
+		b := newMap("b/")
+
+		assert.NoError(t, a.Store("k", 1), "Store a")
+		assert.NoError(t, b.Store("k", 2), "Store b")
+		assert.NoError(t, b.Store("only-b", 3), "Store b")
+
+		v, ok, err := a.Load("k")
+		assert.NoError(t, err, "Load a")
+		assert.True(t, ok, "Load a")
+		assert.Equal(t, 1, v, "Load a")
+
+		ok, err = a.Contains("only-b")
+		assert.NoError(t, err, "Contains a")
+		assert.False(t, ok, "a does not see b's keys")
+
+		got := map[string]int{}
+		b.All()(func(k string, v int) bool {
+			got[k] = v
+			return true
+		})
+		assert.Equal(t, map[string]int{"k": 2, "only-b": 3}, got, "All b")
+
+		assert.NoError(t, a.Close(), "Close a")
+		assert.NoError(t, a.Delete("k"), "Delete after Close")
+
+		err = d.AcquireRO(func(tx persist.DriverReadOnlyTx) error {
+			_, ok, err := tx.Get([]byte("b/k"))
+			assert.True(t, ok, "raw key is prefixed")
+			return err
+		})
+		assert.NoError(t, err, "AcquireRO")
+	})
+}
+
+func TestMapConcurrentUse(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 50
+	)
+
+	eachDriver(t, func(t *testing.T, d persist.Driver) {
+		m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, int]{
+			Key:   persist.StringEncoder[string](),
+			Value: persist.CBOREncoder[int](),
+		})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, goroutines)
+
+		for i := 0; i < goroutines; i++ {
+			k := strconv.Itoa(i % 2)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < iterations; j++ {
+					_, err := m.Update("counter", func(v int, _ bool) (int, error) {
+						return v + 1, nil
+					})
+					if err == nil {
+						err = m.Store(k, j)
+					}
+					if err == nil {
+						_, _, err = m.Load(k)
+					}
+					if err == nil {
+						_, err = m.Stats()
+					}
+					if err == nil {
+						m.All()(func(string, int) bool { return true })
+						_, _, err = m.LoadAndDelete(k)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		n, err := m.Get("counter")
+		assert.NoError(t, err, "Get counter")
+		assert.Equal(t, goroutines*iterations, n, "lost updates")
+	})
+}
@@ -0,0 +1,203 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DumpFormat is the output format of [Map.DumpTo].
+type DumpFormat uint8
+
+const (
+	// FormatJSON writes a single JSON array of objects.
+	FormatJSON DumpFormat = iota
+	// FormatJSONL writes one JSON object per line.
+	FormatJSONL
+)
+
+// dumpEntry is a key-value pair as written by DumpTo.
+type dumpEntry struct {
+	Key   json.RawMessage `json:"key,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Error string          `json:"_error,omitempty"`
+}
+
+// DumpTo writes all key-value pairs in the map to w in the given format. Each
+// pair is written as an object with a "key" and a "value" field, with both
+// decoded using the map's encoders and then encoded as JSON.
+//
+// Pairs that fail to decode or to encode as JSON do not stop the dump.
+// Instead, their object has an "_error" field describing the error, and the
+// fields that could not be produced are omitted.
+func (m Map[K, V]) DumpTo(w io.Writer, format DumpFormat) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	if format != FormatJSON && format != FormatJSONL {
+		return fmt.Errorf("persist: unknown dump format %d", format)
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if format == FormatJSON {
+		bw.WriteString("[")
+	}
+
+	var n int
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+
+			b, err := json.Marshal(m.dumpEntry(bk, bv))
+			if err != nil {
+				return err
+			}
+
+			if format == FormatJSON && n > 0 {
+				bw.WriteString(",")
+			}
+			bw.Write(b)
+			if format == FormatJSONL {
+				bw.WriteString("\n")
+			}
+
+			n++
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		bw.WriteString("]\n")
+	}
+
+	return bw.Flush()
+}
+
+func (m Map[K, V]) dumpEntry(bk, bv []byte) dumpEntry {
+	var entry dumpEntry
+
+	k, err := m.kencoder.Decode(bk)
+	if err != nil {
+		entry.Error = fmt.Sprintf("decode key: %v", err)
+		return entry
+	}
+
+	entry.Key, err = json.Marshal(k)
+	if err != nil {
+		entry.Error = fmt.Sprintf("marshal key: %v", err)
+		return entry
+	}
+
+	v, err := m.valueEncoder(bk).Decode(bv)
+	if err != nil {
+		entry.Error = fmt.Sprintf("decode value: %v", err)
+		return entry
+	}
+
+	entry.Value, err = json.Marshal(v)
+	if err != nil {
+		entry.Error = fmt.Sprintf("marshal value: %v", err)
+		return entry
+	}
+
+	return entry
+}
+
+// importBatchSize is the number of pairs that LoadFromJSONL stores per call to
+// StoreMany.
+const importBatchSize = 1000
+
+// maxJSONLLineSize is the maximum size of a line read by LoadFromJSONL.
+const maxJSONLLineSize = 64 << 20
+
+// LoadFromJSONL reads newline-delimited JSON objects with a "key" and a
+// "value" field from r, such as those written by [Map.DumpTo] with
+// [FormatJSONL], and stores them into the map. It returns the number of stored
+// pairs. Blank lines are skipped.
+//
+// Pairs are stored in batches using [Map.StoreMany]. If a line is malformed,
+// then an error with its line number is returned and the batches already
+// stored are kept.
+func (m Map[K, V]) LoadFromJSONL(r io.Reader) (imported int, err error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	batch := make([]Pair[K, V], 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := m.StoreMany(pairsSeq(batch)); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxJSONLLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		p, err := parseJSONLPair[K, V](b)
+		if err != nil {
+			return imported, fmt.Errorf("persist: line %d: %w", line, err)
+		}
+
+		batch = append(batch, p)
+		if len(batch) < importBatchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			return imported, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return imported, fmt.Errorf("persist: read JSONL: %w", err)
+	}
+
+	return imported, flush()
+}
+
+func parseJSONLPair[K, V any](b []byte) (Pair[K, V], error) {
+	var p Pair[K, V]
+
+	var entry dumpEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return p, err
+	}
+
+	if entry.Key == nil {
+		return p, errors.New("missing key")
+	}
+	if err := json.Unmarshal(entry.Key, &p.Key); err != nil {
+		return p, fmt.Errorf("decode key: %w", err)
+	}
+
+	if entry.Value == nil {
+		return p, errors.New("missing value")
+	}
+	if err := json.Unmarshal(entry.Value, &p.Value); err != nil {
+		return p, fmt.Errorf("decode value: %w", err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,93 @@
+package persist
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMapDumpTo(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	m := NewMapFromEncoders(d, EncoderPair[string, int]{
+		Key:   CBOREncoder[string](),
+		Value: CBOREncoder[int](),
+	})
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	// Store a value that cannot be decoded as an int.
+	bad := NewMapFromEncoders(d, EncoderPair[string, string]{
+		Key:   CBOREncoder[string](),
+		Value: CBOREncoder[string](),
+	})
+	assert.NoError(t, bad.Store("c", "not an int"), "Store c")
+
+	var jsonl bytes.Buffer
+	err = m.DumpTo(&jsonl, FormatJSONL)
+	assert.NoError(t, err, "DumpTo JSONL")
+
+	lines := strings.Split(strings.TrimSuffix(jsonl.String(), "\n"), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, 3, len(lines), "JSONL lines")
+	assert.Equal(t, `{"key":"a","value":1}`, lines[0], "JSONL a")
+	assert.Equal(t, `{"key":"b","value":2}`, lines[1], "JSONL b")
+	assert.True(t, strings.HasPrefix(lines[2], `{"key":"c","_error":"decode value: `), "JSONL c: %s", lines[2])
+
+	var array bytes.Buffer
+	err = m.DumpTo(&array, FormatJSON)
+	assert.NoError(t, err, "DumpTo JSON")
+
+	var entries []map[string]any
+	err = json.Unmarshal(array.Bytes(), &entries)
+	assert.NoError(t, err, "Unmarshal JSON")
+	assert.Equal(t, 3, len(entries), "JSON entries")
+}
+
+func TestMapLoadFromJSONL(t *testing.T) {
+	newMap := func() Map[string, int] {
+		m, err := NewMap[string, int](CBORDriver, filepath.Join(t.TempDir(), "test.cbor"))
+		assert.NoError(t, err, "NewMap")
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	src := newMap()
+	assert.NoError(t, src.Store("a", 1), "Store a")
+	assert.NoError(t, src.Store("b", 2), "Store b")
+
+	var dump bytes.Buffer
+	err := src.DumpTo(&dump, FormatJSONL)
+	assert.NoError(t, err, "DumpTo")
+
+	dst := newMap()
+	n, err := dst.LoadFromJSONL(&dump)
+	assert.NoError(t, err, "LoadFromJSONL")
+	assert.Equal(t, 2, n, "imported")
+
+	v, err := dst.Get("b")
+	assert.NoError(t, err, "Get b")
+	assert.Equal(t, 2, v, "Get b")
+
+	input := strings.Join([]string{
+		`{"key":"c","value":3}`,
+		``,
+		`{"key":"d","value":"four"}`,
+	}, "\n")
+
+	_, err = dst.LoadFromJSONL(strings.NewReader(input))
+	assert.Error(t, err, "LoadFromJSONL malformed")
+	assert.Contains(t, err.Error(), "line 3", "LoadFromJSONL malformed")
+
+	_, err = dst.LoadFromJSONL(strings.NewReader(`{"key":"e"}`))
+	assert.Error(t, err, "LoadFromJSONL missing value")
+	assert.Contains(t, err.Error(), "line 1: missing value", "LoadFromJSONL missing value")
+}
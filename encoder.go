@@ -3,7 +3,13 @@ package persist
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"unsafe"
 
 	"github.com/fxamacker/cbor/v2"
 )
@@ -36,6 +42,31 @@ func (stringEncoder[T]) Decode(buf []byte) (T, error) {
 	return T(buf), nil
 }
 
+// UnsafeStringEncoder returns an Encoder like [StringEncoder], except that
+// Encode returns the bytes of the string itself rather than a copy, so encoding
+// never allocates. This is meant for hot paths that store many string-keyed
+// entries.
+//
+// The returned bytes alias the string's memory, which Go assumes is never
+// modified. It is therefore only safe to use as long as:
+//
+//   - nothing ever writes to the encoded bytes, which includes passing them as
+//     the buffer of another Encode call; and
+//   - the driver does not modify the keys or values given to Set, which none of
+//     the drivers in this module do.
+//
+// Map upholds the first condition itself. Retaining the bytes is fine, since
+// the string is kept alive by them. Decode copies the bytes as usual.
+func UnsafeStringEncoder[T ~string]() Encoder[T] {
+	return unsafeStringEncoder[T]{}
+}
+
+type unsafeStringEncoder[T ~string] struct{ stringEncoder[T] }
+
+func (unsafeStringEncoder[T]) Encode(v T, _ []byte) ([]byte, error) {
+	return unsafe.Slice(unsafe.StringData(string(v)), len(v)), nil
+}
+
 // StringerEncoder returns an Encoder that encodes values using the Stringer
 // interface. A parser function must be provided to decode the value
 // from the string representation.
@@ -55,6 +86,131 @@ func (e stringerEncoder[T]) Decode(buf []byte) (T, error) {
 	return e.parser(string(buf))
 }
 
+// FuncEncoder returns an Encoder that encodes values using the given functions.
+// This allows defining a one-off encoder inline without declaring a type for
+// it. decode must not modify or keep the byte slice that it is given.
+func FuncEncoder[T any](encode func(T) ([]byte, error), decode func([]byte) (T, error)) Encoder[T] {
+	return funcEncoder[T]{encode, decode}
+}
+
+type funcEncoder[T any] struct {
+	encode func(T) ([]byte, error)
+	decode func([]byte) (T, error)
+}
+
+func (e funcEncoder[T]) Encode(v T, _ []byte) ([]byte, error) {
+	return e.encode(v)
+}
+
+func (e funcEncoder[T]) Decode(buf []byte) (T, error) {
+	return e.decode(buf)
+}
+
+// TextEncoder returns an Encoder that encodes values using their MarshalText
+// method. T or *T must implement [encoding.TextUnmarshaler] to decode values;
+// if T is a pointer type, a new value is allocated for each decode. This works
+// out of the box with types like [time.Time] and [net.IP].
+func TextEncoder[T encoding.TextMarshaler]() Encoder[T] {
+	return textEncoder[T]{}
+}
+
+type textEncoder[T encoding.TextMarshaler] struct{}
+
+func (textEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	b, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf[:0], b...), nil
+}
+
+func (textEncoder[T]) Decode(buf []byte) (T, error) {
+	var z T
+	v, u, err := newUnmarshaler[T, encoding.TextUnmarshaler]()
+	if err != nil {
+		return z, err
+	}
+	if err := u.UnmarshalText(buf); err != nil {
+		return z, err
+	}
+	return *v, nil
+}
+
+// BinaryMarshalerEncoder returns an Encoder that encodes values using their
+// MarshalBinary method. This gives compact and stable encodings for types like
+// [time.Time] and [net/netip.Addr] without the overhead of CBOR.
+//
+// newFn returns the value to decode into, which is needed for pointer types
+// whose zero value is nil, e.g. func() *url.URL { return new(url.URL) }. If
+// newFn is nil, then a new value is allocated using reflection, as with
+// [TextEncoder].
+func BinaryMarshalerEncoder[T encoding.BinaryMarshaler](newFn func() T) Encoder[T] {
+	return binaryMarshalerEncoder[T]{newFn}
+}
+
+type binaryMarshalerEncoder[T encoding.BinaryMarshaler] struct {
+	newFn func() T
+}
+
+func (binaryMarshalerEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf[:0], b...), nil
+}
+
+func (e binaryMarshalerEncoder[T]) Decode(buf []byte) (T, error) {
+	var z T
+	var v *T
+	var u encoding.BinaryUnmarshaler
+	var err error
+
+	if e.newFn != nil {
+		v = new(T)
+		*v = e.newFn()
+
+		var ok bool
+		if u, ok = any(v).(encoding.BinaryUnmarshaler); !ok {
+			if u, ok = any(*v).(encoding.BinaryUnmarshaler); !ok {
+				return z, fmt.Errorf("persist: %T does not implement encoding.BinaryUnmarshaler", *v)
+			}
+		}
+	} else {
+		v, u, err = newUnmarshaler[T, encoding.BinaryUnmarshaler]()
+		if err != nil {
+			return z, err
+		}
+	}
+
+	if err := u.UnmarshalBinary(buf); err != nil {
+		return z, err
+	}
+	return *v, nil
+}
+
+// newUnmarshaler allocates a new T and returns it along with the U that
+// decodes into it. If T is a pointer type, then the value it points to is
+// allocated as well.
+func newUnmarshaler[T, U any]() (*T, U, error) {
+	v := new(T)
+	if u, ok := any(v).(U); ok {
+		return v, u, nil
+	}
+
+	rt := reflect.TypeOf(v).Elem()
+	if rt.Kind() == reflect.Pointer {
+		pv := reflect.New(rt.Elem())
+		if u, ok := pv.Interface().(U); ok {
+			reflect.ValueOf(v).Elem().Set(pv)
+			return v, u, nil
+		}
+	}
+
+	var u U
+	return v, u, fmt.Errorf("persist: %v does not implement %v", rt, reflect.TypeOf(&u).Elem())
+}
+
 // BytesEncoder returns an Encoder that encodes values literally as byte slices.
 // Use this for fast key formatting.
 func BytesEncoder[T []byte]() Encoder[T] {
@@ -71,6 +227,171 @@ func (bytesEncoder[T]) Decode(buf []byte) (T, error) {
 	return T(append([]byte(nil), buf...)), nil
 }
 
+// integer is any integer type.
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// EnumEncoder returns an Encoder for integer types such as enums that encodes
+// values as fixed-width big-endian integers, as wide as T itself, e.g. a single
+// byte for a uint8 type. Signed values are encoded with their sign bit flipped,
+// so encoded values of any T sort in the same order as the values themselves.
+// This makes it suitable for keys.
+func EnumEncoder[T integer]() Encoder[T] {
+	return enumEncoder[T]{}
+}
+
+type enumEncoder[T integer] struct{}
+
+func (enumEncoder[T]) size() int {
+	var v T
+	return int(unsafe.Sizeof(v))
+}
+
+// signBit returns the bit to flip for T, or 0 if T is unsigned.
+func (e enumEncoder[T]) signBit() uint64 {
+	if ^T(0) > 0 {
+		return 0
+	}
+	return 1 << (e.size()*8 - 1)
+}
+
+func (e enumEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	u := uint64(v) ^ e.signBit()
+	buf = buf[:0]
+	for i := e.size() - 1; i >= 0; i-- {
+		buf = append(buf, byte(u>>(8*i)))
+	}
+	return buf, nil
+}
+
+func (e enumEncoder[T]) Decode(buf []byte) (T, error) {
+	if len(buf) != e.size() {
+		return 0, fmt.Errorf("persist: enum value must be %d bytes, got %d", e.size(), len(buf))
+	}
+	var u uint64
+	for _, b := range buf {
+		u = u<<8 | uint64(b)
+	}
+	return T(u ^ e.signBit()), nil
+}
+
+// SliceEncoder returns an Encoder for slices that encodes each element using
+// elem. The encoding starts with a byte that tells nil slices apart from empty
+// ones, followed by the number of elements and each element prefixed with its
+// length, all as unsigned varints. Use it to encode container types with a
+// custom element encoding.
+func SliceEncoder[T any](elem Encoder[T]) Encoder[[]T] {
+	return sliceEncoder[T]{elem}
+}
+
+type sliceEncoder[T any] struct {
+	elem Encoder[T]
+}
+
+const (
+	sliceNil    = 0x00
+	sliceNonNil = 0x01
+)
+
+func (e sliceEncoder[T]) Encode(vs []T, buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	if vs == nil {
+		return append(buf, sliceNil), nil
+	}
+
+	buf = append(buf, sliceNonNil)
+	buf = binary.AppendUvarint(buf, uint64(len(vs)))
+
+	var eb []byte
+	for i, v := range vs {
+		var err error
+		eb, err = e.elem.Encode(v, eb)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(eb)))
+		buf = append(buf, eb...)
+	}
+
+	return buf, nil
+}
+
+var errTruncatedSlice = errors.New("persist: truncated slice encoding")
+
+func (e sliceEncoder[T]) Decode(buf []byte) ([]T, error) {
+	if len(buf) == 0 {
+		return nil, errTruncatedSlice
+	}
+
+	switch buf[0] {
+	case sliceNil:
+		return nil, nil
+	case sliceNonNil:
+	default:
+		return nil, fmt.Errorf("persist: invalid slice encoding header 0x%02x", buf[0])
+	}
+	buf = buf[1:]
+
+	n, sz := binary.Uvarint(buf)
+	if sz <= 0 {
+		return nil, errTruncatedSlice
+	}
+	buf = buf[sz:]
+
+	// Every element takes at least one byte for its length, which bounds
+	// the allocation for corrupt counts.
+	vs := make([]T, 0, min(n, uint64(len(buf))))
+	for i := uint64(0); i < n; i++ {
+		l, sz := binary.Uvarint(buf)
+		if sz <= 0 || l > uint64(len(buf)-sz) {
+			return nil, errTruncatedSlice
+		}
+		buf = buf[sz:]
+
+		v, err := e.elem.Decode(buf[:l])
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		vs = append(vs, v)
+		buf = buf[l:]
+	}
+
+	return vs, nil
+}
+
+// ErrHashedKey is returned when decoding a key encoded by [HashedKeyEncoder].
+var ErrHashedKey = errors.New("persist: hashed keys cannot be decoded")
+
+// HashedKeyEncoder returns an Encoder that encodes keys as the hash returned by
+// hashFn. Use this for key types that have no stable encoding, such as structs
+// with slice or map fields, where two logically equal keys may otherwise
+// encode to different bytes. hashFn must return the same bytes for keys that
+// are considered equal.
+//
+// Hashing is one-way: Decode always fails with [ErrHashedKey]. This means that
+// iterating over a map using this encoder with [Map.All] or [Map.Keys] stops
+// at the very first entry without yielding anything, while methods that
+// return errors, such as [Map.AllStream], return ErrHashedKey. Users that need
+// to iterate must store the original key as part of the value.
+func HashedKeyEncoder[K any](hashFn func(K) []byte) Encoder[K] {
+	return hashedKeyEncoder[K]{hashFn}
+}
+
+type hashedKeyEncoder[K any] struct {
+	hashFn func(K) []byte
+}
+
+func (e hashedKeyEncoder[K]) Encode(k K, buf []byte) ([]byte, error) {
+	return append(buf[:0], e.hashFn(k)...), nil
+}
+
+func (hashedKeyEncoder[K]) Decode([]byte) (K, error) {
+	var k K
+	return k, ErrHashedKey
+}
+
 // CBOREncoder returns an Encoder that encodes values using the CBOR format.
 func CBOREncoder[T any]() Encoder[T] {
 	return cborEncoder[T]{}
@@ -78,6 +399,17 @@ func CBOREncoder[T any]() Encoder[T] {
 
 type cborEncoder[T any] struct{}
 
+// cborDecMode is the decoding mode used by CBOREncoder. Go strings may hold
+// arbitrary bytes and are encoded as-is, so invalid UTF-8 in text strings must
+// be accepted for them to round-trip.
+var cborDecMode = func() cbor.DecMode {
+	dm, err := cbor.DecOptions{UTF8: cbor.UTF8DecodeInvalid}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}()
+
 func (cborEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
 	bbuf := bytes.NewBuffer(buf[:0])
 	if err := cbor.NewEncoder(bbuf).Encode(v); err != nil {
@@ -88,8 +420,206 @@ func (cborEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
 
 func (cborEncoder[T]) Decode(buf []byte) (T, error) {
 	var v T
-	if err := cbor.Unmarshal(buf, &v); err != nil {
+	if err := cborDecMode.Unmarshal(buf, &v); err != nil {
 		return v, err
 	}
 	return v, nil
 }
+
+// CanonicalCBOREncoder returns an Encoder like [CBOREncoder], except that
+// values are encoded deterministically following the Core Deterministic
+// Encoding Requirements of RFC 8949, e.g. map keys are sorted. Equal values
+// therefore always encode to the same bytes. Both encoders can decode each
+// other's output.
+func CanonicalCBOREncoder[T any]() Encoder[T] {
+	return cborCanonicalEncoder[T]{}
+}
+
+type cborCanonicalEncoder[T any] struct{ cborEncoder[T] }
+
+var cborCanonicalEncMode = func() cbor.EncMode {
+	em, err := cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}()
+
+func (cborCanonicalEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	bbuf := bytes.NewBuffer(buf[:0])
+	if err := cborCanonicalEncMode.NewEncoder(bbuf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bbuf.Bytes(), nil
+}
+
+// CBOREncoderWithTags returns an Encoder like [CBOREncoder], except that the
+// types registered in tags are encoded and decoded with their CBOR tags. Use
+// this for interoperability with other languages that expect certain types to
+// be tagged. Registering tags after calling this function has no effect.
+func CBOREncoderWithTags[T any](tags cbor.TagSet) Encoder[T] {
+	em, err := cbor.EncOptions{}.EncModeWithTags(tags)
+	if err != nil {
+		panic(err)
+	}
+	dm, err := cbor.DecOptions{UTF8: cbor.UTF8DecodeInvalid}.DecModeWithTags(tags)
+	if err != nil {
+		panic(err)
+	}
+	return cborTagsEncoder[T]{em, dm}
+}
+
+type cborTagsEncoder[T any] struct {
+	em cbor.EncMode
+	dm cbor.DecMode
+}
+
+func (e cborTagsEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	bbuf := bytes.NewBuffer(buf[:0])
+	if err := e.em.NewEncoder(bbuf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bbuf.Bytes(), nil
+}
+
+func (e cborTagsEncoder[T]) Decode(buf []byte) (T, error) {
+	var v T
+	if err := e.dm.Unmarshal(buf, &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// JSONEncoder returns an Encoder that encodes values as JSON. If indent is not
+// empty, then the JSON is pretty-printed using it, which makes values easier
+// to diff and inspect at the cost of size.
+func JSONEncoder[T any](indent string) Encoder[T] {
+	return jsonEncoder[T]{indent}
+}
+
+type jsonEncoder[T any] struct {
+	indent string
+}
+
+func (e jsonEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	bbuf := bytes.NewBuffer(buf[:0])
+
+	enc := json.NewEncoder(bbuf)
+	enc.SetIndent("", e.indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	// Drop the trailing newline added by Encode.
+	return bytes.TrimSuffix(bbuf.Bytes(), []byte("\n")), nil
+}
+
+func (jsonEncoder[T]) Decode(buf []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// FallbackEncoder returns an Encoder that encodes values using primary. Values
+// are decoded using primary first, then using each of the fallbacks in order
+// until one succeeds. If all of them fail, then all errors are returned.
+//
+// This is useful for migrating from one encoding to another: values written
+// using the old encoding are still readable, while new values are written
+// using the new one. Note that the first encoder able to decode a value wins,
+// so the encodings should not be ambiguous.
+func FallbackEncoder[T any](primary Encoder[T], fallbacks ...Encoder[T]) Encoder[T] {
+	return fallbackEncoder[T]{primary, fallbacks}
+}
+
+type fallbackEncoder[T any] struct {
+	primary   Encoder[T]
+	fallbacks []Encoder[T]
+}
+
+func (e fallbackEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	return e.primary.Encode(v, buf)
+}
+
+func (e fallbackEncoder[T]) Decode(buf []byte) (T, error) {
+	v, err := e.primary.Decode(buf)
+	if err == nil {
+		return v, nil
+	}
+
+	errs := []error{err}
+	for _, enc := range e.fallbacks {
+		v, err := enc.Decode(buf)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, err)
+	}
+
+	var z T
+	return z, errors.Join(errs...)
+}
+
+// SniffingEncoder returns an Encoder that encodes values using CBOR, but can
+// also decode raw byte slices written using [BytesEncoder] if T is a byte
+// slice type. Values that fail to decode as CBOR are returned as-is. Use it to
+// read legacy databases that mix both encodings. For other combinations of
+// encodings, use [FallbackEncoder].
+//
+// Note that a raw value that happens to be valid CBOR is decoded as CBOR, so
+// this is only a rescue and not a reliable way to store both.
+func SniffingEncoder[T any]() Encoder[T] {
+	return sniffingEncoder[T]{}
+}
+
+type sniffingEncoder[T any] struct{ cborEncoder[T] }
+
+func (e sniffingEncoder[T]) Decode(buf []byte) (T, error) {
+	v, err := e.cborEncoder.Decode(buf)
+	if err == nil {
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Uint8 {
+		return v, err
+	}
+
+	rv.SetBytes(append([]byte(nil), buf...))
+	return v, nil
+}
+
+// JSONWithCBORFallbackEncoder returns an Encoder that writes values as
+// pretty-printed JSON, but can read values written by either JSON or
+// [CBOREncoder]. Use it to migrate a database from CBOR to JSON one value at a
+// time.
+//
+// Some bytes are valid as both JSON and CBOR, e.g. "0" is also CBOR's -17, so
+// JSON values are written with a leading newline. The newline is a complete
+// CBOR item on its own, so the JSON that follows makes the value ill-formed
+// as CBOR, while values written by [CBOREncoder] are always well-formed. Values
+// are therefore read as CBOR if they are well-formed CBOR, and as JSON
+// otherwise. JSON written by other encoders may be misread as CBOR.
+func JSONWithCBORFallbackEncoder[T any]() Encoder[T] {
+	return jsonCBORFallbackEncoder[T]{}
+}
+
+type jsonCBORFallbackEncoder[T any] struct{}
+
+func (jsonCBORFallbackEncoder[T]) Encode(v T, buf []byte) ([]byte, error) {
+	b, err := JSONEncoder[T]("  ").Encode(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf[:0], '\n')
+	return append(buf, b...), nil
+}
+
+func (jsonCBORFallbackEncoder[T]) Decode(buf []byte) (T, error) {
+	if cborDecMode.Wellformed(buf) == nil {
+		return CBOREncoder[T]().Decode(buf)
+	}
+	return JSONEncoder[T]("").Decode(buf)
+}
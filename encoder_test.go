@@ -0,0 +1,447 @@
+package persist
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/fxamacker/cbor/v2"
+)
+
+func FuzzCBOREncoder(f *testing.F) {
+	f.Add("data", 42)
+	f.Add("", 0)
+
+	enc := CBOREncoder[testStruct]()
+
+	f.Fuzz(func(t *testing.T, data string, i int) {
+		v := testStruct{Data: data, Int: i}
+
+		b, err := enc.Encode(v, nil)
+		assert.NoError(t, err, "Encode")
+
+		d, err := enc.Decode(b)
+		assert.NoError(t, err, "Decode")
+		assert.Equal(t, v, d, "round-trip")
+	})
+}
+
+func FuzzCBOREncoderDecode(f *testing.F) {
+	seed, _ := CBOREncoder[testStruct]().Encode(testStruct{Data: "data", Int: 42}, nil)
+	f.Add(seed)
+	f.Add([]byte{})
+	f.Add([]byte{0xff})
+
+	enc := CBOREncoder[testStruct]()
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// Only check that this doesn't panic.
+		enc.Decode(b)
+	})
+}
+
+func FuzzStringEncoder(f *testing.F) {
+	f.Add("data")
+	f.Add("")
+	f.Add("\xff")
+
+	enc := StringEncoder[string]()
+
+	f.Fuzz(func(t *testing.T, v string) {
+		b, err := enc.Encode(v, nil)
+		assert.NoError(t, err, "Encode")
+
+		d, err := enc.Decode(b)
+		assert.NoError(t, err, "Decode")
+		assert.Equal(t, v, d, "round-trip")
+	})
+}
+
+func FuzzBytesEncoder(f *testing.F) {
+	f.Add([]byte("data"))
+	f.Add([]byte{})
+
+	enc := BytesEncoder[[]byte]()
+
+	f.Fuzz(func(t *testing.T, v []byte) {
+		buf := make([]byte, 0, len(v))
+
+		b, err := enc.Encode(v, buf)
+		assert.NoError(t, err, "Encode")
+
+		d, err := enc.Decode(b)
+		assert.NoError(t, err, "Decode")
+		assert.True(t, bytes.Equal(v, d), "round-trip")
+
+		// The decoded value must not alias the encoded buffer.
+		for i := range b {
+			b[i]++
+		}
+		assert.True(t, bytes.Equal(v, d), "decoded value aliases buffer")
+	})
+}
+
+func TestTextEncoder(t *testing.T) {
+	ipEnc := TextEncoder[net.IP]()
+
+	ip := net.ParseIP("192.0.2.1")
+	b, err := ipEnc.Encode(ip, nil)
+	assert.NoError(t, err, "Encode IP")
+	assert.Equal(t, "192.0.2.1", string(b), "Encode IP")
+
+	d, err := ipEnc.Decode(b)
+	assert.NoError(t, err, "Decode IP")
+	assert.True(t, ip.Equal(d), "Decode IP")
+
+	timeEnc := TextEncoder[*time.Time]()
+
+	now := time.Date(2023, 11, 5, 12, 30, 0, 0, time.UTC)
+	b, err = timeEnc.Encode(&now, nil)
+	assert.NoError(t, err, "Encode time")
+
+	tp, err := timeEnc.Decode(b)
+	assert.NoError(t, err, "Decode time")
+	assert.True(t, now.Equal(*tp), "Decode time")
+}
+
+func TestBinaryMarshalerEncoder(t *testing.T) {
+	timeEnc := BinaryMarshalerEncoder[time.Time](nil)
+
+	now := time.Now()
+	b, err := timeEnc.Encode(now, nil)
+	assert.NoError(t, err, "Encode time")
+
+	d, err := timeEnc.Decode(b)
+	assert.NoError(t, err, "Decode time")
+	assert.True(t, now.Equal(d), "Decode time")
+	// The monotonic clock reading must be stripped.
+	assert.Equal(t, now.Round(0).String(), d.String(), "Decode time")
+
+	urlEnc := BinaryMarshalerEncoder(func() *url.URL { return new(url.URL) })
+
+	u, _ := url.Parse("https://example.com/path?q=1")
+	b, err = urlEnc.Encode(u, nil)
+	assert.NoError(t, err, "Encode URL")
+
+	du, err := urlEnc.Decode(b)
+	assert.NoError(t, err, "Decode URL")
+	assert.Equal(t, u.String(), du.String(), "Decode URL")
+}
+
+func TestCanonicalCBOREncoder(t *testing.T) {
+	m := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		m[strconv.Itoa(i)] = i
+	}
+
+	enc := CanonicalCBOREncoder[map[string]int]()
+
+	b1, err := enc.Encode(m, nil)
+	assert.NoError(t, err, "Encode 1")
+
+	b2, err := enc.Encode(m, nil)
+	assert.NoError(t, err, "Encode 2")
+	assert.Equal(t, b1, b2, "Encode is deterministic")
+
+	v, err := CBOREncoder[map[string]int]().Decode(b1)
+	assert.NoError(t, err, "Decode")
+	assert.Equal(t, m, v, "Decode")
+}
+
+func TestJSONEncoder(t *testing.T) {
+	enc := JSONEncoder[testStruct]("  ")
+
+	b, err := enc.Encode(testStruct{Data: "data", Int: 42}, nil)
+	assert.NoError(t, err, "Encode")
+	assert.Equal(t, "{\n  \"Data\": \"data\",\n  \"Int\": 42\n}", string(b), "Encode")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode")
+	assert.Equal(t, testStruct{Data: "data", Int: 42}, v, "Decode")
+}
+
+func TestFallbackEncoder(t *testing.T) {
+	enc := FallbackEncoder(JSONEncoder[int](""), CBOREncoder[int]())
+
+	b, err := enc.Encode(1000, nil)
+	assert.NoError(t, err, "Encode")
+	assert.Equal(t, "1000", string(b), "Encode")
+
+	b, err = CBOREncoder[int]().Encode(1000, nil)
+	assert.NoError(t, err, "Encode CBOR")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode CBOR")
+	assert.Equal(t, 1000, v, "Decode CBOR")
+
+	_, err = enc.Decode([]byte{0xFF})
+	assert.Error(t, err, "Decode invalid")
+}
+
+func TestEncoderReport(t *testing.T) {
+	stats := EncoderReport("hello", map[string]Encoder[string]{
+		"string": StringEncoder[string](),
+		"json":   JSONEncoder[string](""),
+		"hashed": HashedKeyEncoder(func(s string) []byte { return []byte(s) }),
+	})
+	assert.Equal(t, 3, len(stats), "len(stats)")
+
+	assert.Equal(t, "hashed", stats[0].Name, "stats[0].Name")
+	assert.IsError(t, stats[0].Err, ErrHashedKey, "hashed cannot decode")
+
+	assert.Equal(t, "json", stats[1].Name, "stats[1].Name")
+	assert.NoError(t, stats[1].Err, "json")
+	assert.Equal(t, 7, stats[1].Size, "json size")
+
+	assert.Equal(t, "string", stats[2].Name, "stats[2].Name")
+	assert.NoError(t, stats[2].Err, "string")
+	assert.Equal(t, 5, stats[2].Size, "string size")
+	assert.True(t, stats[2].EncodeTime > 0, "string EncodeTime")
+	assert.True(t, stats[2].DecodeTime > 0, "string DecodeTime")
+}
+
+func TestCBOREncoderWithTags(t *testing.T) {
+	type decimal struct {
+		_        struct{} `cbor:",toarray"`
+		Exponent int
+		Mantissa int
+	}
+
+	tags := cbor.NewTagSet()
+	err := tags.Add(
+		cbor.TagOptions{EncTag: cbor.EncTagRequired, DecTag: cbor.DecTagRequired},
+		reflect.TypeOf(decimal{}),
+		4, // RFC 8949 decimal fraction
+	)
+	assert.NoError(t, err, "Add tag")
+
+	enc := CBOREncoderWithTags[decimal](tags)
+
+	b, err := enc.Encode(decimal{Exponent: -2, Mantissa: 27315}, nil)
+	assert.NoError(t, err, "Encode")
+	assert.Equal(t, byte(0xc4), b[0], "tag 4 head")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode")
+	assert.Equal(t, decimal{Exponent: -2, Mantissa: 27315}, v, "Decode")
+
+	_, err = enc.Decode(b[1:])
+	assert.Error(t, err, "Decode untagged value with required tag")
+}
+
+func TestUnsafeStringEncoder(t *testing.T) {
+	enc := UnsafeStringEncoder[string]()
+
+	s := strconv.Itoa(123456)
+	b, err := enc.Encode(s, nil)
+	assert.NoError(t, err, "Encode")
+	assert.Equal(t, []byte("123456"), b, "Encode")
+	assert.True(t, unsafe.StringData(s) == &b[0], "Encode does not copy")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode")
+	assert.Equal(t, s, v, "Decode")
+
+	allocs := testing.AllocsPerRun(100, func() { enc.Encode(s, nil) })
+	assert.Equal(t, 0.0, allocs, "Encode allocations")
+}
+
+func TestSniffingEncoder(t *testing.T) {
+	type blob []byte
+
+	enc := SniffingEncoder[blob]()
+
+	b, err := enc.Encode(blob("cbor"), nil)
+	assert.NoError(t, err, "Encode")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode CBOR")
+	assert.Equal(t, blob("cbor"), v, "Decode CBOR")
+
+	raw := []byte{0xff, 0x00, 0x01}
+	v, err = enc.Decode(raw)
+	assert.NoError(t, err, "Decode raw")
+	assert.Equal(t, blob(raw), v, "Decode raw")
+
+	_, err = SniffingEncoder[int]().Decode(raw)
+	assert.Error(t, err, "Decode raw into non-byte type")
+}
+
+func TestSliceEncoder(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	enc := SliceEncoder(JSONEncoder[user](""))
+
+	tests := []struct {
+		name string
+		in   []user
+	}{
+		{"users", []user{{"alice", 30}, {"bob", 25}}},
+		{"empty", []user{}},
+		{"nil", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := enc.Encode(test.in, nil)
+			assert.NoError(t, err, "Encode")
+
+			out, err := enc.Decode(b)
+			assert.NoError(t, err, "Decode")
+			assert.Equal(t, test.in, out, "Decode")
+			assert.Equal(t, test.in == nil, out == nil, "nil is distinct from empty")
+		})
+	}
+
+	b, err := enc.Encode(tests[0].in, nil)
+	assert.NoError(t, err, "Encode")
+	_, err = enc.Decode(b[:len(b)-1])
+	assert.Error(t, err, "Decode truncated")
+}
+
+func TestFuncEncoder(t *testing.T) {
+	enc := FuncEncoder(
+		func(v int) ([]byte, error) { return []byte(strconv.Itoa(v)), nil },
+		func(b []byte) (int, error) { return strconv.Atoi(string(b)) },
+	)
+
+	b, err := enc.Encode(42, nil)
+	assert.NoError(t, err, "Encode")
+	assert.Equal(t, "42", string(b), "Encode")
+
+	v, err := enc.Decode(b)
+	assert.NoError(t, err, "Decode")
+	assert.Equal(t, 42, v, "Decode")
+
+	_, err = enc.Decode([]byte("x"))
+	assert.IsError(t, err, strconv.ErrSyntax, "Decode invalid")
+}
+
+func TestEnumEncoder(t *testing.T) {
+	type state uint8
+
+	stateEnc := EnumEncoder[state]()
+
+	b, err := stateEnc.Encode(3, nil)
+	assert.NoError(t, err, "Encode state")
+	assert.Equal(t, []byte{3}, b, "Encode state")
+
+	s, err := stateEnc.Decode(b)
+	assert.NoError(t, err, "Decode state")
+	assert.Equal(t, state(3), s, "Decode state")
+
+	_, err = stateEnc.Decode([]byte{0, 3})
+	assert.Error(t, err, "Decode wrong size")
+
+	intEnc := EnumEncoder[int16]()
+
+	values := []int16{-32768, -256, -1, 0, 1, 255, 32767}
+	var prev []byte
+	for _, v := range values {
+		b, err := intEnc.Encode(v, nil)
+		assert.NoError(t, err, "Encode %d", v)
+		assert.Equal(t, 2, len(b), "Encode %d size", v)
+		assert.True(t, bytes.Compare(prev, b) < 0, "Encode %d must sort after the previous value", v)
+		prev = b
+
+		d, err := intEnc.Decode(b)
+		assert.NoError(t, err, "Decode %d", v)
+		assert.Equal(t, v, d, "Decode %d", v)
+	}
+}
+
+func TestJSONWithCBORFallbackEncoder(t *testing.T) {
+	enc := JSONWithCBORFallbackEncoder[int]()
+
+	// Every JSON number from 0 to 7 is a single byte that is also a negative
+	// CBOR integer, e.g. "0" is -17.
+	for _, n := range []int{-17, -24, -49, -12555, 0, 7, 80, 91} {
+		b, err := CBOREncoder[int]().Encode(n, nil)
+		assert.NoError(t, err, "Encode CBOR %d", n)
+
+		v, err := enc.Decode(b)
+		assert.NoError(t, err, "Decode CBOR %d", n)
+		assert.Equal(t, n, v, "Decode CBOR %d", n)
+
+		b, err = enc.Encode(n, nil)
+		assert.NoError(t, err, "Encode %d", n)
+
+		v, err = enc.Decode(b)
+		assert.NoError(t, err, "Decode %d", n)
+		assert.Equal(t, n, v, "Decode %d", n)
+	}
+
+	_, err := enc.Decode([]byte{0xFF})
+	assert.Error(t, err, "Decode invalid")
+}
+
+func TestHashedKeyEncoder(t *testing.T) {
+	type tags struct {
+		Tags []string
+	}
+
+	// Tags are a set, so their order does not matter.
+	hash := func(k tags) []byte {
+		tags := append([]string(nil), k.Tags...)
+		sort.Strings(tags)
+		return []byte(strings.Join(tags, "\x00"))
+	}
+
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[tags, int]{
+		Key:   HashedKeyEncoder(hash),
+		Value: CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	assert.NoError(t, m.Store(tags{[]string{"a", "b"}}, 1), "Store a,b")
+	assert.NoError(t, m.Store(tags{[]string{"b", "a"}}, 2), "Store b,a")
+
+	v, ok, err := m.Load(tags{[]string{"a", "b"}})
+	assert.NoError(t, err, "Load a,b")
+	assert.True(t, ok, "Load a,b")
+	assert.Equal(t, 2, v, "equal keys share an entry")
+
+	var n int
+	err = d.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return tx.EachKey(func([]byte) error {
+			n++
+			return nil
+		})
+	})
+	assert.NoError(t, err, "EachKey")
+	assert.Equal(t, 1, n, "number of keys")
+
+	// Keys cannot be decoded, so iterators stop rather than yield zero keys,
+	// and methods that return errors report ErrHashedKey.
+	m.All()(func(tags, int) bool {
+		t.Error("All yielded a pair")
+		return true
+	})
+	m.Keys()(func(tags) bool {
+		t.Error("Keys yielded a key")
+		return true
+	})
+
+	err = m.AllStream(func(tags, int) error { return nil })
+	assert.IsError(t, err, ErrHashedKey, "AllStream")
+
+	err = m.View(func(r MapReader[tags, int]) error {
+		return r.EachKey(func(tags) error { return nil })
+	})
+	assert.IsError(t, err, ErrHashedKey, "EachKey")
+}
@@ -0,0 +1,53 @@
+package persist
+
+import "errors"
+
+// MapsEqual reports whether a and b hold the same keys with equal values as
+// reported by eq. It stops at the first difference. This is useful for
+// verifying that a backup was restored or a map was migrated correctly, see
+// [CopyMap].
+//
+// Each map is read within a single read-only transaction, and both
+// transactions are open at the same time, so a and b must not share the same
+// driver.
+func MapsEqual[K comparable, V any](a, b Map[K, V], eq func(V, V) bool) (bool, error) {
+	if a.driver == nil || b.driver == nil {
+		return false, ErrNotInitialized
+	}
+
+	equal := true
+	err := a.View(func(ra MapReader[K, V]) error {
+		return b.View(func(rb MapReader[K, V]) error {
+			var n int
+			err := ra.Each(func(k K, va V) error {
+				vb, ok, err := rb.Get(k)
+				if err != nil {
+					return err
+				}
+				if !ok || !eq(va, vb) {
+					equal = false
+					return driverStopIteration
+				}
+				n++
+				return nil
+			})
+			if err != nil || !equal {
+				return err
+			}
+
+			// Every key in a is in b, so the maps are equal if b has no
+			// other keys.
+			return rb.EachKey(func(K) error {
+				if n--; n < 0 {
+					equal = false
+					return driverStopIteration
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil && !errors.Is(err, driverStopIteration) {
+		return false, err
+	}
+	return equal, nil
+}
@@ -0,0 +1,300 @@
+package persist
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// indexKeyPrefix is the prefix of all index entries written by [IndexedMap].
+// It lives inside the reserved key namespace, so the entries are hidden from
+// the primary map's iterators. Each index adds its length-prefixed name.
+const indexKeyPrefix = reservedKeyPrefix + "index\x00"
+
+// IndexedMap is a Map that maintains a secondary index from a value derived
+// from each stored value to the keys of the values that produced it. The index
+// is stored in the same driver as the primary map, and both are always
+// written within the same transaction.
+//
+// Several indexes may be kept over a single database as long as they are
+// named differently using [NewNamedIndexedMap]. Writes made to the primary map
+// directly, or through another IndexedMap, are not indexed until the next call
+// to [IndexedMap.Reindex]. Entries left stale by such writes are skipped by
+// [IndexedMap.LookupByIndex].
+type IndexedMap[IK, K, V any] struct {
+	primary   Map[K, V]
+	ikencoder Encoder[IK]
+	indexFn   func(V) IK
+	prefix    []byte
+}
+
+// NewIndexedMap returns a new IndexedMap wrapping the given primary map.
+// The index keys are encoded using the default CBOR encoder. The index is
+// rebuilt from the primary map's current contents before returning.
+//
+// It is equivalent to calling [NewNamedIndexedMap] with an empty name.
+func NewIndexedMap[IK, K, V any](primary Map[K, V], indexFn func(V) IK) (IndexedMap[IK, K, V], error) {
+	return NewNamedIndexedMap(primary, "", indexFn)
+}
+
+// NewNamedIndexedMap is like [NewIndexedMap], except the index entries are
+// stored under the given name, so that other indexes over the same database
+// are left alone.
+func NewNamedIndexedMap[IK, K, V any](primary Map[K, V], name string, indexFn func(V) IK) (IndexedMap[IK, K, V], error) {
+	prefix := make([]byte, 0, len(indexKeyPrefix)+binary.MaxVarintLen64+len(name))
+	prefix = append(prefix, indexKeyPrefix...)
+	prefix = binary.AppendUvarint(prefix, uint64(len(name)))
+	prefix = append(prefix, name...)
+
+	m := IndexedMap[IK, K, V]{
+		primary:   primary,
+		ikencoder: CBOREncoder[IK](),
+		indexFn:   indexFn,
+		prefix:    prefix,
+	}
+	if err := m.Reindex(); err != nil {
+		return IndexedMap[IK, K, V]{}, err
+	}
+	return m, nil
+}
+
+// Map returns the primary map.
+func (m IndexedMap[IK, K, V]) Map() Map[K, V] {
+	return m.primary
+}
+
+// Reindex drops all entries of this index and rebuilds them from the primary
+// map. Other indexes over the same database are left alone.
+func (m IndexedMap[IK, K, V]) Reindex() error {
+	if m.primary.driver == nil {
+		return ErrNotInitialized
+	}
+
+	return txError(m.primary.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		var stale [][]byte
+		var fresh [][]byte
+
+		err := eachPrefix(tx, m.prefix, func(k, _ []byte) error {
+			stale = append(stale, bytes.Clone(k))
+			return nil
+		})
+		if err != nil {
+			return &DriverError{"get index", err}
+		}
+
+		err = tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+
+			v, err := m.primary.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+
+			ik, err := m.indexKey(m.indexFn(v), bk)
+			if err != nil {
+				return err
+			}
+
+			fresh = append(fresh, ik)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := tx.Delete(k); err != nil {
+				return &DriverError{"delete index", err}
+			}
+		}
+		for _, k := range fresh {
+			if err := tx.Set(k, nil); err != nil {
+				return &DriverError{"set index", err}
+			}
+		}
+
+		return nil
+	}))
+}
+
+// Store sets a key-value pair and updates the index.
+func (m IndexedMap[IK, K, V]) Store(k K, v V) error {
+	if m.primary.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bk, err := m.primary.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := m.primary.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := m.primary.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	ik, err := m.indexKey(m.indexFn(v), bk)
+	if err != nil {
+		return err
+	}
+
+	err = m.primary.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := m.deleteIndex(tx, bk); err != nil {
+			return err
+		}
+		if err := m.primary.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		if err := tx.Set(bk, bv); err != nil {
+			return &DriverError{"set value", err}
+		}
+		return driverError("set index", tx.Set(ik, nil))
+	})
+	return txError(err)
+}
+
+// Load gets a value by key.
+func (m IndexedMap[IK, K, V]) Load(k K) (V, bool, error) {
+	return m.primary.Load(k)
+}
+
+// Delete deletes a key-value pair and its index entry.
+func (m IndexedMap[IK, K, V]) Delete(k K) error {
+	if m.primary.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bk, err := m.primary.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	return txError(m.primary.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := m.deleteIndex(tx, bk); err != nil {
+			return err
+		}
+		if err := m.primary.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("delete value", tx.Delete(bk))
+	}))
+}
+
+// LookupByIndex returns all values whose index value encodes to the same
+// bytes as ik. Only the index entries for ik are visited if the driver can seek
+// to them; see [DriverPrefixTx].
+func (m IndexedMap[IK, K, V]) LookupByIndex(ik IK) ([]V, error) {
+	if m.primary.driver == nil {
+		return nil, ErrNotInitialized
+	}
+
+	prefix, err := m.indexKey(ik, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []V
+	err = m.primary.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		values = nil
+
+		var bks [][]byte
+		err := eachPrefix(tx, prefix, func(k, _ []byte) error {
+			bks = append(bks, bytes.Clone(k[len(prefix):]))
+			return nil
+		})
+		if err != nil {
+			return &DriverError{"get index", err}
+		}
+
+		for _, bk := range bks {
+			bv, ok, err := tx.Get(bk)
+			if err != nil {
+				return &DriverError{"get value", err}
+			}
+			if !ok {
+				continue
+			}
+
+			v, err := m.primary.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+
+			// The entry is stale if the value was changed without going
+			// through this index.
+			current, err := m.indexKey(m.indexFn(v), nil)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(current, prefix) {
+				continue
+			}
+
+			values = append(values, v)
+		}
+
+		return nil
+	})
+	return values, txError(err)
+}
+
+// All returns an iterator over all key-value pairs in the primary map.
+func (m IndexedMap[IK, K, V]) All() Seq2[K, V] {
+	return m.primary.All()
+}
+
+// Keys returns an iterator over all keys in the primary map.
+func (m IndexedMap[IK, K, V]) Keys() Seq[K] {
+	return m.primary.Keys()
+}
+
+// Close closes the primary map.
+func (m IndexedMap[IK, K, V]) Close() error {
+	return m.primary.Close()
+}
+
+// deleteIndex deletes the index entry of the value currently stored at bk, if
+// any.
+func (m IndexedMap[IK, K, V]) deleteIndex(tx DriverReadWriteTx, bk []byte) error {
+	bv, ok, err := tx.Get(bk)
+	if err != nil {
+		return &DriverError{"get value", err}
+	}
+	if !ok {
+		return nil
+	}
+
+	old, err := m.primary.valueEncoder(bk).Decode(bv)
+	if err != nil {
+		return &EncodeError{"decode value", err}
+	}
+
+	ik, err := m.indexKey(m.indexFn(old), bk)
+	if err != nil {
+		return err
+	}
+
+	return driverError("delete index", tx.Delete(ik))
+}
+
+// indexKey returns the driver key of the index entry mapping ik to the
+// primary key bk. The encoded index value is length-prefixed so that no index
+// value can be a prefix of another.
+func (m IndexedMap[IK, K, V]) indexKey(ik IK, bk []byte) ([]byte, error) {
+	bik, err := m.ikencoder.Encode(ik, nil)
+	if err != nil {
+		return nil, &EncodeError{"encode index", err}
+	}
+
+	b := make([]byte, 0, len(m.prefix)+binary.MaxVarintLen64+len(bik)+len(bk))
+	b = append(b, m.prefix...)
+	b = binary.AppendUvarint(b, uint64(len(bik)))
+	b = append(b, bik...)
+	b = append(b, bk...)
+	return b, nil
+}
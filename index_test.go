@@ -0,0 +1,126 @@
+package persist
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestIndexedMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, testStruct](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	err = m.Store("a", testStruct{Data: "x", Int: 1})
+	assert.NoError(t, err, "Store before index")
+
+	im, err := NewIndexedMap(m, func(v testStruct) string { return v.Data })
+	assert.NoError(t, err, "NewIndexedMap")
+
+	err = im.Store("b", testStruct{Data: "x", Int: 2})
+	assert.NoError(t, err, "Store b")
+
+	err = im.Store("c", testStruct{Data: "y", Int: 3})
+	assert.NoError(t, err, "Store c")
+
+	assertLookup := func(ik string, expect ...int) {
+		t.Helper()
+
+		vs, err := im.LookupByIndex(ik)
+		assert.NoError(t, err, "LookupByIndex")
+
+		ints := make([]int, 0, len(vs))
+		for _, v := range vs {
+			ints = append(ints, v.Int)
+		}
+		sort.Ints(ints)
+
+		assert.Equal(t, expect, ints, "LookupByIndex %q", ik)
+	}
+
+	assertLookup("x", 1, 2)
+	assertLookup("y", 3)
+
+	err = im.Store("b", testStruct{Data: "y", Int: 2})
+	assert.NoError(t, err, "Store b again")
+
+	assertLookup("x", 1)
+	assertLookup("y", 2, 3)
+
+	err = im.Delete("c")
+	assert.NoError(t, err, "Delete c")
+
+	assertLookup("y", 2)
+
+	var keys []string
+	im.Keys()(func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+	assert.Equal(t, []string{"a", "b"}, keys, "Keys")
+}
+
+func TestIndexedMapDropsMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, testStruct](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	m = m.WithMetadata()
+
+	im, err := NewIndexedMap(m, func(v testStruct) string { return v.Data })
+	assert.NoError(t, err, "NewIndexedMap")
+
+	err = m.StoreWithMeta("a", testStruct{Data: "x", Int: 1}, []byte("text/plain"))
+	assert.NoError(t, err, "StoreWithMeta a")
+
+	err = im.Store("a", testStruct{Data: "x", Int: 2})
+	assert.NoError(t, err, "Store a")
+
+	v, meta, ok, err := m.LoadWithMeta("a")
+	assert.NoError(t, err, "LoadWithMeta a")
+	assert.True(t, ok, "LoadWithMeta a")
+	assert.Equal(t, 2, v.Int, "LoadWithMeta a value")
+	assert.Zero(t, meta, "LoadWithMeta a meta after Store")
+
+	err = m.StoreWithMeta("b", testStruct{Data: "y", Int: 3}, []byte("text/plain"))
+	assert.NoError(t, err, "StoreWithMeta b")
+
+	err = im.Delete("b")
+	assert.NoError(t, err, "Delete b")
+
+	bk, err := m.kencoder.Encode("b", nil)
+	assert.NoError(t, err, "encode b")
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		_, ok, err := tx.Get(metaKey(bk))
+		assert.False(t, ok, "metadata of b after Delete")
+		return err
+	})
+	assert.NoError(t, err, "get metadata of b")
+}
+
+func TestIndexedMapNotInitialized(t *testing.T) {
+	var im IndexedMap[string, string, testStruct]
+
+	err := im.Store("a", testStruct{Data: "x"})
+	assert.IsError(t, err, ErrNotInitialized, "Store")
+
+	_, _, err = im.Load("a")
+	assert.IsError(t, err, ErrNotInitialized, "Load")
+
+	err = im.Delete("a")
+	assert.IsError(t, err, ErrNotInitialized, "Delete")
+
+	_, err = im.LookupByIndex("x")
+	assert.IsError(t, err, ErrNotInitialized, "LookupByIndex")
+
+	err = im.Reindex()
+	assert.IsError(t, err, ErrNotInitialized, "Reindex")
+}
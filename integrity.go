@@ -0,0 +1,69 @@
+package persist
+
+import "bytes"
+
+// IntegrityReport is the result of [Map.CheckIntegrity].
+type IntegrityReport struct {
+	// Checked is the number of key-value pairs that were checked.
+	Checked int
+	// Failures lists the pairs that failed to decode, in the order they were
+	// visited.
+	Failures []IntegrityFailure
+}
+
+// OK reports whether all pairs decoded successfully.
+func (r IntegrityReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+// IntegrityFailure is a key-value pair that failed to decode.
+type IntegrityFailure struct {
+	// Key is the encoded key, since it may not decode.
+	Key []byte
+	// Err is an [*EncodeError] describing whether the key or the value failed
+	// to decode.
+	Err error
+}
+
+// CheckIntegrity tries to decode every key and value in the map using the
+// map's encoders within a single read-only transaction, e.g. to verify a
+// database that was recovered after a crash. Pairs that fail to decode are
+// collected in the report rather than stopping the check. The returned error
+// is only non-nil if the map could not be read.
+func (m Map[K, V]) CheckIntegrity() (IntegrityReport, error) {
+	if m.driver == nil {
+		return IntegrityReport{}, ErrNotInitialized
+	}
+
+	var report IntegrityReport
+
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		report = IntegrityReport{}
+		return tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+			report.Checked++
+
+			var err error
+			if _, derr := m.kencoder.Decode(bk); derr != nil {
+				err = &EncodeError{"decode key", derr}
+			} else if _, derr := m.valueEncoder(bk).Decode(bv); derr != nil {
+				err = &EncodeError{"decode value", derr}
+			}
+
+			if err != nil {
+				report.Failures = append(report.Failures, IntegrityFailure{
+					Key: bytes.Clone(bk),
+					Err: err,
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return IntegrityReport{}, txError(err)
+	}
+
+	return report, nil
+}
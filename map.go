@@ -1,9 +1,24 @@
 package persist
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 )
 
+// reservedKeyPrefix is the prefix of all keys that are used internally by the
+// package, such as index entries. Keys with this prefix are skipped by the
+// Map iterators. The leading 0xFF byte is never the start of a valid CBOR item
+// nor of a valid UTF-8 string, so it cannot collide with keys produced by the
+// default encoders.
+const reservedKeyPrefix = "\xffpersist\x00"
+
+func isReservedKey(k []byte) bool {
+	return bytes.HasPrefix(k, []byte(reservedKeyPrefix))
+}
+
 // Seq2 is an iterator over a map that yields key-value pairs.
 // It is inspired by https://github.com/golang/go/issues/61897.
 type Seq2[K, V any] func(yield func(K, V) bool)
@@ -19,10 +34,154 @@ type EncoderPair[K, V any] struct {
 }
 
 // Map is a type-safe map that persists to disk.
+//
+// Map is a small value type and is meant to be passed around by value. Copying
+// a Map shares its underlying driver, so all copies observe the same data and
+// closing one closes them all. Methods such as [Map.WithMaxValueSize] rely on
+// this to return configured copies of the same map.
+//
+// A Map is safe for concurrent use by multiple goroutines, as are its copies,
+// provided that its encoders are; all bundled encoders are. Every method runs
+// within one or more driver transactions, and all bundled drivers serialize
+// read-write transactions and isolate them from concurrent read-only ones.
+// Methods that are made of several transactions, such as [Map.StoreMany] with
+// [Map.WithStoreManyChunkSize], are not atomic as a whole.
 type Map[K, V any] struct {
 	driver   Driver
 	kencoder Encoder[K]
 	vencoder Encoder[V]
+	// voverrides are value encoders that override vencoder for keys with a
+	// certain encoded prefix. It is never mutated in place, so copies of Map
+	// may share it.
+	voverrides []valueEncoderOverride[V]
+	// maxKeySize and maxValueSize limit the size of written keys and values.
+	// 0 means no limit.
+	maxKeySize   int
+	maxValueSize int
+	// chunkSize is the maximum number of pairs that StoreMany writes per
+	// transaction. 0 means no limit.
+	chunkSize int
+	// skipUnchanged makes Store skip writing values whose encoded bytes are
+	// identical to the stored ones.
+	skipUnchanged bool
+	// keyCollisionCheck makes Store check that an existing key decodes to the
+	// key being stored.
+	keyCollisionCheck bool
+	// metadata makes every write maintain the sidecar metadata written by
+	// StoreWithMeta.
+	metadata bool
+}
+
+// ErrNotInitialized is returned by the methods of a zero Map, i.e. one that was
+// not created using a constructor such as [NewMap].
+var ErrNotInitialized = errors.New("persist: map not initialized")
+
+// ErrKeyTooLarge is returned when writing a key whose encoded size exceeds the
+// limit set by [Map.WithMaxKeySize].
+var ErrKeyTooLarge = errors.New("persist: key too large")
+
+// ErrNotFound is returned by [Map.Get] when the key does not exist, and by
+// openers such as [CBORDriverExisting] when the database does not exist.
+var ErrNotFound = errors.New("persist: not found")
+
+// ErrKeyExists is returned by [Map.RemapKeys] when a key would be moved onto a
+// key that is taken.
+var ErrKeyExists = errors.New("persist: key already exists")
+
+// StopIteration may be returned by the function given to an iterating method,
+// such as [MapReader.Each], [Map.UpdateAll] or [Reduce], to stop iterating
+// early. Unlike other errors, it is not returned by the method, and it does
+// not cause anything to be rolled back.
+var StopIteration = errors.New("persist: stop iteration")
+
+// ErrValueTooLarge is returned when writing a value whose encoded size exceeds
+// the limit set by [Map.WithMaxValueSize].
+var ErrValueTooLarge = errors.New("persist: value too large")
+
+// BatchError is returned by [Map.StoreMany] when a single pair in the batch
+// fails. It identifies the pair by its key and its index in the batch.
+type BatchError[K any] struct {
+	Index int
+	Key   K
+	Err   error
+}
+
+func (e *BatchError[K]) Error() string {
+	return fmt.Sprintf("batch pair %d (key %v): %v", e.Index, e.Key, e.Err)
+}
+
+func (e *BatchError[K]) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError is returned by Map methods when a key or value cannot be encoded
+// or decoded. It is caused by the data itself, so retrying will not help.
+type EncodeError struct {
+	// Op is the failed operation, e.g. "encode key" or "decode value".
+	Op  string
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// DriverError is returned by Map methods when the driver fails, e.g. because
+// the disk is full or the transaction conflicted. Unlike an [EncodeError], it
+// may be worth retrying the operation.
+type DriverError struct {
+	// Op is the failed operation, e.g. "get value" or "transaction".
+	Op  string
+	Err error
+}
+
+func (e *DriverError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
+
+// driverError wraps a non-nil err returned by the driver for op in a
+// DriverError.
+func driverError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DriverError{op, err}
+}
+
+// txError classifies an error returned by acquiring a transaction. Errors that
+// were already classified within the transaction, as well as size errors, are
+// returned as-is, while anything else, e.g. a failed commit, is a DriverError.
+func txError(err error) error {
+	var encodeErr *EncodeError
+	var driverErr *DriverError
+	switch {
+	case err == nil,
+		errors.As(err, &encodeErr),
+		errors.As(err, &driverErr),
+		errors.Is(err, ErrKeyTooLarge),
+		errors.Is(err, ErrValueTooLarge),
+		errors.Is(err, ErrKeyExists):
+		return err
+	}
+	return &DriverError{"transaction", err}
+}
+
+// ErrTxTooLarge is returned by drivers when a read-write transaction grows
+// beyond what the driver can commit at once. Drivers should wrap their own
+// error with it so that callers such as [Map.StoreMany] can react to it.
+var ErrTxTooLarge = errors.New("persist: transaction too large")
+
+type valueEncoderOverride[V any] struct {
+	prefix  []byte
+	encoder Encoder[V]
 }
 
 // NewMap returns a new Map using the default CBOR encoder and a provided
@@ -40,8 +199,8 @@ func NewMap[K, V any](driverOpener DriverOpenFunc, path string) (Map[K, V], erro
 }
 
 // NewMapFromEncoders returns a new Map from a pair of encoders.
-func NewMapFromEncoders[K, V any](driver Driver, encs EncoderPair[K, V]) *Map[K, V] {
-	return &Map[K, V]{
+func NewMapFromEncoders[K, V any](driver Driver, encs EncoderPair[K, V]) Map[K, V] {
+	return Map[K, V]{
 		driver:   driver,
 		kencoder: encs.Key,
 		vencoder: encs.Value,
@@ -56,157 +215,1331 @@ func (m Map[K, V]) Encoder() EncoderPair[K, V] {
 	}
 }
 
-// Store sets a key-value pair.
-func (m Map[K, V]) Store(k K, v V) error {
-	bk, err := m.kencoder.Encode(k, nil)
+// WithValueEncoderFor returns a copy of the map that uses enc to encode and
+// decode the values of all keys whose encoded form starts with the encoded form
+// of prefix. If multiple prefixes match, the longest one wins.
+//
+// Note that the prefix is matched on the encoded bytes, so this is mostly
+// useful with key encoders that preserve prefixes, such as [StringEncoder] or
+// [BytesEncoder]. CBOR-encoded strings, for example, are length-prefixed, so
+// a shorter string is never a prefix of a longer one.
+func (m Map[K, V]) WithValueEncoderFor(prefix K, enc Encoder[V]) (Map[K, V], error) {
+	if m.driver == nil {
+		return m, ErrNotInitialized
+	}
+
+	bprefix, err := m.kencoder.Encode(prefix, nil)
+	if err != nil {
+		return m, fmt.Errorf("encode key prefix: %w", err)
+	}
+
+	overrides := make([]valueEncoderOverride[V], len(m.voverrides), len(m.voverrides)+1)
+	copy(overrides, m.voverrides)
+	overrides = append(overrides, valueEncoderOverride[V]{
+		prefix:  bytes.Clone(bprefix),
+		encoder: enc,
+	})
+
+	m.voverrides = overrides
+	return m, nil
+}
+
+// WithMaxKeySize returns a copy of the map that refuses to write keys that are
+// larger than n bytes once encoded. Such writes fail with [ErrKeyTooLarge]
+// before anything is written. n <= 0 means no limit.
+func (m Map[K, V]) WithMaxKeySize(n int) Map[K, V] {
+	m.maxKeySize = n
+	return m
+}
+
+// WithMaxValueSize returns a copy of the map that refuses to write values that
+// are larger than n bytes once encoded. Such writes fail with
+// [ErrValueTooLarge] before anything is written. n <= 0 means no limit.
+func (m Map[K, V]) WithMaxValueSize(n int) Map[K, V] {
+	m.maxValueSize = n
+	return m
+}
+
+// WithStoreManyChunkSize returns a copy of the map whose [Map.StoreMany]
+// writes at most n pairs per transaction. n <= 0 means no limit, which is the
+// default.
+func (m Map[K, V]) WithStoreManyChunkSize(n int) Map[K, V] {
+	m.chunkSize = n
+	return m
+}
+
+// WithSkipUnchangedWrites returns a copy of the map whose [Map.Store] first
+// reads the stored value and skips the write if its encoded bytes are identical
+// to the new ones. This costs a read, but avoids a write along with its
+// conflict risk when the value does not change.
+//
+// This only works if the value encoders are deterministic. Value encoders
+// created by [CBOREncoder], including the default one, are therefore replaced
+// with [CanonicalCBOREncoder], which reads the same data.
+func (m Map[K, V]) WithSkipUnchangedWrites() Map[K, V] {
+	m.skipUnchanged = true
+	m.vencoder = canonicalize(m.vencoder)
+
+	overrides := make([]valueEncoderOverride[V], len(m.voverrides))
+	for i, o := range m.voverrides {
+		overrides[i] = valueEncoderOverride[V]{o.prefix, canonicalize(o.encoder)}
+	}
+	m.voverrides = overrides
+
+	return m
+}
+
+// WithKeyCollisionCheck returns a copy of the map whose [Map.Store] checks that
+// overwriting an existing key does not silently replace the value of a
+// different key that happens to encode to the same bytes. The existing key is
+// decoded and compared to the key being stored using [reflect.DeepEqual]; if
+// they differ, then nothing is stored and a [*KeyCollisionError] is returned.
+//
+// This is meant for debugging key encoders that are not deterministic or that
+// lose information, e.g. CBOR-encoded structs with unexported fields. It costs
+// a read and a decode for every Store. Note that keys that do not survive a
+// round trip through the encoder unchanged are always reported, even if they
+// are the same key.
+func (m Map[K, V]) WithKeyCollisionCheck() Map[K, V] {
+	m.keyCollisionCheck = true
+	return m
+}
+
+// KeyCollisionError is returned by [Map.Store] on maps created using
+// [Map.WithKeyCollisionCheck] when a key encodes to the same bytes as a
+// different existing key.
+type KeyCollisionError[K any] struct {
+	Key      K
+	Existing K
+}
+
+func (e *KeyCollisionError[K]) Error() string {
+	return fmt.Sprintf("persist: key %v collides with existing key %v", e.Key, e.Existing)
+}
+
+// checkKeyCollision returns a KeyCollisionError if bk exists in tx and decodes
+// to a key other than k.
+func (m Map[K, V]) checkKeyCollision(tx DriverReadOnlyTx, k K, bk []byte) error {
+	_, ok, err := tx.Get(bk)
+	if err != nil {
+		return &DriverError{"get value", err}
+	}
+	if !ok {
+		return nil
+	}
+
+	existing, err := m.kencoder.Decode(bk)
 	if err != nil {
-		return fmt.Errorf("encode key: %w", err)
+		return &EncodeError{"decode key", err}
+	}
+	if !reflect.DeepEqual(existing, k) {
+		return &KeyCollisionError[K]{k, existing}
+	}
+	return nil
+}
+
+// canonicalize returns the canonical version of enc if it is a CBOR encoder.
+func canonicalize[V any](enc Encoder[V]) Encoder[V] {
+	if _, ok := enc.(cborEncoder[V]); ok {
+		return CanonicalCBOREncoder[V]()
+	}
+	return enc
+}
+
+// checkSize returns an error if the encoded key or value exceed the limits
+// set by WithMaxKeySize and WithMaxValueSize.
+func (m Map[K, V]) checkSize(bk, bv []byte) error {
+	if m.maxKeySize > 0 && len(bk) > m.maxKeySize {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrKeyTooLarge, len(bk), m.maxKeySize)
+	}
+	if m.maxValueSize > 0 && len(bv) > m.maxValueSize {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrValueTooLarge, len(bv), m.maxValueSize)
+	}
+	return nil
+}
+
+// valueEncoder returns the value encoder to use for the given encoded key.
+func (m Map[K, V]) valueEncoder(bk []byte) Encoder[V] {
+	enc := m.vencoder
+	matched := -1
+	for _, o := range m.voverrides {
+		if len(o.prefix) > matched && bytes.HasPrefix(bk, o.prefix) {
+			enc = o.encoder
+			matched = len(o.prefix)
+		}
+	}
+	return enc
+}
+
+// EncodedSize returns the size in bytes that v would be stored as, without
+// writing anything. This allows enforcing quotas before storing. v is encoded
+// using the map's default value encoder; use [Map.EncodedSizeFor] if
+// [Map.WithValueEncoderFor] may pick a different encoder for the key.
+func (m Map[K, V]) EncodedSize(v V) (int, error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
 	}
 
 	bv, err := m.vencoder.Encode(v, nil)
 	if err != nil {
-		return fmt.Errorf("encode value: %w", err)
+		return 0, &EncodeError{"encode value", err}
 	}
 
-	return m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
-		return tx.Set(bk, bv)
-	})
+	return len(bv), nil
 }
 
-// Load gets a value by key.
-func (m Map[K, V]) Load(k K) (V, bool, error) {
-	var v V
-	var ok bool
+// EncodedSizeFor is like [Map.EncodedSize], except v is encoded using the
+// value encoder that would be used for k. The size of the key itself is not
+// included.
+func (m Map[K, V]) EncodedSizeFor(k K, v V) (int, error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
+	}
 
 	bk, err := m.kencoder.Encode(k, nil)
 	if err != nil {
-		return v, false, fmt.Errorf("encode key: %w", err)
+		return 0, &EncodeError{"encode key", err}
 	}
 
-	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
-		var bv []byte
-		bv, ok, err = tx.Get(bk)
-		if err != nil {
-			return fmt.Errorf("get value: %w", err)
+	bv, err := m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return 0, &EncodeError{"encode value", err}
+	}
+
+	return len(bv), nil
+}
+
+// Store sets a key-value pair.
+func (m Map[K, V]) Store(k K, v V) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := m.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if m.keyCollisionCheck {
+			if err := m.checkKeyCollision(tx, k, bk); err != nil {
+				return err
+			}
 		}
-		if ok {
-			v, err = m.vencoder.Decode(bv)
+		if m.skipUnchanged {
+			old, ok, err := tx.Get(bk)
 			if err != nil {
-				return fmt.Errorf("decode value: %w", err)
+				return &DriverError{"get value", err}
+			}
+			if ok && bytes.Equal(old, bv) {
+				return nil
 			}
 		}
-
-		return nil
+		if err := m.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("set value", tx.Set(bk, bv))
 	})
-	return v, ok, err
+
+	var collisionErr *KeyCollisionError[K]
+	if errors.As(err, &collisionErr) {
+		return err
+	}
+	return txError(err)
 }
 
-// LoadOrStore gets a value by key, or stores a value if the key is not found.
-func (m Map[K, V]) LoadOrStore(k K, v V) (value V, loaded bool, err error) {
-	var bk []byte
+// StoreAndReport sets a key-value pair like [Map.Store] and reports what it
+// replaced. previous and existed are the old value and whether there was one,
+// and changed is true if the key did not exist or its encoded value differed
+// from the new one. Nothing is written if the value is unchanged. This allows
+// emitting change events only when data actually changes.
+func (m Map[K, V]) StoreAndReport(k K, v V) (previous V, existed, changed bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	var bk, bv []byte
+
 	bk, err = m.kencoder.Encode(k, nil)
 	if err != nil {
+		err = &EncodeError{"encode key", err}
+		return
+	}
+
+	bv, err = m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		err = &EncodeError{"encode value", err}
+		return
+	}
+
+	if err = m.checkSize(bk, bv); err != nil {
 		return
 	}
 
 	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
-		bv, ok, err := tx.Get(bk)
+		previous, existed, changed = *new(V), false, true
+
+		if m.keyCollisionCheck {
+			if err := m.checkKeyCollision(tx, k, bk); err != nil {
+				return err
+			}
+		}
+
+		old, ok, err := tx.Get(bk)
 		if err != nil {
-			return fmt.Errorf("get value: %w", err)
+			return &DriverError{"get value", err}
 		}
-		if !ok {
-			bv, err := m.vencoder.Encode(v, nil)
+		if ok {
+			previous, err = m.valueEncoder(bk).Decode(old)
 			if err != nil {
-				return fmt.Errorf("encode value: %w", err)
+				return &EncodeError{"decode value", err}
 			}
-			return tx.Set(bk, bv)
+			existed = true
+			changed = !bytes.Equal(old, bv)
 		}
 
-		v, err = m.vencoder.Decode(bv)
-		if err != nil {
-			return fmt.Errorf("decode value: %w", err)
+		if !changed {
+			return nil
 		}
-
-		value = v
-		loaded = true
-		return nil
+		if err := m.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("set value", tx.Set(bk, bv))
 	})
+
+	var collisionErr *KeyCollisionError[K]
+	if err != nil && !errors.As(err, &collisionErr) {
+		err = txError(err)
+	}
+	if err != nil {
+		previous, existed, changed = *new(V), false, false
+	}
 	return
 }
 
-// LoadAndDelete gets a value by key, or deletes the key if it is not found.
-func (m Map[K, V]) LoadAndDelete(k K) (v V, loaded bool, err error) {
-	var bk []byte
-	bk, err = m.kencoder.Encode(k, nil)
-	if err != nil {
-		return
+// StoreMany sets all key-value pairs yielded by kvs. All pairs are encoded
+// before anything is written, so nothing is written if any of them fail to
+// encode. Errors caused by a single pair are returned as a [*BatchError].
+//
+// The pairs are written in chunks of at most the size set by
+// [Map.WithStoreManyChunkSize], each within its own transaction. If the driver
+// reports that a chunk is too large with [ErrTxTooLarge], then the chunk size
+// is halved and the chunk is retried. This allows arbitrarily large batches to
+// be written, but it means that the batch as a whole is only atomic if it fits
+// in a single chunk: if an error occurs, the chunks already written are kept.
+func (m Map[K, V]) StoreMany(kvs Seq2[K, V]) error {
+	if m.driver == nil {
+		return ErrNotInitialized
 	}
 
-	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
-		bv, ok, err := tx.Get(bk)
+	var ks []K
+	var bks, bvs [][]byte
+	var err error
+
+	kvs(func(k K, v V) bool {
+		var bk, bv []byte
+
+		bk, err = m.kencoder.Encode(k, nil)
 		if err != nil {
-			return fmt.Errorf("get value: %w", err)
+			err = &BatchError[K]{len(bks), k, &EncodeError{"encode key", err}}
+			return false
 		}
-		if !ok {
+
+		bv, err = m.valueEncoder(bk).Encode(v, nil)
+		if err != nil {
+			err = &BatchError[K]{len(bks), k, &EncodeError{"encode value", err}}
+			return false
+		}
+
+		if err = m.checkSize(bk, bv); err != nil {
+			err = &BatchError[K]{len(bks), k, err}
+			return false
+		}
+
+		ks = append(ks, k)
+		bks = append(bks, bk)
+		bvs = append(bvs, bv)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	chunk := m.chunkSize
+	if chunk <= 0 {
+		chunk = len(bks)
+	}
+
+	for i := 0; i < len(bks); {
+		n := min(chunk, len(bks)-i)
+
+		err := m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+			for j := i; j < i+n; j++ {
+				if err := m.dropMeta(tx, bks[j]); err != nil {
+					return &BatchError[K]{j, ks[j], err}
+				}
+				if err := tx.Set(bks[j], bvs[j]); err != nil {
+					return &BatchError[K]{j, ks[j], err}
+				}
+			}
 			return nil
+		})
+		if err != nil {
+			if errors.Is(err, ErrTxTooLarge) && n > 1 {
+				chunk = n / 2
+				continue
+			}
+			return err
 		}
-		loaded = true
 
-		v, err = m.vencoder.Decode(bv)
+		i += n
+	}
+
+	return nil
+}
+
+// Load gets a value by key. The returned bool reports whether the key exists,
+// regardless of the value stored: storing a nil pointer or slice and loading it
+// back yields the nil value and true, while loading a key that was never
+// stored yields the zero value and false.
+func (m Map[K, V]) Load(k K) (V, bool, error) {
+	if m.driver == nil {
+		var z V
+		return z, false, ErrNotInitialized
+	}
+
+	var v V
+	var ok bool
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return v, false, &EncodeError{"encode key", err}
+	}
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		var bv []byte
+		bv, ok, err = tx.Get(bk)
 		if err != nil {
-			return fmt.Errorf("decode value: %w", err)
+			return &DriverError{"get value", err}
+		}
+		if ok {
+			v, err = m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
 		}
 
-		return tx.Delete(bk)
+		return nil
 	})
-	return
+	return v, ok, txError(err)
 }
 
-// Delete deletes a key-value pair.
-func (m Map[K, V]) Delete(k K) error {
+// Contains reports whether a key exists without decoding its value.
+func (m Map[K, V]) Contains(k K) (bool, error) {
+	if m.driver == nil {
+		return false, ErrNotInitialized
+	}
+
 	bk, err := m.kencoder.Encode(k, nil)
 	if err != nil {
-		return fmt.Errorf("encode key: %w", err)
+		return false, &EncodeError{"encode key", err}
 	}
 
-	return m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
-		return tx.Delete(bk)
+	var ok bool
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		_, ok, err = tx.Get(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		return nil
 	})
+	return ok, txError(err)
 }
 
-// Close closes the map. The user must call this function to ensure that the
-// map is properly closed.
-func (m Map[K, V]) Close() error {
-	return m.driver.Close()
+// Get gets a value by key like [Map.Load], except it returns [ErrNotFound] if
+// the key does not exist.
+func (m Map[K, V]) Get(k K) (V, error) {
+	v, ok, err := m.Load(k)
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return v, err
 }
 
-// All returns an iterator over all key-value pairs in the map.
-func (m Map[K, V]) All() Seq2[K, V] {
-	return func(yield func(K, V) bool) {
-		m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
-			return tx.Each(func(bk, bv []byte) error {
-				k, err := m.kencoder.Decode(bk)
-				if err != nil {
-					return fmt.Errorf("decode key: %w", err)
-				}
-				v, err := m.vencoder.Decode(bv)
-				if err != nil {
-					return fmt.Errorf("decode value: %w", err)
-				}
-				if !yield(k, v) {
-					return driverStopIteration
-				}
-				return nil
-			})
-		})
+// LoadOr gets a value by key like [Map.Load], except it returns def if the key
+// does not exist. Use [Map.Get] to handle absence explicitly instead.
+func (m Map[K, V]) LoadOr(k K, def V) (V, error) {
+	v, ok, err := m.Load(k)
+	if err == nil && !ok {
+		v = def
 	}
+	return v, err
 }
 
-// Keys returns an iterator over all keys in the map.
-func (m Map[K, V]) Keys() Seq[K] {
-	return func(yield func(K) bool) {
-		m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
-			return tx.EachKey(func(bk []byte) error {
+// LoadAll gets the values of all given keys within a single transaction. The
+// values of the keys that exist are returned in found, while the keys that do
+// not exist are returned in missing in the order they were given. Duplicate
+// keys are only looked up once.
+//
+// This is a function rather than a method because K must be comparable.
+func LoadAll[K comparable, V any](m Map[K, V], keys []K) (found map[K]V, missing []K, err error) {
+	if m.driver == nil {
+		return nil, nil, ErrNotInitialized
+	}
+
+	bks := make([][]byte, len(keys))
+	for i, k := range keys {
+		bks[i], err = m.kencoder.Encode(k, nil)
+		if err != nil {
+			return nil, nil, &EncodeError{"encode key", err}
+		}
+	}
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		found = make(map[K]V, len(keys))
+		missing = nil
+		seen := make(map[K]struct{}, len(keys))
+
+		for i, k := range keys {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			bv, ok, err := tx.Get(bks[i])
+			if err != nil {
+				return &DriverError{"get value", err}
+			}
+			if !ok {
+				missing = append(missing, k)
+				continue
+			}
+
+			v, err := m.valueEncoder(bks[i]).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+			found[k] = v
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, txError(err)
+	}
+	return found, missing, nil
+}
+
+// ContainsMany reports which of the given keys exist within a single
+// transaction, without decoding any values. Every key is present in the
+// returned map.
+//
+// This is a function rather than a method because K must be comparable.
+func ContainsMany[K comparable, V any](m Map[K, V], keys []K) (map[K]bool, error) {
+	if m.driver == nil {
+		return nil, ErrNotInitialized
+	}
+
+	bks := make([][]byte, len(keys))
+	for i, k := range keys {
+		bk, err := m.kencoder.Encode(k, nil)
+		if err != nil {
+			return nil, &EncodeError{"encode key", err}
+		}
+		bks[i] = bk
+	}
+
+	found := make(map[K]bool, len(keys))
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		for i, k := range keys {
+			if _, ok := found[k]; ok {
+				continue
+			}
+			_, ok, err := tx.Get(bks[i])
+			if err != nil {
+				return &DriverError{"get value", err}
+			}
+			found[k] = ok
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+	return found, nil
+}
+
+// LoadOrdered gets the values of all given keys within a single transaction.
+// The returned slice is aligned with keys, i.e. its i-th element holds the
+// value of keys[i] if it was found. This is useful for loading a list of keys
+// in the order they are displayed.
+func (m Map[K, V]) LoadOrdered(keys []K) ([]Opt[V], error) {
+	if m.driver == nil {
+		return nil, ErrNotInitialized
+	}
+
+	bks := make([][]byte, len(keys))
+	for i, k := range keys {
+		bk, err := m.kencoder.Encode(k, nil)
+		if err != nil {
+			return nil, &EncodeError{"encode key", err}
+		}
+		bks[i] = bk
+	}
+
+	values := make([]Opt[V], len(keys))
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		for i, bk := range bks {
+			bv, ok, err := tx.Get(bk)
+			if err != nil {
+				return &DriverError{"get value", err}
+			}
+			if !ok {
+				values[i] = Opt[V]{}
+				continue
+			}
+
+			v, err := m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+			values[i] = Opt[V]{v, true}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+	return values, nil
+}
+
+// LoadOrStore gets a value by key, or stores a value if the key is not found.
+func (m Map[K, V]) LoadOrStore(k K, v V) (value V, loaded bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	var bk []byte
+	bk, err = m.kencoder.Encode(k, nil)
+	if err != nil {
+		err = &EncodeError{"encode key", err}
+		return
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		value, loaded = v, false
+
+		bv, ok, err := tx.Get(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		if !ok {
+			bv, err := m.valueEncoder(bk).Encode(v, nil)
+			if err != nil {
+				return &EncodeError{"encode value", err}
+			}
+			if err := m.checkSize(bk, bv); err != nil {
+				return err
+			}
+			return driverError("set value", tx.Set(bk, bv))
+		}
+
+		value, err = m.valueEncoder(bk).Decode(bv)
+		if err != nil {
+			return &EncodeError{"decode value", err}
+		}
+
+		loaded = true
+		return nil
+	})
+	err = txError(err)
+	return
+}
+
+// LoadAndDelete gets a value by key, or deletes the key if it is not found.
+func (m Map[K, V]) LoadAndDelete(k K) (v V, loaded bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	var bk []byte
+	bk, err = m.kencoder.Encode(k, nil)
+	if err != nil {
+		err = &EncodeError{"encode key", err}
+		return
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		v, loaded = *new(V), false
+
+		bv, ok, err := tx.Get(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		if !ok {
+			return nil
+		}
+		loaded = true
+
+		v, err = m.valueEncoder(bk).Decode(bv)
+		if err != nil {
+			return &EncodeError{"decode value", err}
+		}
+
+		if err := m.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("delete value", tx.Delete(bk))
+	})
+	err = txError(err)
+	return
+}
+
+// Update atomically updates the value of a key. f is called with the current
+// value and whether it exists, and the value it returns is stored. If f
+// returns an error, then nothing is stored and the error is returned as-is.
+// Note that f may be called more than once if the driver retries the
+// transaction.
+func (m Map[K, V]) Update(k K, f func(v V, ok bool) (V, error)) (V, error) {
+	if m.driver == nil {
+		var z V
+		return z, ErrNotInitialized
+	}
+
+	var v V
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return v, &EncodeError{"encode key", err}
+	}
+
+	// ferr is the error returned by f, which is returned as-is rather than
+	// classified by txError.
+	var ferr error
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		var old V
+		ferr = nil
+
+		bv, ok, err := tx.Get(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		if ok {
+			old, err = m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+		}
+
+		v, err = f(old, ok)
+		if err != nil {
+			ferr = err
+			return err
+		}
+
+		bv, err = m.valueEncoder(bk).Encode(v, nil)
+		if err != nil {
+			return &EncodeError{"encode value", err}
+		}
+
+		if err := m.checkSize(bk, bv); err != nil {
+			return err
+		}
+
+		if err := m.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("set value", tx.Set(bk, bv))
+	})
+	if ferr != nil && errors.Is(err, ferr) {
+		return v, ferr
+	}
+	return v, txError(err)
+}
+
+// Upsert atomically stores v if the key does not exist, or merge(old, v) if it
+// does, and returns the stored value. Note that merge may be called more than
+// once if the driver retries the transaction.
+func (m Map[K, V]) Upsert(k K, v V, merge func(old, new V) V) (result V, err error) {
+	return m.Update(k, func(old V, ok bool) (V, error) {
+		if !ok {
+			return v, nil
+		}
+		return merge(old, v), nil
+	})
+}
+
+// UpdateAll atomically updates every key-value pair in the map within a single
+// transaction. f is called for each pair. If it returns true, then the value
+// it returns is stored, otherwise the pair is deleted. If f returns an error,
+// then nothing is changed and the error is returned as-is. If f returns
+// [StopIteration], then the pairs visited before are updated and the rest are
+// left unchanged.
+//
+// Changes are applied after all pairs have been visited, so f always sees the
+// map as it was before UpdateAll was called.
+func (m Map[K, V]) UpdateAll(f func(k K, v V) (V, bool, error)) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	type change struct {
+		bk []byte
+		bv []byte // nil to delete
+	}
+
+	// ferr is the error returned by f, which is returned as-is rather than
+	// classified by txError.
+	var ferr error
+
+	err := m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		var changes []change
+		ferr = nil
+
+		err := tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+
+			k, err := m.kencoder.Decode(bk)
+			if err != nil {
+				return &EncodeError{"decode key", err}
+			}
+
+			v, err := m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+
+			v, keep, err := f(k, v)
+			if err != nil {
+				if !errors.Is(err, StopIteration) {
+					ferr = err
+				}
+				return err
+			}
+
+			c := change{bk: bytes.Clone(bk)}
+			if keep {
+				c.bv, err = m.valueEncoder(bk).Encode(v, nil)
+				if err != nil {
+					return &EncodeError{"encode value", err}
+				}
+				if err := m.checkSize(bk, c.bv); err != nil {
+					return err
+				}
+			}
+
+			changes = append(changes, c)
+			return nil
+		})
+		if err != nil && !errors.Is(err, StopIteration) {
+			return err
+		}
+
+		for _, c := range changes {
+			if err := m.dropMeta(tx, c.bk); err != nil {
+				return err
+			}
+			if c.bv == nil {
+				err = driverError("delete value", tx.Delete(c.bk))
+			} else {
+				err = driverError("set value", tx.Set(c.bk, c.bv))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if ferr != nil && errors.Is(err, ferr) {
+		return ferr
+	}
+	return txError(err)
+}
+
+// Delete deletes a key-value pair.
+func (m Map[K, V]) Delete(k K) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	return txError(m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := m.dropMeta(tx, bk); err != nil {
+			return err
+		}
+		return driverError("delete value", tx.Delete(bk))
+	}))
+}
+
+// DeletePrefix deletes all key-value pairs whose encoded key starts with the
+// encoded prefix and returns the number of deleted pairs. Like
+// [Map.WithValueEncoderFor], the prefix is matched on the encoded bytes.
+//
+// If the driver implements [DriverPrefixDeleter], then it is used instead,
+// unless it does not support the prefix. Otherwise, all keys are iterated over
+// and deleted within one transaction.
+//
+// Deleting through the driver is not atomic: on maps created using
+// [Map.WithMetadata], the metadata of the values is first dropped within its
+// own transaction. If the driver then fails, the values are left without their
+// metadata.
+func (m Map[K, V]) DeletePrefix(prefix K) (deleted int, err error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	bprefix, err := m.kencoder.Encode(prefix, nil)
+	if err != nil {
+		return 0, &EncodeError{"encode key prefix", err}
+	}
+
+	if d, ok := driverAs[DriverPrefixDeleter](m.driver); ok {
+		if m.metadata {
+			err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+				return m.dropMetaPrefix(tx, bprefix)
+			})
+			if err != nil {
+				return 0, txError(err)
+			}
+		}
+
+		deleted, err = d.DeletePrefix(bprefix)
+		if err == nil {
+			return deleted, nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return deleted, &DriverError{"delete prefix", err}
+		}
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := m.dropMetaPrefix(tx, bprefix); err != nil {
+			return err
+		}
+
+		var bks [][]byte
+		err := tx.EachKey(func(bk []byte) error {
+			if bytes.HasPrefix(bk, bprefix) && !isReservedKey(bk) {
+				bks = append(bks, bytes.Clone(bk))
+			}
+			return nil
+		})
+		if err != nil {
+			return &DriverError{"get keys", err}
+		}
+
+		for _, bk := range bks {
+			if err := tx.Delete(bk); err != nil {
+				return &DriverError{"delete value", err}
+			}
+		}
+
+		deleted = len(bks)
+		return nil
+	})
+	return deleted, txError(err)
+}
+
+// DeleteWhere deletes all key-value pairs for which pred returns true and
+// returns the number of deleted pairs. All pairs are tested and deleted within
+// one read-write transaction, so either all matching pairs are deleted or none
+// are. Unlike [Map.DeletePrefix], every value must be decoded.
+func (m Map[K, V]) DeleteWhere(pred func(K, V) bool) (deleted int, err error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		var bks [][]byte
+		err := tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+
+			k, err := m.kencoder.Decode(bk)
+			if err != nil {
+				return &EncodeError{"decode key", err}
+			}
+
+			v, err := m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+
+			if pred(k, v) {
+				bks = append(bks, bytes.Clone(bk))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, bk := range bks {
+			if err := m.dropMeta(tx, bk); err != nil {
+				return err
+			}
+			if err := tx.Delete(bk); err != nil {
+				return &DriverError{"delete value", err}
+			}
+		}
+
+		deleted = len(bks)
+		return nil
+	})
+	if err != nil {
+		return 0, txError(err)
+	}
+	return deleted, nil
+}
+
+// RemapKeys atomically renames keys within a single transaction. fn is called
+// with every key and returns its new key, or false to leave it as-is. Returns
+// the number of moved pairs.
+//
+// All pairs are moved at once, so keys may be swapped or shifted, e.g. from 1
+// to 2 and from 2 to 3. If a new key is already used by a pair that is not
+// moved, or if more than one key is moved onto the same key, then nothing is
+// changed and an error wrapping [ErrKeyExists] is returned.
+func (m Map[K, V]) RemapKeys(fn func(K) (K, bool)) (remapped int, err error) {
+	if m.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	type move struct {
+		from, to []byte
+		bv       []byte
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		var moves []move
+
+		err := tx.Each(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+
+			k, err := m.kencoder.Decode(bk)
+			if err != nil {
+				return &EncodeError{"decode key", err}
+			}
+
+			nk, ok := fn(k)
+			if !ok {
+				return nil
+			}
+
+			nbk, err := m.kencoder.Encode(nk, nil)
+			if err != nil {
+				return &EncodeError{"encode key", err}
+			}
+			if bytes.Equal(bk, nbk) {
+				return nil
+			}
+
+			bv = bytes.Clone(bv)
+			if len(m.voverrides) > 0 {
+				// The new key may use a different value encoder.
+				v, err := m.valueEncoder(bk).Decode(bv)
+				if err != nil {
+					return &EncodeError{"decode value", err}
+				}
+				bv, err = m.valueEncoder(nbk).Encode(v, nil)
+				if err != nil {
+					return &EncodeError{"encode value", err}
+				}
+			}
+
+			if err := m.checkSize(nbk, bv); err != nil {
+				return err
+			}
+
+			moves = append(moves, move{bytes.Clone(bk), bytes.Clone(nbk), bv})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		moved := make(map[string]struct{}, len(moves))
+		for _, mv := range moves {
+			moved[string(mv.from)] = struct{}{}
+		}
+
+		targets := make(map[string]struct{}, len(moves))
+		for _, mv := range moves {
+			if _, ok := targets[string(mv.to)]; ok {
+				return fmt.Errorf("%w: more than one key is moved onto %q", ErrKeyExists, mv.to)
+			}
+			targets[string(mv.to)] = struct{}{}
+
+			if _, ok := moved[string(mv.to)]; ok {
+				continue
+			}
+			_, ok, err := tx.Get(mv.to)
+			if err != nil {
+				return &DriverError{"get value", err}
+			}
+			if ok {
+				return fmt.Errorf("%w: %q", ErrKeyExists, mv.to)
+			}
+		}
+
+		metas := make([][]byte, len(moves))
+		for i, mv := range moves {
+			var bm []byte
+			var ok bool
+			if m.metadata {
+				bm, ok, err = tx.Get(metaKey(mv.from))
+				if err != nil {
+					return &DriverError{"get metadata", err}
+				}
+			}
+			if ok {
+				metas[i] = bytes.Clone(bm)
+				if err := tx.Delete(metaKey(mv.from)); err != nil {
+					return &DriverError{"delete metadata", err}
+				}
+			}
+			if err := tx.Delete(mv.from); err != nil {
+				return &DriverError{"delete value", err}
+			}
+		}
+		for i, mv := range moves {
+			if err := tx.Set(mv.to, mv.bv); err != nil {
+				return &DriverError{"set value", err}
+			}
+			if metas[i] != nil {
+				if err := tx.Set(metaKey(mv.to), metas[i]); err != nil {
+					return &DriverError{"set metadata", err}
+				}
+			}
+		}
+
+		remapped = len(moves)
+		return nil
+	})
+	if err != nil {
+		return 0, txError(err)
+	}
+	return remapped, nil
+}
+
+// Close closes the map. The user must call this function to ensure that the
+// map is properly closed.
+func (m Map[K, V]) Close() error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	return m.driver.Close()
+}
+
+// CloseContext is like [Map.Close], except that it stops waiting for the
+// driver to close once ctx is done and returns ctx's error. The driver keeps
+// closing in the background. If the driver does not implement
+// [DriverContextCloser], then this is the same as Close.
+func (m Map[K, V]) CloseContext(ctx context.Context) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	if c, ok := driverAs[DriverContextCloser](m.driver); ok {
+		return c.CloseContext(ctx)
+	}
+	return m.driver.Close()
+}
+
+// SaveAs writes a copy of the underlying database to the given path. The
+// driver must implement [DriverSaver], otherwise an error wrapping
+// [errors.ErrUnsupported] is returned.
+func (m Map[K, V]) SaveAs(path string) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	saver, ok := driverAs[DriverSaver](m.driver)
+	if !ok {
+		return fmt.Errorf("persist: driver does not support SaveAs: %w", errors.ErrUnsupported)
+	}
+	return saver.SaveAs(path)
+}
+
+// Compact compacts the underlying database. The driver must implement
+// [DriverCompacter], otherwise an error wrapping [errors.ErrUnsupported] is
+// returned.
+func (m Map[K, V]) Compact() error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	c, ok := driverAs[DriverCompacter](m.driver)
+	if !ok {
+		return fmt.Errorf("persist: driver does not support Compact: %w", errors.ErrUnsupported)
+	}
+	return c.Compact()
+}
+
+// Sync flushes all committed writes to disk. The driver must implement
+// [DriverSyncer], otherwise an error wrapping [errors.ErrUnsupported] is
+// returned.
+func (m Map[K, V]) Sync() error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	s, ok := driverAs[DriverSyncer](m.driver)
+	if !ok {
+		return fmt.Errorf("persist: driver does not support Sync: %w", errors.ErrUnsupported)
+	}
+	return s.Sync()
+}
+
+// All returns an iterator over all key-value pairs in the map.
+func (m Map[K, V]) All() Seq2[K, V] {
+	return m.AllContext(context.Background())
+}
+
+// AllContext is like [Map.All], except iteration stops as soon as ctx is done,
+// releasing the underlying transaction.
+func (m Map[K, V]) AllContext(ctx context.Context) Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if m.driver == nil {
+			return
+		}
+		m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			return m.each(tx, func(k K, v V) error {
+				if ctx.Err() != nil || !yield(k, v) {
+					return driverStopIteration
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// AllLimited is like [Map.All], except that it stops after yielding max pairs.
+// Use it as a guardrail against accidentally scanning huge maps. If max is not
+// positive, then nothing is yielded.
+func (m Map[K, V]) AllLimited(max int) Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if m.driver == nil || max <= 0 {
+			return
+		}
+
+		n := 0
+		m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			return m.each(tx, func(k K, v V) error {
+				n++
+				if !yield(k, v) || n >= max {
+					return driverStopIteration
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// AllStream calls f for each key-value pair in the map, in no particular order.
+// If the driver implements [DriverStreamer], then it is used to scan the map
+// concurrently, which speeds up full scans of very large maps, e.g. for backups
+// or exports. Otherwise, the map is scanned within a single read-only
+// transaction like [Map.All].
+//
+// If f returns an error, then the scan stops and the error is returned as-is,
+// unless it is [StopIteration], in which case nil is returned. Unlike
+// [Map.All], errors from decoding and from the driver are returned as well.
+func (m Map[K, V]) AllStream(f func(k K, v V) error) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	var ferr error
+	call := func(k K, v V) error {
+		if err := f(k, v); err != nil {
+			ferr = err
+			return driverStopIteration
+		}
+		return nil
+	}
+
+	var err error
+	if s, ok := driverAs[DriverStreamer](m.driver); ok {
+		err = s.StreamEach(func(bk, bv []byte) error {
+			if isReservedKey(bk) {
+				return nil
+			}
+			k, err := m.kencoder.Decode(bk)
+			if err != nil {
+				return &EncodeError{"decode key", err}
+			}
+			v, err := m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+			return call(k, v)
+		})
+	} else {
+		err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			return m.each(tx, call)
+		})
+	}
+	if ferr != nil {
+		return ignoreStop(ferr)
+	}
+	return txError(err)
+}
+
+// each calls f for each decoded key-value pair in the transaction, skipping
+// reserved keys. It returns the first error returned by f or by decoding.
+func (m Map[K, V]) each(tx DriverReadOnlyTx, f func(k K, v V) error) error {
+	return tx.Each(func(bk, bv []byte) error {
+		if isReservedKey(bk) {
+			return nil
+		}
+		k, err := m.kencoder.Decode(bk)
+		if err != nil {
+			return &EncodeError{"decode key", err}
+		}
+		v, err := m.valueEncoder(bk).Decode(bv)
+		if err != nil {
+			return &EncodeError{"decode value", err}
+		}
+		return f(k, v)
+	})
+}
+
+// Keys returns an iterator over all keys in the map.
+func (m Map[K, V]) Keys() Seq[K] {
+	return func(yield func(K) bool) {
+		if m.driver == nil {
+			return
+		}
+		m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			return tx.EachKey(func(bk []byte) error {
+				if isReservedKey(bk) {
+					return nil
+				}
 				k, err := m.kencoder.Decode(bk)
 				if err != nil {
 					return fmt.Errorf("decode key: %w", err)
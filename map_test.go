@@ -0,0 +1,1090 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMapWithValueEncoderFor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	driver, err := CBORDriver(path)
+	assert.NoError(t, err, "CBORDriver")
+	defer driver.Close()
+
+	m := NewMapFromEncoders(driver, EncoderPair[string, []byte]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[[]byte](),
+	})
+
+	blobs, err := m.WithValueEncoderFor("blob/", BytesEncoder[[]byte]())
+	assert.NoError(t, err, "WithValueEncoderFor")
+
+	err = blobs.Store("blob/1", []byte("raw"))
+	assert.NoError(t, err, "Store blob")
+
+	err = blobs.Store("other", []byte("cbor"))
+	assert.NoError(t, err, "Store other")
+
+	err = driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		b, ok, err := tx.Get([]byte("blob/1"))
+		assert.NoError(t, err, "Get blob")
+		assert.True(t, ok, "Get blob")
+		assert.Equal(t, []byte("raw"), b, "blob must not be CBOR-wrapped")
+
+		b, ok, err = tx.Get([]byte("other"))
+		assert.NoError(t, err, "Get other")
+		assert.True(t, ok, "Get other")
+		assert.NotEqual(t, []byte("cbor"), b, "other must be CBOR-wrapped")
+		return nil
+	})
+	assert.NoError(t, err, "AcquireRO")
+
+	v, ok, err := blobs.Load("blob/1")
+	assert.NoError(t, err, "Load blob")
+	assert.True(t, ok, "Load blob")
+	assert.Equal(t, []byte("raw"), v, "Load blob")
+
+	v, ok, err = blobs.Load("other")
+	assert.NoError(t, err, "Load other")
+	assert.True(t, ok, "Load other")
+	assert.Equal(t, []byte("cbor"), v, "Load other")
+
+	n, err := blobs.EncodedSize([]byte("raw"))
+	assert.NoError(t, err, "EncodedSize")
+	assert.Equal(t, 4, n, "EncodedSize must include the CBOR head")
+
+	n, err = blobs.EncodedSizeFor("blob/2", []byte("raw"))
+	assert.NoError(t, err, "EncodedSizeFor blob")
+	assert.Equal(t, 3, n, "EncodedSizeFor blob")
+
+	n, err = blobs.EncodedSizeFor("other", []byte("raw"))
+	assert.NoError(t, err, "EncodedSizeFor other")
+	assert.Equal(t, 4, n, "EncodedSizeFor other must include the CBOR head")
+}
+
+func TestMapWithMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	driver, err := CBORDriver(path)
+	assert.NoError(t, err, "CBORDriver")
+	defer driver.Close()
+
+	// "val" encodes to 4 bytes of CBOR.
+	m := NewMapFromEncoders(driver, EncoderPair[string, string]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[string](),
+	}).WithMaxKeySize(4).WithMaxValueSize(4)
+
+	err = m.Store("key", "val")
+	assert.NoError(t, err, "Store within limits")
+
+	err = m.Store("key", "value")
+	assert.IsError(t, err, ErrValueTooLarge, "Store large value")
+
+	err = m.Store("large key", "val")
+	assert.IsError(t, err, ErrKeyTooLarge, "Store large key")
+
+	_, _, err = m.LoadOrStore("new", "value")
+	assert.IsError(t, err, ErrValueTooLarge, "LoadOrStore large value")
+
+	err = m.StoreMany(func(yield func(string, string) bool) {
+		_ = yield("a", "val") && yield("b", "value")
+	})
+	assert.IsError(t, err, ErrValueTooLarge, "StoreMany large value")
+
+	for _, k := range []string{"new", "a", "b"} {
+		_, ok, err := m.Load(k)
+		assert.NoError(t, err, "Load %q", k)
+		assert.False(t, ok, "%q must not be stored", k)
+	}
+
+	v, _, err := m.Load("key")
+	assert.NoError(t, err, "Load key")
+	assert.Equal(t, "val", v, "Load key")
+}
+
+func TestMapAllContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[int, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i := 0; i < 10; i++ {
+		err := m.Store(i, i)
+		assert.NoError(t, err, "Store")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var n int
+	m.AllContext(ctx)(func(int, int) bool {
+		n++
+		if n == 3 {
+			cancel()
+		}
+		return true
+	})
+
+	assert.Equal(t, 3, n, "iteration must stop once ctx is done")
+}
+
+func TestMapUpsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, []string](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	appendTags := func(old, new []string) []string { return append(old, new...) }
+
+	v, err := m.Upsert("tags", []string{"a"}, appendTags)
+	assert.NoError(t, err, "Upsert absent")
+	assert.Equal(t, []string{"a"}, v, "Upsert absent")
+
+	v, err = m.Upsert("tags", []string{"b", "c"}, appendTags)
+	assert.NoError(t, err, "Upsert present")
+	assert.Equal(t, []string{"a", "b", "c"}, v, "Upsert present")
+
+	v, _, err = m.Load("tags")
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, []string{"a", "b", "c"}, v, "Load")
+}
+
+func TestMapView(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	err = m.View(func(r MapReader[string, int]) error {
+		sum := 0
+		err := r.Each(func(k string, v int) error {
+			got, ok, err := r.Get(k)
+			assert.NoError(t, err, "Get")
+			assert.True(t, ok, "Get")
+			assert.Equal(t, v, got, "Get")
+			sum += v
+			return nil
+		})
+		assert.NoError(t, err, "Each")
+		assert.Equal(t, 3, sum, "Each")
+
+		var keys int
+		err = r.EachKey(func(string) error { keys++; return nil })
+		assert.NoError(t, err, "EachKey")
+		assert.Equal(t, 2, keys, "EachKey")
+
+		_, ok, err := r.Get("c")
+		assert.NoError(t, err, "Get c")
+		assert.False(t, ok, "Get c")
+		return nil
+	})
+	assert.NoError(t, err, "View")
+
+	errStop := errors.New("stop")
+	err = m.View(func(r MapReader[string, int]) error {
+		return r.Each(func(string, int) error { return errStop })
+	})
+	assert.IsError(t, err, errStop, "View error")
+}
+
+func TestMapGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	_, err = m.Get("a")
+	assert.IsError(t, err, ErrNotFound, "Get absent")
+
+	assert.NoError(t, m.Store("a", 1), "Store")
+
+	v, err := m.Get("a")
+	assert.NoError(t, err, "Get present")
+	assert.Equal(t, 1, v, "Get present")
+}
+
+// txCounter counts read-write transactions through MetricsHooks.
+type txCounter struct{ rw int }
+
+func (c *txCounter) ObserveTx(mode TxMode, _ time.Duration, _ error) {
+	if mode == TxReadWrite {
+		c.rw++
+	}
+}
+
+func (c *txCounter) ObserveValue(ValueOp, int) {}
+
+func TestMapStoreManyChunkSize(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	var counter txCounter
+	m := NewMapFromEncoders(WithMetrics(d, &counter), EncoderPair[int, int]{
+		Key:   CBOREncoder[int](),
+		Value: CBOREncoder[int](),
+	}).WithStoreManyChunkSize(2)
+	defer m.Close()
+
+	err = m.StoreMany(func(yield func(int, int) bool) {
+		for i := 0; i < 5; i++ {
+			if !yield(i, i*i) {
+				return
+			}
+		}
+	})
+	assert.NoError(t, err, "StoreMany")
+	assert.Equal(t, 3, counter.rw, "transactions")
+
+	for i := 0; i < 5; i++ {
+		v, err := m.Get(i)
+		assert.NoError(t, err, "Get")
+		assert.Equal(t, i*i, v, "Get")
+	}
+}
+
+// stepClock is a Clock that advances by step every time it is read.
+type stepClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *stepClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// txDurations records the durations of transactions through MetricsHooks.
+type txDurations []time.Duration
+
+func (d *txDurations) ObserveTx(_ TxMode, took time.Duration, _ error) {
+	*d = append(*d, took)
+}
+
+func (d *txDurations) ObserveValue(ValueOp, int) {}
+
+func TestWithMetricsClock(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	var durations txDurations
+	clock := &stepClock{time.Unix(0, 0), time.Second}
+
+	m := NewMapFromEncoders(WithMetricsClock(d, &durations, clock), EncoderPair[int, int]{
+		Key:   CBOREncoder[int](),
+		Value: CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	assert.NoError(t, m.Store(1, 1), "Store")
+	_, _, err = m.Load(1)
+	assert.NoError(t, err, "Load")
+
+	assert.Equal(t, txDurations{time.Second, time.Second}, durations, "durations")
+}
+
+// txErrors records the errors of transactions through MetricsHooks.
+type txErrors []error
+
+func (e *txErrors) ObserveTx(_ TxMode, _ time.Duration, err error) {
+	*e = append(*e, err)
+}
+
+func (e *txErrors) ObserveValue(ValueOp, int) {}
+
+func TestWithMetricsStopIteration(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	var errs txErrors
+
+	m := NewMapFromEncoders(WithMetrics(d, &errs), EncoderPair[int, int]{
+		Key:   CBOREncoder[int](),
+		Value: CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	assert.NoError(t, m.Store(1, 1), "Store 1")
+	assert.NoError(t, m.Store(2, 2), "Store 2")
+
+	m.All()(func(int, int) bool { return false })
+
+	err = m.View(func(r MapReader[int, int]) error {
+		return r.Each(func(int, int) error { return StopIteration })
+	})
+	assert.NoError(t, err, "View")
+
+	err = m.UpdateAll(func(_, v int) (int, bool, error) { return v, true, StopIteration })
+	assert.NoError(t, err, "UpdateAll")
+
+	assert.Equal(t, txErrors{nil, nil, nil, nil, nil}, errs, "errors")
+}
+
+func TestValueExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	v, err := NewMustValue[[]byte](CBORDriver, path)
+	assert.NoError(t, err, "NewMustValue")
+	defer v.Close()
+
+	assert.False(t, v.Exists(), "Exists before Store")
+
+	v.Store(nil)
+	assert.True(t, v.Exists(), "Exists after Store")
+
+	v.Delete()
+	assert.False(t, v.Exists(), "Exists after Delete")
+}
+
+func TestLoadAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("c", 3), "Store c")
+
+	found, missing, err := LoadAll(m, []string{"a", "b", "c", "d", "b"})
+	assert.NoError(t, err, "LoadAll")
+	assert.Equal(t, map[string]int{"a": 1, "c": 3}, found, "found")
+	assert.Equal(t, []string{"b", "d"}, missing, "missing")
+}
+
+func TestMapStoreManyBatchError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, any](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	err = m.StoreMany(func(yield func(string, any) bool) {
+		_ = yield("ok", 1) &&
+			yield("bad", func() {}) &&
+			yield("unreached", 3)
+	})
+
+	var batchErr *BatchError[string]
+	assert.True(t, errors.As(err, &batchErr), "errors.As BatchError: %v", err)
+	assert.Equal(t, 1, batchErr.Index, "Index")
+	assert.Equal(t, "bad", batchErr.Key, "Key")
+
+	ok, err := m.Contains("ok")
+	assert.NoError(t, err, "Contains")
+	assert.False(t, ok, "nothing is stored")
+}
+
+func TestMapStats(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, string]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[string](),
+	})
+	defer m.Close()
+
+	s, err := m.Stats()
+	assert.NoError(t, err, "Stats empty")
+	assert.Equal(t, Stats{}, s, "Stats empty")
+
+	// CBOR adds a 1 byte head to short strings.
+	assert.NoError(t, m.Store("a", ""), "Store a")
+	assert.NoError(t, m.Store("bb", "xyz"), "Store bb")
+
+	s, err = m.Stats()
+	assert.NoError(t, err, "Stats")
+	assert.Equal(t, Stats{
+		Count:        2,
+		KeyBytes:     3,
+		ValueBytes:   5,
+		MinValueSize: 1,
+		MaxValueSize: 4,
+		AvgValueSize: 2.5,
+	}, s, "Stats")
+}
+
+func TestMapNotInitialized(t *testing.T) {
+	var m Map[string, int]
+
+	err := m.Store("a", 1)
+	assert.IsError(t, err, ErrNotInitialized, "Store")
+
+	_, _, err = m.Load("a")
+	assert.IsError(t, err, ErrNotInitialized, "Load")
+
+	_, err = m.Get("a")
+	assert.IsError(t, err, ErrNotInitialized, "Get")
+
+	_, err = m.Update("a", func(v int, ok bool) (int, error) { return v + 1, nil })
+	assert.IsError(t, err, ErrNotInitialized, "Update")
+
+	err = m.Delete("a")
+	assert.IsError(t, err, ErrNotInitialized, "Delete")
+
+	err = m.Close()
+	assert.IsError(t, err, ErrNotInitialized, "Close")
+
+	m.All()(func(string, int) bool {
+		t.Error("All yielded a value")
+		return false
+	})
+}
+
+func TestMapCopySharesDriver(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	c := m
+	assert.NoError(t, m.Store("a", 1), "Store")
+
+	v, ok, err := c.Load("a")
+	assert.NoError(t, err, "Load copy")
+	assert.True(t, ok, "copy sees the write")
+	assert.Equal(t, 1, v, "Load copy")
+}
+
+func TestAnyMap(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewAnyMap(d, EncoderPair[any, any]{
+		Key:   CBOREncoder[any](),
+		Value: CBOREncoder[any](),
+	})
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", "hello"), "Store a")
+	assert.NoError(t, m.Store(1, []any{"x", true}), "Store 1")
+
+	v, ok, err := m.Load("a")
+	assert.NoError(t, err, "Load a")
+	assert.True(t, ok, "Load a")
+	assert.Equal(t, any("hello"), v, "Load a")
+
+	v, ok, err = m.Load(1)
+	assert.NoError(t, err, "Load 1")
+	assert.True(t, ok, "Load 1")
+	assert.Equal(t, any([]any{"x", true}), v, "Load 1")
+
+	assert.NoError(t, m.Delete("a"), "Delete a")
+
+	_, ok, err = m.Load("a")
+	assert.NoError(t, err, "Load deleted")
+	assert.False(t, ok, "Load deleted")
+}
+
+func TestMapsEqual(t *testing.T) {
+	newMap := func(kvs map[string]int) Map[string, int] {
+		d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+		assert.NoError(t, err, "CBORDriver")
+		t.Cleanup(func() { d.Close() })
+
+		m := NewMapFromEncoders(d, EncoderPair[string, int]{
+			Key:   StringEncoder[string](),
+			Value: CBOREncoder[int](),
+		})
+		for k, v := range kvs {
+			assert.NoError(t, m.Store(k, v), "Store")
+		}
+		return m
+	}
+
+	eq := func(a, b int) bool { return a == b }
+
+	tests := []struct {
+		name  string
+		a, b  map[string]int
+		equal bool
+	}{
+		{"empty", nil, nil, true},
+		{"same", map[string]int{"a": 1, "b": 2}, map[string]int{"a": 1, "b": 2}, true},
+		{"different value", map[string]int{"a": 1}, map[string]int{"a": 2}, false},
+		{"missing in b", map[string]int{"a": 1, "b": 2}, map[string]int{"a": 1}, false},
+		{"extra in b", map[string]int{"a": 1}, map[string]int{"a": 1, "b": 2}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			equal, err := MapsEqual(newMap(test.a), newMap(test.b), eq)
+			assert.NoError(t, err, "MapsEqual")
+			assert.Equal(t, test.equal, equal, "MapsEqual")
+		})
+	}
+}
+
+func TestMapErrorTypes(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, chan int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[chan int](),
+	})
+
+	var encodeErr *EncodeError
+	err = m.Store("a", make(chan int))
+	assert.True(t, errors.As(err, &encodeErr), "Store unencodable value")
+	assert.Equal(t, "encode value", encodeErr.Op, "Op")
+
+	errBoom := errors.New("boom")
+	_, err = m.Update("a", func(chan int, bool) (chan int, error) { return nil, errBoom })
+	assert.Equal(t, errBoom, err, "Update returns errors from f as-is")
+
+	assert.NoError(t, m.Close(), "Close")
+
+	var driverErr *DriverError
+	_, _, err = m.Load("a")
+	assert.True(t, errors.As(err, &driverErr), "Load after Close")
+	assert.IsError(t, err, ErrClosed, "Load after Close")
+
+	err = m.Delete("a")
+	assert.True(t, errors.As(err, &driverErr), "Delete after Close")
+
+	_, err = m.DeletePrefix("a")
+	assert.True(t, errors.As(err, &driverErr), "DeletePrefix after Close")
+
+	_, _, err = LoadAll(m, []string{"a"})
+	assert.True(t, errors.As(err, &driverErr), "LoadAll after Close")
+
+	_, err = m.Update("a", func(v chan int, _ bool) (chan int, error) { return v, nil })
+	assert.True(t, errors.As(err, &driverErr), "Update after Close")
+
+	err = m.UpdateAll(func(_ string, v chan int) (chan int, bool, error) { return v, true, nil })
+	assert.True(t, errors.As(err, &driverErr), "UpdateAll after Close")
+}
+
+func TestMapLoadOrdered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("c", 3), "Store c")
+
+	values, err := m.LoadOrdered([]string{"c", "b", "a", "c"})
+	assert.NoError(t, err, "LoadOrdered")
+	assert.Equal(t, []Opt[int]{
+		{Value: 3, Present: true},
+		{},
+		{Value: 1, Present: true},
+		{Value: 3, Present: true},
+	}, values, "LoadOrdered")
+}
+
+func TestNewNamedValue(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	shared := func(string) (Driver, error) { return d, nil }
+
+	a, err := NewNamedValue[int](shared, "", "a")
+	assert.NoError(t, err, "NewNamedValue a")
+	b, err := NewNamedValue[int](shared, "", "b")
+	assert.NoError(t, err, "NewNamedValue b")
+
+	assert.NoError(t, a.Store(1), "Store a")
+	assert.NoError(t, b.Store(2), "Store b")
+
+	v, _, err := a.Load()
+	assert.NoError(t, err, "Load a")
+	assert.Equal(t, 1, v, "Load a")
+
+	v, _, err = b.Load()
+	assert.NoError(t, err, "Load b")
+	assert.Equal(t, 2, v, "Load b")
+
+	err = d.AcquireRO(func(tx DriverReadOnlyTx) error {
+		_, ok, err := tx.Get([]byte("a"))
+		assert.True(t, ok, "stored under its name")
+		return err
+	})
+	assert.NoError(t, err, "AcquireRO")
+}
+
+func TestMapBatch(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[string, int]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[int](),
+	})
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+
+	err = m.Batch(func(b Batch[string, int]) error {
+		assert.NoError(t, b.Store("b", 2), "Batch Store b")
+		assert.NoError(t, b.Delete("a"), "Batch Delete a")
+
+		v, ok, err := b.Load("b")
+		assert.NoError(t, err, "Batch Load b")
+		assert.True(t, ok, "Batch reads its own writes")
+		assert.Equal(t, 2, v, "Batch Load b")
+
+		_, ok, err = b.Load("a")
+		assert.NoError(t, err, "Batch Load a")
+		assert.False(t, ok, "Batch reads its own deletes")
+		return nil
+	})
+	assert.NoError(t, err, "Batch")
+
+	found, missing, err := LoadAll(m, []string{"a", "b"})
+	assert.NoError(t, err, "LoadAll")
+	assert.Equal(t, map[string]int{"b": 2}, found, "committed")
+	assert.Equal(t, []string{"a"}, missing, "committed")
+
+	errAbort := errors.New("abort")
+	err = m.Batch(func(b Batch[string, int]) error {
+		assert.NoError(t, b.Store("c", 3), "Batch Store c")
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err, "Batch returns f's error as-is")
+
+	ok, err := m.Contains("c")
+	assert.NoError(t, err, "Contains c")
+	assert.False(t, ok, "aborted batch is not committed")
+}
+
+func TestMapVersionUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	_, _, _, err = m.LoadVersion("a")
+	assert.IsError(t, err, errors.ErrUnsupported, "LoadVersion")
+
+	err = m.StoreIfVersion("a", 1, 0)
+	assert.IsError(t, err, errors.ErrUnsupported, "StoreIfVersion")
+
+	err = m.StoreManyIfVersion([]VersionedPair[string, int]{{Key: "a", Value: 1}})
+	assert.IsError(t, err, errors.ErrUnsupported, "StoreManyIfVersion")
+}
+
+func TestMapOpt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	o, err := m.LoadOpt("a")
+	assert.NoError(t, err, "LoadOpt missing")
+	assert.Equal(t, Opt[int]{}, o, "LoadOpt missing")
+	assert.Equal(t, 5, o.Or(5), "Or")
+
+	o, err = m.LoadOrStoreOpt("a", 1)
+	assert.NoError(t, err, "LoadOrStoreOpt store")
+	assert.False(t, o.Present, "LoadOrStoreOpt stored")
+
+	o, err = m.LoadOrStoreOpt("a", 2)
+	assert.NoError(t, err, "LoadOrStoreOpt load")
+	assert.Equal(t, Some(1), o, "LoadOrStoreOpt loaded")
+
+	o, err = m.LoadAndDeleteOpt("a")
+	assert.NoError(t, err, "LoadAndDeleteOpt")
+	v, ok := o.Get()
+	assert.True(t, ok, "LoadAndDeleteOpt present")
+	assert.Equal(t, 1, v, "LoadAndDeleteOpt")
+
+	o, err = m.LoadOpt("a")
+	assert.NoError(t, err, "LoadOpt deleted")
+	assert.False(t, o.Present, "LoadOpt deleted")
+}
+
+func TestMigrateValue(t *testing.T) {
+	m, err := NewMap[string, int](CBORDriver, filepath.Join(t.TempDir(), "map.cbor"))
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	dst, err := NewValue[int](CBORDriver, filepath.Join(t.TempDir(), "value.cbor"))
+	assert.NoError(t, err, "NewValue")
+	defer dst.Close()
+
+	src := NewMappedValue(m, "value")
+
+	assert.NoError(t, src.Store(42), "Store")
+	assert.NoError(t, MigrateValue(src, dst), "MigrateValue present")
+
+	v, ok, err := dst.Load()
+	assert.NoError(t, err, "Load migrated")
+	assert.True(t, ok, "Load migrated")
+	assert.Equal(t, 42, v, "Load migrated")
+
+	assert.NoError(t, src.Delete(), "Delete")
+	assert.NoError(t, MigrateValue(src, dst), "MigrateValue absent")
+
+	ok, err = dst.Exists()
+	assert.NoError(t, err, "Exists")
+	assert.False(t, ok, "absent value is migrated as absent")
+}
+
+func TestReduce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i+1), "Store "+k)
+	}
+
+	sum, err := Reduce(m, 0, func(acc int, _ string, v int) (int, error) {
+		return acc + v, nil
+	})
+	assert.NoError(t, err, "Reduce")
+	assert.Equal(t, 6, sum, "sum")
+
+	errStop := errors.New("stop")
+	sum, err = Reduce(m, 0, func(acc int, k string, v int) (int, error) {
+		if k == "c" {
+			return 0, errStop
+		}
+		return acc + v, nil
+	})
+	assert.IsError(t, err, errStop, "Reduce error")
+	assert.Equal(t, 3, sum, "accumulator before the error")
+}
+
+func TestMapWithKeyCollisionCheck(t *testing.T) {
+	type key struct {
+		Name   string
+		hidden int // not encoded by CBOR
+	}
+
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+
+	m := NewMapFromEncoders(d, EncoderPair[key, int]{
+		Key:   CBOREncoder[key](),
+		Value: CBOREncoder[int](),
+	}).WithKeyCollisionCheck()
+	defer m.Close()
+
+	assert.NoError(t, m.Store(key{Name: "a"}, 1), "Store a")
+	assert.NoError(t, m.Store(key{Name: "a"}, 2), "Store a again")
+
+	err = m.Store(key{Name: "a", hidden: 1}, 3)
+	var collisionErr *KeyCollisionError[key]
+	assert.True(t, errors.As(err, &collisionErr), "Store colliding key")
+	assert.Equal(t, key{Name: "a"}, collisionErr.Existing, "Existing")
+
+	v, _, err := m.Load(key{Name: "a"})
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, 2, v, "colliding Store did not overwrite")
+}
+
+func TestMustError(t *testing.T) {
+	var m MustMap[string, int]
+
+	defer func() {
+		err, ok := recover().(error)
+		assert.True(t, ok, "panics with an error")
+
+		var mustErr *MustError
+		assert.True(t, errors.As(err, &mustErr), "panics with a MustError")
+		assert.Equal(t, "MustMap cannot set", mustErr.Op, "Op")
+		assert.IsError(t, err, ErrNotInitialized, "wraps the cause")
+	}()
+
+	m.Store("a", 1)
+}
+
+func TestMapAllLimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i), "Store "+k)
+	}
+
+	count := func(seq Seq2[string, int]) int {
+		var n int
+		seq(func(string, int) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	assert.Equal(t, 2, count(m.AllLimited(2)), "AllLimited(2)")
+	assert.Equal(t, 3, count(m.AllLimited(10)), "AllLimited(10)")
+	assert.Equal(t, 0, count(m.AllLimited(0)), "AllLimited(0)")
+}
+
+func TestMapAllStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i), "Store "+k)
+	}
+
+	got := make(map[string]int)
+	err = m.AllStream(func(k string, v int) error {
+		got[k] = v
+		return nil
+	})
+	assert.NoError(t, err, "AllStream")
+	assert.Equal(t, map[string]int{"a": 0, "b": 1, "c": 2}, got, "AllStream")
+
+	var n int
+	err = m.AllStream(func(string, int) error {
+		n++
+		return StopIteration
+	})
+	assert.NoError(t, err, "AllStream stops early")
+	assert.Equal(t, 1, n, "AllStream stops early")
+
+	errBoom := errors.New("boom")
+	err = m.AllStream(func(string, int) error { return errBoom })
+	assert.IsError(t, err, errBoom, "AllStream returns errors from f")
+
+	var z Map[string, int]
+	err = z.AllStream(func(string, int) error { return nil })
+	assert.IsError(t, err, ErrNotInitialized, "AllStream not initialized")
+}
+
+func TestContainsMany(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("c", 3), "Store c")
+
+	found, err := ContainsMany(m, []string{"a", "b", "c", "a"})
+	assert.NoError(t, err, "ContainsMany")
+	assert.Equal(t, map[string]bool{"a": true, "b": false, "c": true}, found, "ContainsMany")
+}
+
+func TestFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i+1), "Store "+k)
+	}
+
+	var visited int
+	k, v, ok, err := Find(m, func(_ string, v int) bool {
+		visited++
+		return v >= 2
+	})
+	assert.NoError(t, err, "Find")
+	assert.True(t, ok, "Find")
+	assert.Equal(t, "b", k, "Find key")
+	assert.Equal(t, 2, v, "Find value")
+	assert.Equal(t, 2, visited, "pairs visited")
+
+	_, _, ok, err = Find(m, func(string, int) bool { return false })
+	assert.NoError(t, err, "Find no match")
+	assert.False(t, ok, "Find no match")
+}
+
+func TestMapStoreAndReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	tests := []struct {
+		v        int
+		previous int
+		existed  bool
+		changed  bool
+	}{
+		{1, 0, false, true},
+		{1, 1, true, false},
+		{2, 1, true, true},
+	}
+
+	for _, test := range tests {
+		previous, existed, changed, err := m.StoreAndReport("a", test.v)
+		assert.NoError(t, err, "StoreAndReport")
+		assert.Equal(t, test.previous, previous, "previous")
+		assert.Equal(t, test.existed, existed, "existed")
+		assert.Equal(t, test.changed, changed, "changed")
+	}
+
+	v, err := m.Get("a")
+	assert.NoError(t, err, "Get")
+	assert.Equal(t, 2, v, "Get")
+}
+
+func TestMapAllPairs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i+1), "Store "+k)
+	}
+
+	var pairs []Pair[string, int]
+	m.AllPairs()(func(p Pair[string, int]) bool {
+		pairs = append(pairs, p)
+		return true
+	})
+
+	assert.Equal(t, []Pair[string, int]{
+		{"a", 1},
+		{"b", 2},
+		{"c", 3},
+	}, pairs, "AllPairs")
+}
+
+func TestValueGetLoadOr(t *testing.T) {
+	v, err := NewValue[[]string](CBORDriver, filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "NewValue")
+	defer v.Close()
+
+	_, err = v.Get()
+	assert.IsError(t, err, ErrNotFound, "Get missing")
+
+	def, err := v.LoadOr([]string{"default"})
+	assert.NoError(t, err, "LoadOr missing")
+	assert.Equal(t, []string{"default"}, def, "LoadOr missing")
+
+	assert.NoError(t, v.Store([]string{}), "Store")
+
+	got, err := v.Get()
+	assert.NoError(t, err, "Get")
+	assert.Equal(t, []string{}, got, "Get")
+
+	got, err = v.LoadOr([]string{"default"})
+	assert.NoError(t, err, "LoadOr")
+	assert.Equal(t, []string{}, got, "LoadOr")
+}
+
+func TestStopIteration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	for i, k := range []string{"a", "b", "c"} {
+		assert.NoError(t, m.Store(k, i+1), "Store "+k)
+	}
+
+	var visited []string
+	err = m.View(func(r MapReader[string, int]) error {
+		return r.Each(func(k string, _ int) error {
+			if k == "b" {
+				return StopIteration
+			}
+			visited = append(visited, k)
+			return nil
+		})
+	})
+	assert.NoError(t, err, "Each")
+	assert.Equal(t, []string{"a"}, visited, "Each visited")
+
+	sum, err := Reduce(m, 0, func(acc int, k string, v int) (int, error) {
+		if k == "c" {
+			return 0, StopIteration
+		}
+		return acc + v, nil
+	})
+	assert.NoError(t, err, "Reduce")
+	assert.Equal(t, 3, sum, "Reduce")
+
+	err = m.UpdateAll(func(k string, v int) (int, bool, error) {
+		if k == "b" {
+			return 0, false, StopIteration
+		}
+		return v * 10, true, nil
+	})
+	assert.NoError(t, err, "UpdateAll")
+
+	for k, expect := range map[string]int{"a": 10, "b": 2, "c": 3} {
+		v, err := m.Get(k)
+		assert.NoError(t, err, "Get "+k)
+		assert.Equal(t, expect, v, "Get "+k)
+	}
+}
+
+func TestMapCheckIntegrity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbor")
+
+	m, err := NewMap[string, int](CBORDriver, path)
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	assert.NoError(t, m.Store("a", 1), "Store a")
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	report, err := m.CheckIntegrity()
+	assert.NoError(t, err, "CheckIntegrity")
+	assert.Equal(t, 2, report.Checked, "Checked")
+	assert.True(t, report.OK(), "OK")
+
+	bk, err := m.kencoder.Encode("b", nil)
+	assert.NoError(t, err, "encode key")
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := tx.Set(bk, []byte("garbage")); err != nil {
+			return err
+		}
+		return tx.Set([]byte("\xff"), []byte{0x01})
+	})
+	assert.NoError(t, err, "corrupt")
+
+	report, err = m.CheckIntegrity()
+	assert.NoError(t, err, "CheckIntegrity")
+	assert.Equal(t, 3, report.Checked, "Checked")
+	assert.False(t, report.OK(), "OK")
+	assert.Equal(t, 2, len(report.Failures), "Failures")
+
+	var encodeErr *EncodeError
+	assert.Equal(t, bk, report.Failures[0].Key, "value failure key")
+	assert.True(t, errors.As(report.Failures[0].Err, &encodeErr), "value failure error")
+	assert.Equal(t, "decode value", encodeErr.Op, "value failure op")
+
+	assert.Equal(t, []byte("\xff"), report.Failures[1].Key, "key failure key")
+	assert.True(t, errors.As(report.Failures[1].Err, &encodeErr), "key failure error")
+	assert.Equal(t, "decode key", encodeErr.Op, "key failure op")
+}
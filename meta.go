@@ -0,0 +1,194 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// metaKeyPrefix prefixes the sidecar keys that hold the metadata of values.
+const metaKeyPrefix = reservedKeyPrefix + "meta\x00"
+
+func metaKey(bk []byte) []byte {
+	return append([]byte(metaKeyPrefix), bk...)
+}
+
+// metaVersion is the version of the sidecar entry format written by
+// StoreWithMeta. Entries of other versions are rejected when loaded.
+const metaVersion = 1
+
+// metaEntry is the sidecar value that holds the metadata of a value. It is
+// encoded as CBOR so that its format can be extended using Version.
+type metaEntry struct {
+	_       struct{} `cbor:",toarray"`
+	Version uint
+	Meta    []byte
+}
+
+// errMetadataDisabled is returned by StoreWithMeta on maps that were not
+// created using WithMetadata.
+var errMetadataDisabled = errors.New("persist: metadata is not enabled; see Map.WithMetadata")
+
+// WithMetadata returns a copy of the map that supports [Map.StoreWithMeta].
+//
+// Metadata is dropped by every write that replaces or deletes its value, which
+// costs an extra read per written key. Maps that are not created using
+// WithMetadata skip this read, so they must not be used to write to data that
+// has metadata: their writes would leave it stale.
+func (m Map[K, V]) WithMetadata() Map[K, V] {
+	m.metadata = true
+	return m
+}
+
+// dropMeta deletes the metadata of the value at bk, if any. Every write that
+// replaces or deletes a value must call it, except StoreWithMeta. It does
+// nothing unless the map was created using WithMetadata.
+func (m Map[K, V]) dropMeta(tx DriverReadWriteTx, bk []byte) error {
+	if !m.metadata {
+		return nil
+	}
+	mk := metaKey(bk)
+	_, ok, err := tx.Get(mk)
+	if err != nil {
+		return &DriverError{"get metadata", err}
+	}
+	if !ok {
+		return nil
+	}
+	return driverError("delete metadata", tx.Delete(mk))
+}
+
+// dropMetaPrefix deletes the metadata of all values whose key starts with
+// prefix. Like dropMeta, it does nothing unless the map was created using
+// WithMetadata.
+func (m Map[K, V]) dropMetaPrefix(tx DriverReadWriteTx, prefix []byte) error {
+	if !m.metadata {
+		return nil
+	}
+	var mks [][]byte
+	err := eachPrefix(tx, metaKey(prefix), func(mk, _ []byte) error {
+		mks = append(mks, bytes.Clone(mk))
+		return nil
+	})
+	if err != nil {
+		return &DriverError{"get metadata", err}
+	}
+	for _, mk := range mks {
+		if err := tx.Delete(mk); err != nil {
+			return &DriverError{"delete metadata", err}
+		}
+	}
+	return nil
+}
+
+// StoreWithMeta sets a key-value pair like [Map.Store] along with metadata,
+// such as a version tag or a content type, that is kept next to the value
+// rather than within it. Both are written within a single transaction. If meta
+// is nil, then any metadata is removed. The map must be created using
+// [Map.WithMetadata], or else an error is returned.
+//
+// Metadata is only ever stored as a sidecar: a separate internal key next to
+// the value's key, which is not visited by iteration. No driver stores it
+// natively, and there is no driver interface to do so; in particular, badger's
+// per-entry user metadata is a single byte and is left unused. Every value with
+// metadata therefore takes up two keys in the driver.
+//
+// Metadata belongs to the value that it was stored with: every other method
+// that replaces or deletes the value, e.g. [Map.Store] or [Map.Delete],
+// removes it within the same transaction. [Map.RemapKeys] moves it along with
+// the value. Writes made to the driver directly, or through maps not created
+// using [Map.WithMetadata], leave it stale.
+func (m Map[K, V]) StoreWithMeta(k K, v V, meta []byte) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+	if !m.metadata {
+		return errMetadataDisabled
+	}
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := m.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		if err := tx.Set(bk, bv); err != nil {
+			return &DriverError{"set value", err}
+		}
+		if meta == nil {
+			return m.dropMeta(tx, bk)
+		}
+		bm, err := cbor.Marshal(metaEntry{Version: metaVersion, Meta: meta})
+		if err != nil {
+			return &EncodeError{"encode metadata", err}
+		}
+		return driverError("set metadata", tx.Set(metaKey(bk), bm))
+	})
+	return txError(err)
+}
+
+// LoadWithMeta gets a value by key like [Map.Load] along with the metadata it
+// was stored with using [Map.StoreWithMeta]. meta is nil if the value has no
+// metadata.
+func (m Map[K, V]) LoadWithMeta(k K) (v V, meta []byte, ok bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	var bk []byte
+	bk, err = m.kencoder.Encode(k, nil)
+	if err != nil {
+		err = &EncodeError{"encode key", err}
+		return
+	}
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		v, meta, ok = *new(V), nil, false
+
+		bv, exists, err := tx.Get(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		if !exists {
+			return nil
+		}
+
+		v, err = m.valueEncoder(bk).Decode(bv)
+		if err != nil {
+			return &EncodeError{"decode value", err}
+		}
+		ok = true
+
+		bm, exists, err := tx.Get(metaKey(bk))
+		if err != nil {
+			return &DriverError{"get metadata", err}
+		}
+		if !exists {
+			return nil
+		}
+
+		var e metaEntry
+		if err := cbor.Unmarshal(bm, &e); err != nil {
+			return &EncodeError{"decode metadata", err}
+		}
+		if e.Version != metaVersion {
+			return &EncodeError{"decode metadata", fmt.Errorf("unknown version %d", e.Version)}
+		}
+		meta = e.Meta
+		return nil
+	})
+	err = txError(err)
+	return
+}
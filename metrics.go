@@ -0,0 +1,282 @@
+package persist
+
+import (
+	"errors"
+	"time"
+)
+
+// TxMode is the mode of a driver transaction.
+type TxMode uint8
+
+const (
+	// TxReadOnly is a transaction acquired using AcquireRO.
+	TxReadOnly TxMode = iota
+	// TxReadWrite is a transaction acquired using AcquireRW.
+	TxReadWrite
+)
+
+// String returns "ro" or "rw".
+func (m TxMode) String() string {
+	if m == TxReadWrite {
+		return "rw"
+	}
+	return "ro"
+}
+
+// ValueOp is the kind of access made to a value.
+type ValueOp uint8
+
+const (
+	// ValueRead is a value read using Get or Each.
+	ValueRead ValueOp = iota
+	// ValueWrite is a value written using Set.
+	ValueWrite
+)
+
+// String returns "read" or "write".
+func (op ValueOp) String() string {
+	if op == ValueWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// MetricsHooks receives metrics from a driver wrapped using [WithMetrics].
+// Implementations must be safe for concurrent use.
+type MetricsHooks interface {
+	// ObserveTx is called after every transaction with how long it took and
+	// the error it returned, if any. Stopping iteration early is not reported
+	// as an error.
+	ObserveTx(mode TxMode, took time.Duration, err error)
+	// ObserveValue is called with the size of every value read or written.
+	ObserveValue(op ValueOp, size int)
+}
+
+// WithMetrics wraps a driver so that all of its transactions and values are
+// reported to hooks.
+func WithMetrics(d Driver, hooks MetricsHooks) Driver {
+	return WithMetricsClock(d, hooks, SystemClock)
+}
+
+// WithMetricsClock wraps a driver like [WithMetrics], except that transaction
+// durations are measured using clock.
+func WithMetricsClock(d Driver, hooks MetricsHooks, clock Clock) Driver {
+	return metricsDriver{d, hooks, clock}
+}
+
+type metricsDriver struct {
+	Driver
+	hooks MetricsHooks
+	clock Clock
+}
+
+var (
+	_ DriverUnwrapper        = metricsDriver{}
+	_ DriverWithCapabilities = metricsDriver{}
+)
+
+func (d metricsDriver) Unwrap() Driver { return d.Driver }
+
+// Capabilities reports the capabilities of the wrapped driver, since the
+// wrapped transactions implement the same optional interfaces.
+func (d metricsDriver) Capabilities() DriverCapabilities {
+	return Capabilities(d.Driver)
+}
+
+func (d metricsDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	start := d.clock.Now()
+	err := d.Driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return f(d.wrapRO(tx))
+	})
+	d.hooks.ObserveTx(TxReadOnly, d.clock.Now().Sub(start), observedErr(err))
+	return err
+}
+
+func (d metricsDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	start := d.clock.Now()
+	err := d.Driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		return f(d.wrapRW(tx))
+	})
+	d.hooks.ObserveTx(TxReadWrite, d.clock.Now().Sub(start), observedErr(err))
+	return err
+}
+
+// observedErr returns the error that a transaction is reported with. The
+// errors used to stop iteration early do not mean that it failed.
+func observedErr(err error) error {
+	if errors.Is(err, driverStopIteration) || errors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
+
+// wrapRO wraps tx so that its values are observed. The returned transaction
+// implements the same optional interfaces as tx, so that helpers such as
+// [Map.First] keep using them.
+func (d metricsDriver) wrapRO(tx DriverReadOnlyTx) DriverReadOnlyTx {
+	ro := metricsROTx{tx, d.hooks}
+	otx, ordered := tx.(DriverOrderedTx)
+	vtx, versioned := tx.(DriverVersionedTx)
+
+	switch {
+	case ordered && versioned:
+		return metricsOrderedVersionedTx{metricsOrderedTx{ro, metricsOrdered{otx, d.hooks}}, metricsVersioned{vtx, d.hooks}}
+	case ordered:
+		return metricsOrderedTx{ro, metricsOrdered{otx, d.hooks}}
+	case versioned:
+		return metricsVersionedTx{ro, metricsVersioned{vtx, d.hooks}}
+	default:
+		return ro
+	}
+}
+
+// wrapRW is like wrapRO for read-write transactions.
+func (d metricsDriver) wrapRW(tx DriverReadWriteTx) DriverReadWriteTx {
+	rw := metricsRWTx{metricsROTx{tx, d.hooks}, tx}
+	otx, ordered := tx.(DriverOrderedTx)
+	vtx, versioned := tx.(DriverVersionedRWTx)
+
+	switch {
+	case ordered && versioned:
+		return metricsOrderedVersionedRWTx{
+			metricsOrderedRWTx{rw, metricsOrdered{otx, d.hooks}},
+			metricsVersioned{vtx, d.hooks},
+			metricsVersionedRW{vtx, d.hooks},
+		}
+	case ordered:
+		return metricsOrderedRWTx{rw, metricsOrdered{otx, d.hooks}}
+	case versioned:
+		return metricsVersionedRWTx{rw, metricsVersioned{vtx, d.hooks}, metricsVersionedRW{vtx, d.hooks}}
+	default:
+		return rw
+	}
+}
+
+type metricsROTx struct {
+	tx    DriverReadOnlyTx
+	hooks MetricsHooks
+}
+
+func (tx metricsROTx) Get(k []byte) ([]byte, bool, error) {
+	v, ok, err := tx.tx.Get(k)
+	if ok {
+		tx.hooks.ObserveValue(ValueRead, len(v))
+	}
+	return v, ok, err
+}
+
+func (tx metricsROTx) Each(f func(k, v []byte) error) error {
+	return tx.tx.Each(func(k, v []byte) error {
+		tx.hooks.ObserveValue(ValueRead, len(v))
+		return f(k, v)
+	})
+}
+
+func (tx metricsROTx) EachKey(f func(k []byte) error) error {
+	return tx.tx.EachKey(f)
+}
+
+// EachPrefix implements [DriverPrefixTx]. It seeks to prefix if the wrapped
+// transaction implements DriverPrefixTx, or filters Each otherwise, which is
+// what callers would do without it.
+func (tx metricsROTx) EachPrefix(prefix []byte, f func(k, v []byte) error) error {
+	return eachPrefix(tx.tx, prefix, func(k, v []byte) error {
+		tx.hooks.ObserveValue(ValueRead, len(v))
+		return f(k, v)
+	})
+}
+
+type metricsRWTx struct {
+	metricsROTx
+	rw DriverReadWriteTx
+}
+
+func (tx metricsRWTx) Set(k, v []byte) error {
+	tx.hooks.ObserveValue(ValueWrite, len(v))
+	return tx.rw.Set(k, v)
+}
+
+func (tx metricsRWTx) Delete(k []byte) error {
+	return tx.rw.Delete(k)
+}
+
+type metricsOrderedTx struct {
+	metricsROTx
+	metricsOrdered
+}
+
+type metricsOrderedRWTx struct {
+	metricsRWTx
+	metricsOrdered
+}
+
+type metricsOrderedVersionedTx struct {
+	metricsOrderedTx
+	metricsVersioned
+}
+
+type metricsOrderedVersionedRWTx struct {
+	metricsOrderedRWTx
+	metricsVersioned
+	metricsVersionedRW
+}
+
+type metricsVersionedTx struct {
+	metricsROTx
+	metricsVersioned
+}
+
+type metricsVersionedRWTx struct {
+	metricsRWTx
+	metricsVersioned
+	metricsVersionedRW
+}
+
+// metricsOrdered observes the methods of [DriverOrderedTx] that are not part
+// of [DriverReadOnlyTx].
+type metricsOrdered struct {
+	otx   DriverOrderedTx
+	hooks MetricsHooks
+}
+
+func (tx metricsOrdered) EachOrdered(reverse bool, f func(k, v []byte) error) error {
+	return tx.otx.EachOrdered(reverse, func(k, v []byte) error {
+		tx.hooks.ObserveValue(ValueRead, len(v))
+		return f(k, v)
+	})
+}
+
+// metricsVersioned observes the methods of [DriverVersionedTx] that are not
+// part of [DriverReadOnlyTx].
+type metricsVersioned struct {
+	vtx   DriverVersionedTx
+	hooks MetricsHooks
+}
+
+func (tx metricsVersioned) GetVersion(k []byte) ([]byte, uint64, bool, error) {
+	v, version, ok, err := tx.vtx.GetVersion(k)
+	if ok {
+		tx.hooks.ObserveValue(ValueRead, len(v))
+	}
+	return v, version, ok, err
+}
+
+// metricsVersionedRW observes the methods of [DriverVersionedRWTx] that are
+// not part of [DriverReadWriteTx] or [DriverVersionedTx].
+type metricsVersionedRW struct {
+	vtx   DriverVersionedRWTx
+	hooks MetricsHooks
+}
+
+func (tx metricsVersionedRW) SetIfVersion(k, v []byte, version uint64) error {
+	tx.hooks.ObserveValue(ValueWrite, len(v))
+	return tx.vtx.SetIfVersion(k, v, version)
+}
+
+var (
+	_ DriverPrefixTx      = metricsROTx{}
+	_ DriverOrderedTx     = metricsOrderedVersionedTx{}
+	_ DriverVersionedTx   = metricsOrderedVersionedTx{}
+	_ DriverOrderedTx     = metricsOrderedVersionedRWTx{}
+	_ DriverVersionedRWTx = metricsOrderedVersionedRWTx{}
+)
@@ -0,0 +1,108 @@
+package persist
+
+import "errors"
+
+// MirrorDriver returns a driver that writes to both primary and secondary, but
+// reads from primary first, falling back to secondary for keys that primary
+// does not have. This allows migrating from one driver to another without
+// downtime: the new driver is used as primary and the old one as secondary,
+// and every key written from then on ends up in both. Once all keys have been
+// copied to primary, e.g. using [CopyMap], the secondary can be dropped.
+//
+// Each and EachKey visit all keys in primary, then the keys in secondary that
+// are not in primary.
+//
+// There is no atomicity across the two drivers. Every transaction runs a
+// transaction on primary with one on secondary nested inside, so secondary is
+// committed first: if primary then fails to commit, then the write is only in
+// secondary. Transactions made on either driver directly are not mirrored.
+// primary and secondary must be different drivers.
+//
+// Closing the returned driver closes both drivers.
+func MirrorDriver(primary, secondary Driver) Driver {
+	return mirrorDriver{primary, secondary}
+}
+
+type mirrorDriver struct {
+	primary   Driver
+	secondary Driver
+}
+
+func (d mirrorDriver) Close() error {
+	return errors.Join(d.primary.Close(), d.secondary.Close())
+}
+
+func (d mirrorDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	return d.primary.AcquireRO(func(ptx DriverReadOnlyTx) error {
+		return d.secondary.AcquireRO(func(stx DriverReadOnlyTx) error {
+			return f(mirrorROTx{ptx, stx})
+		})
+	})
+}
+
+func (d mirrorDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	return d.primary.AcquireRW(func(ptx DriverReadWriteTx) error {
+		return d.secondary.AcquireRW(func(stx DriverReadWriteTx) error {
+			return f(mirrorRWTx{mirrorROTx{ptx, stx}, ptx, stx})
+		})
+	})
+}
+
+type mirrorROTx struct {
+	primary   DriverReadOnlyTx
+	secondary DriverReadOnlyTx
+}
+
+func (tx mirrorROTx) Get(k []byte) ([]byte, bool, error) {
+	v, ok, err := tx.primary.Get(k)
+	if err != nil || ok {
+		return v, ok, err
+	}
+	return tx.secondary.Get(k)
+}
+
+func (tx mirrorROTx) Each(f func(k, v []byte) error) error {
+	if err := tx.primary.Each(f); err != nil {
+		return err
+	}
+	return tx.secondary.Each(func(k, v []byte) error {
+		_, ok, err := tx.primary.Get(k)
+		if err != nil || ok {
+			return err
+		}
+		return f(k, v)
+	})
+}
+
+func (tx mirrorROTx) EachKey(f func(k []byte) error) error {
+	if err := tx.primary.EachKey(f); err != nil {
+		return err
+	}
+	return tx.secondary.EachKey(func(k []byte) error {
+		_, ok, err := tx.primary.Get(k)
+		if err != nil || ok {
+			return err
+		}
+		return f(k)
+	})
+}
+
+type mirrorRWTx struct {
+	mirrorROTx
+	primary   DriverReadWriteTx
+	secondary DriverReadWriteTx
+}
+
+func (tx mirrorRWTx) Set(k, v []byte) error {
+	if err := tx.primary.Set(k, v); err != nil {
+		return err
+	}
+	return tx.secondary.Set(k, v)
+}
+
+func (tx mirrorRWTx) Delete(k []byte) error {
+	if err := tx.primary.Delete(k); err != nil {
+		return err
+	}
+	return tx.secondary.Delete(k)
+}
@@ -0,0 +1,61 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMirrorDriver(t *testing.T) {
+	newMap := func(d Driver) Map[string, int] {
+		return NewMapFromEncoders(d, EncoderPair[string, int]{
+			Key:   StringEncoder[string](),
+			Value: CBOREncoder[int](),
+		})
+	}
+
+	oldDriver, err := CBORDriver(filepath.Join(t.TempDir(), "old.cbor"))
+	assert.NoError(t, err, "CBORDriver old")
+	newDriver, err := CBORDriver(filepath.Join(t.TempDir(), "new.cbor"))
+	assert.NoError(t, err, "CBORDriver new")
+
+	previous := newMap(oldDriver)
+	current := newMap(newDriver)
+	assert.NoError(t, previous.Store("old", 1), "Store old")
+	assert.NoError(t, previous.Store("both", 1), "Store both in old")
+	assert.NoError(t, current.Store("both", 2), "Store both in new")
+
+	m := newMap(MirrorDriver(newDriver, oldDriver))
+	defer m.Close()
+
+	v, ok, err := m.Load("old")
+	assert.NoError(t, err, "Load old")
+	assert.True(t, ok, "Load falls back to secondary")
+	assert.Equal(t, 1, v, "Load old")
+
+	v, _, err = m.Load("both")
+	assert.NoError(t, err, "Load both")
+	assert.Equal(t, 2, v, "Load prefers primary")
+
+	got := map[string]int{}
+	m.All()(func(k string, v int) bool {
+		got[k] = v
+		return true
+	})
+	assert.Equal(t, map[string]int{"old": 1, "both": 2}, got, "All")
+
+	assert.NoError(t, m.Store("new", 3), "Store new")
+	assert.NoError(t, m.Delete("old"), "Delete old")
+
+	for name, m := range map[string]Map[string, int]{"old": previous, "new": current} {
+		v, ok, err := m.Load("new")
+		assert.NoError(t, err, "Load new from "+name)
+		assert.True(t, ok, "write mirrored to "+name)
+		assert.Equal(t, 3, v, "Load new from "+name)
+
+		ok, err = m.Contains("old")
+		assert.NoError(t, err, "Contains old in "+name)
+		assert.False(t, ok, "delete mirrored to "+name)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package persist
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the whole file into memory, since memory-mapping is not
+// supported on this platform.
+func mmapFile(f *os.File) ([]byte, error) {
+	return io.ReadAll(f)
+}
+
+func munmapFile(b []byte) error { return nil }
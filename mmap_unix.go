@@ -0,0 +1,27 @@
+//go:build unix
+
+package persist
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole file into memory as read-only.
+func mmapFile(f *os.File) ([]byte, error) {
+	s, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if s.Size() == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(s.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(b []byte) error {
+	if b == nil {
+		return nil
+	}
+	return syscall.Munmap(b)
+}
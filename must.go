@@ -1,6 +1,23 @@
 package persist
 
-import "fmt"
+import "context"
+
+// MustError is the value that the methods of MustMap, MustValue and
+// MustCounter panic with when an error occurs. It wraps the error, so that
+// recover handlers can inspect it using [errors.As] and [errors.Is].
+type MustError struct {
+	// Op describes the failed operation, e.g. "MustMap cannot load".
+	Op  string
+	Err error
+}
+
+func (e *MustError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *MustError) Unwrap() error {
+	return e.Err
+}
 
 /*
  * Map
@@ -8,6 +25,7 @@ import "fmt"
 
 // MustMap wraps a map and guarantees that no errors will be returned from
 // the map's methods, with the exception of Get, which now returns a bool.
+// Like [Map], it is safe for concurrent use.
 type MustMap[K, V any] struct {
 	Map[K, V]
 }
@@ -30,7 +48,7 @@ func WrapMustMap[K, V any](m Map[K, V]) MustMap[K, V] { return MustMap[K, V]{m}
 func (m MustMap[K, V]) Load(key K) (V, bool) {
 	v, ok, err := m.Map.Load(key)
 	if err != nil {
-		panic(fmt.Sprintf("MustMap cannot load: %v", err))
+		panic(&MustError{"MustMap cannot load", err})
 	}
 	return v, ok
 }
@@ -39,7 +57,7 @@ func (m MustMap[K, V]) Load(key K) (V, bool) {
 // function panics.
 func (m MustMap[K, V]) Store(key K, value V) {
 	if err := m.Map.Store(key, value); err != nil {
-		panic(fmt.Sprintf("MustMap cannot set: %v", err))
+		panic(&MustError{"MustMap cannot set", err})
 	}
 }
 
@@ -48,7 +66,7 @@ func (m MustMap[K, V]) Store(key K, value V) {
 func (m MustMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 	v, loaded, err := m.Map.LoadAndDelete(key)
 	if err != nil {
-		panic(fmt.Sprintf("MustMap cannot load and delete: %v", err))
+		panic(&MustError{"MustMap cannot load and delete", err})
 	}
 	return v, loaded
 }
@@ -59,15 +77,25 @@ func (m MustMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 func (m MustMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
 	v, loaded, err := m.Map.LoadOrStore(key, value)
 	if err != nil {
-		panic(fmt.Sprintf("MustMap cannot load or store: %v", err))
+		panic(&MustError{"MustMap cannot load or store", err})
 	}
 	return v, loaded
 }
 
+// Update atomically updates the value associated with the key. If f returns an
+// error or any other error occurs, the function panics.
+func (m MustMap[K, V]) Update(key K, f func(v V, ok bool) V) V {
+	v, err := m.Map.Update(key, func(v V, ok bool) (V, error) { return f(v, ok), nil })
+	if err != nil {
+		panic(&MustError{"MustMap cannot update", err})
+	}
+	return v
+}
+
 // Delete deletes the key-value pair. If an error occurs, the function panics.
 func (m MustMap[K, V]) Delete(key K) {
 	if err := m.Map.Delete(key); err != nil {
-		panic(fmt.Sprintf("MustMap cannot delete: %v", err))
+		panic(&MustError{"MustMap cannot delete", err})
 	}
 }
 
@@ -109,21 +137,29 @@ func WrapMustValue[V any](value Value[V]) MustValue[V] { return MustValue[V]{val
 func (m MustValue[V]) Load() (V, bool) {
 	v, ok, err := m.Value.Load()
 	if err != nil {
-		panic(fmt.Sprintf("MustValue cannot load: %v", err))
+		panic(&MustError{"MustValue cannot load", err})
 	}
 	return v, ok
 }
 
+func (m MustValue[V]) Exists() bool {
+	ok, err := m.Value.Exists()
+	if err != nil {
+		panic(&MustError{"MustValue cannot check existence", err})
+	}
+	return ok
+}
+
 func (m MustValue[V]) Store(value V) {
 	if err := m.Value.Store(value); err != nil {
-		panic(fmt.Sprintf("MustValue cannot store: %v", err))
+		panic(&MustError{"MustValue cannot store", err})
 	}
 }
 
 func (m MustValue[V]) LoadAndDelete() (V, bool) {
 	v, loaded, err := m.Value.LoadAndDelete()
 	if err != nil {
-		panic(fmt.Sprintf("MustValue cannot load and delete: %v", err))
+		panic(&MustError{"MustValue cannot load and delete", err})
 	}
 	return v, loaded
 }
@@ -131,13 +167,83 @@ func (m MustValue[V]) LoadAndDelete() (V, bool) {
 func (m MustValue[V]) LoadOrStore(value V) (actual V, loaded bool) {
 	v, loaded, err := m.Value.LoadOrStore(value)
 	if err != nil {
-		panic(fmt.Sprintf("MustValue cannot load or store: %v", err))
+		panic(&MustError{"MustValue cannot load or store", err})
 	}
 	return v, loaded
 }
 
+func (m MustValue[V]) Update(f func(v V, ok bool) V) V {
+	v, err := m.Value.Update(func(v V, ok bool) (V, error) { return f(v, ok), nil })
+	if err != nil {
+		panic(&MustError{"MustValue cannot update", err})
+	}
+	return v
+}
+
+func (m MustValue[V]) Subscribe(ctx context.Context) <-chan V {
+	ch, err := m.Value.Subscribe(ctx)
+	if err != nil {
+		panic(&MustError{"MustValue cannot subscribe", err})
+	}
+	return ch
+}
+
 func (m MustValue[V]) Delete() {
 	if err := m.Value.Delete(); err != nil {
-		panic(fmt.Sprintf("MustValue cannot delete: %v", err))
+		panic(&MustError{"MustValue cannot delete", err})
+	}
+}
+
+/*
+ * Counter
+ */
+
+// MustCounter wraps a counter and guarantees that no errors will be returned
+// from the counter's methods.
+type MustCounter struct {
+	Counter
+}
+
+// NewMustCounter returns a new [MustCounter]. It has the same exact signature
+// as [NewCounter], and the user must still handle errors as they would with
+// [NewCounter].
+func NewMustCounter(driverOpener DriverOpenFunc, path string) (MustCounter, error) {
+	c, err := NewCounter(driverOpener, path)
+	if err != nil {
+		return MustCounter{}, err
+	}
+	return MustCounter{c}, nil
+}
+
+// WrapMustCounter wraps a Counter in a MustCounter.
+func WrapMustCounter(c Counter) MustCounter { return MustCounter{c} }
+
+func (m MustCounter) Load() int64 {
+	n, err := m.Counter.Load()
+	if err != nil {
+		panic(&MustError{"MustCounter cannot load", err})
+	}
+	return n
+}
+
+func (m MustCounter) Add(delta int64) int64 {
+	n, err := m.Counter.Add(delta)
+	if err != nil {
+		panic(&MustError{"MustCounter cannot add", err})
+	}
+	return n
+}
+
+func (m MustCounter) Inc() int64 {
+	n, err := m.Counter.Inc()
+	if err != nil {
+		panic(&MustError{"MustCounter cannot increment", err})
+	}
+	return n
+}
+
+func (m MustCounter) Reset() {
+	if err := m.Counter.Reset(); err != nil {
+		panic(&MustError{"MustCounter cannot reset", err})
 	}
 }
@@ -0,0 +1,50 @@
+package persist
+
+// Opt is a value that may not be present. It is returned by methods such as
+// [Map.LoadOpt] as an alternative to a (V, bool) pair, which makes it harder to
+// accidentally use the value when there is none.
+type Opt[V any] struct {
+	Value   V
+	Present bool
+}
+
+// Some returns a present Opt holding v.
+func Some[V any](v V) Opt[V] {
+	return Opt[V]{v, true}
+}
+
+// Get returns the value and whether it is present.
+func (o Opt[V]) Get() (V, bool) {
+	return o.Value, o.Present
+}
+
+// Or returns the value if it is present, or def otherwise.
+func (o Opt[V]) Or(def V) V {
+	if o.Present {
+		return o.Value
+	}
+	return def
+}
+
+// LoadOpt is like [Map.Load], except the value is returned as an Opt.
+func (m Map[K, V]) LoadOpt(k K) (Opt[V], error) {
+	v, ok, err := m.Load(k)
+	return Opt[V]{v, ok}, err
+}
+
+// LoadOrStoreOpt is like [Map.LoadOrStore], except it returns the value that
+// was already stored as an Opt. If it is not present, then v was stored.
+func (m Map[K, V]) LoadOrStoreOpt(k K, v V) (Opt[V], error) {
+	actual, loaded, err := m.LoadOrStore(k, v)
+	if !loaded {
+		return Opt[V]{}, err
+	}
+	return Opt[V]{actual, true}, err
+}
+
+// LoadAndDeleteOpt is like [Map.LoadAndDelete], except the deleted value is
+// returned as an Opt.
+func (m Map[K, V]) LoadAndDeleteOpt(k K) (Opt[V], error) {
+	v, ok, err := m.LoadAndDelete(k)
+	return Opt[V]{v, ok}, err
+}
@@ -0,0 +1,95 @@
+package persist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// First returns the key-value pair with the smallest encoded key. Keys are
+// compared by their encoded bytes, which may not match the natural ordering of
+// K depending on the key encoder.
+//
+// If the driver's transactions implement [DriverOrderedTx], then this is a
+// single iterator step. Otherwise, if the driver is ordered as reported by
+// [Map.IsOrdered], then the scan stops at the first key. Otherwise, all keys
+// are scanned.
+func (m Map[K, V]) First() (K, V, bool, error) {
+	return m.edge(false)
+}
+
+// Last returns the key-value pair with the largest encoded key. See
+// [Map.First], except that ordered drivers whose transactions do not implement
+// [DriverOrderedTx] still need all keys to be scanned.
+func (m Map[K, V]) Last() (K, V, bool, error) {
+	return m.edge(true)
+}
+
+func (m Map[K, V]) edge(last bool) (k K, v V, ok bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	var bk, bv []byte
+	var found bool
+	// Without an ordered iterator, the first key of an ordered driver can
+	// still be found without scanning everything.
+	stopEarly := !last && m.IsOrdered()
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		bk, bv, found = nil, nil, false
+
+		if otx, isOrdered := tx.(DriverOrderedTx); isOrdered {
+			err := otx.EachOrdered(last, func(k, v []byte) error {
+				if isReservedKey(k) {
+					return nil
+				}
+				// Copy, since the driver may reuse the buffers once
+				// iteration stops.
+				bk, bv = bytes.Clone(k), bytes.Clone(v)
+				found = true
+				return driverStopIteration
+			})
+			if err != nil && !errors.Is(err, driverStopIteration) {
+				return err
+			}
+		} else {
+			err := tx.Each(func(k, v []byte) error {
+				if isReservedKey(k) {
+					return nil
+				}
+				if !found || (bytes.Compare(k, bk) < 0) != last {
+					bk = append(bk[:0], k...)
+					bv = append(bv[:0], v...)
+					found = true
+				}
+				if stopEarly {
+					return driverStopIteration
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, driverStopIteration) {
+				return err
+			}
+		}
+
+		if !found {
+			return nil
+		}
+
+		k, err = m.kencoder.Decode(bk)
+		if err != nil {
+			return fmt.Errorf("decode key: %w", err)
+		}
+
+		v, err = m.valueEncoder(bk).Decode(bv)
+		if err != nil {
+			return fmt.Errorf("decode value: %w", err)
+		}
+
+		ok = true
+		return nil
+	})
+	return
+}
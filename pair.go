@@ -0,0 +1,31 @@
+package persist
+
+// Pair is a key-value pair.
+type Pair[K, V any] struct {
+	Key   K
+	Value V
+}
+
+// AllPairs returns an iterator over all key-value pairs of the map like
+// [Map.All], except that each pair is yielded as a single [Pair]. This allows
+// using helpers that work on single-value iterators, such as slices.Collect,
+// after converting the result to an iter.Seq, without requiring K to be
+// comparable.
+func (m Map[K, V]) AllPairs() Seq[Pair[K, V]] {
+	return func(yield func(Pair[K, V]) bool) {
+		m.All()(func(k K, v V) bool {
+			return yield(Pair[K, V]{k, v})
+		})
+	}
+}
+
+// pairsSeq returns an iterator over the given pairs.
+func pairsSeq[K, V any](pairs []Pair[K, V]) Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, p := range pairs {
+			if !yield(p.Key, p.Value) {
+				return
+			}
+		}
+	}
+}
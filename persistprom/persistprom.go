@@ -0,0 +1,77 @@
+// Package persistprom provides a [persist.MetricsHooks] implementation that
+// exports Prometheus metrics. It is a separate module so that persist itself
+// does not depend on the Prometheus client.
+package persistprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"libdb.so/persist"
+)
+
+// Hooks is a persist.MetricsHooks that updates Prometheus metrics.
+type Hooks struct {
+	txTotal    *prometheus.CounterVec
+	txErrors   *prometheus.CounterVec
+	txDuration *prometheus.HistogramVec
+	valueBytes *prometheus.HistogramVec
+}
+
+var _ persist.MetricsHooks = (*Hooks)(nil)
+
+// New creates a new Hooks and registers its metrics into reg. It panics if the
+// metrics cannot be registered, e.g. because New was already called with the
+// same registerer.
+//
+// The following metrics are exported, each labeled by the transaction mode
+// ("ro" or "rw") or value operation ("read" or "write"):
+//
+//   - persist_transactions_total
+//   - persist_transaction_errors_total
+//   - persist_transaction_duration_seconds
+//   - persist_value_bytes
+func New(reg prometheus.Registerer) *Hooks {
+	h := &Hooks{
+		txTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "persist",
+			Name:      "transactions_total",
+			Help:      "Total number of driver transactions.",
+		}, []string{"mode"}),
+		txErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "persist",
+			Name:      "transaction_errors_total",
+			Help:      "Total number of driver transactions that returned an error.",
+		}, []string{"mode"}),
+		txDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "persist",
+			Name:      "transaction_duration_seconds",
+			Help:      "Duration of driver transactions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"mode"}),
+		valueBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "persist",
+			Name:      "value_bytes",
+			Help:      "Size of values read from or written to the driver.",
+			Buckets:   prometheus.ExponentialBuckets(16, 4, 10),
+		}, []string{"op"}),
+	}
+
+	reg.MustRegister(h.txTotal, h.txErrors, h.txDuration, h.valueBytes)
+	return h
+}
+
+// ObserveTx implements persist.MetricsHooks.
+func (h *Hooks) ObserveTx(mode persist.TxMode, took time.Duration, err error) {
+	label := mode.String()
+	h.txTotal.WithLabelValues(label).Inc()
+	h.txDuration.WithLabelValues(label).Observe(took.Seconds())
+	if err != nil {
+		h.txErrors.WithLabelValues(label).Inc()
+	}
+}
+
+// ObserveValue implements persist.MetricsHooks.
+func (h *Hooks) ObserveValue(op persist.ValueOp, size int) {
+	h.valueBytes.WithLabelValues(op.String()).Observe(float64(size))
+}
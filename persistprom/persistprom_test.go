@@ -0,0 +1,41 @@
+package persistprom_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"libdb.so/persist"
+	"libdb.so/persist/driver/badgerdb"
+	"libdb.so/persist/persistprom"
+)
+
+func TestHooks(t *testing.T) {
+	d, err := badgerdb.Open(":memory:")
+	assert.NoError(t, err, "badgerdb.Open")
+	defer d.Close()
+
+	reg := prometheus.NewPedanticRegistry()
+	d = persist.WithMetrics(d, persistprom.New(reg))
+
+	m := persist.NewMapFromEncoders(d, persist.EncoderPair[string, string]{
+		Key:   persist.StringEncoder[string](),
+		Value: persist.StringEncoder[string](),
+	})
+
+	err = m.Store("key", "value")
+	assert.NoError(t, err, "Store")
+
+	_, _, err = m.Load("key")
+	assert.NoError(t, err, "Load")
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP persist_transactions_total Total number of driver transactions.
+# TYPE persist_transactions_total counter
+persist_transactions_total{mode="ro"} 1
+persist_transactions_total{mode="rw"} 1
+`), "persist_transactions_total")
+	assert.NoError(t, err, "GatherAndCompare")
+}
@@ -0,0 +1,82 @@
+package persist
+
+import "bytes"
+
+// PrefixedDriver wraps a driver so that all keys are transparently stored under
+// the given prefix. Get, Set and Delete prepend the prefix to keys, while Each
+// and EachKey only visit keys that have the prefix and strip it before passing
+// them on. This allows many independent maps to share a single driver, e.g. one
+// badger database, by wrapping it with a different prefix for each map.
+//
+// Prefixes should not be prefixes of each other, otherwise the keys of one map
+// may be visible to another.
+//
+// Closing the returned driver does nothing, since the wrapped driver is
+// usually shared. The wrapped driver must be closed by the caller instead.
+func PrefixedDriver(d Driver, prefix []byte) Driver {
+	return prefixedDriver{d, append([]byte(nil), prefix...)}
+}
+
+type prefixedDriver struct {
+	d      Driver
+	prefix []byte
+}
+
+func (d prefixedDriver) Close() error { return nil }
+
+func (d prefixedDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	return d.d.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return f(prefixedROTx{tx, d.prefix})
+	})
+}
+
+func (d prefixedDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	return d.d.AcquireRW(func(tx DriverReadWriteTx) error {
+		return f(prefixedRWTx{prefixedROTx{tx, d.prefix}, tx})
+	})
+}
+
+type prefixedROTx struct {
+	tx     DriverReadOnlyTx
+	prefix []byte
+}
+
+func (tx prefixedROTx) key(k []byte) []byte {
+	pk := make([]byte, 0, len(tx.prefix)+len(k))
+	return append(append(pk, tx.prefix...), k...)
+}
+
+func (tx prefixedROTx) Get(k []byte) ([]byte, bool, error) {
+	return tx.tx.Get(tx.key(k))
+}
+
+func (tx prefixedROTx) Each(f func(k, v []byte) error) error {
+	return tx.tx.Each(func(k, v []byte) error {
+		if !bytes.HasPrefix(k, tx.prefix) {
+			return nil
+		}
+		return f(k[len(tx.prefix):], v)
+	})
+}
+
+func (tx prefixedROTx) EachKey(f func(k []byte) error) error {
+	return tx.tx.EachKey(func(k []byte) error {
+		if !bytes.HasPrefix(k, tx.prefix) {
+			return nil
+		}
+		return f(k[len(tx.prefix):])
+	})
+}
+
+type prefixedRWTx struct {
+	prefixedROTx
+	rw DriverReadWriteTx
+}
+
+func (tx prefixedRWTx) Set(k, v []byte) error {
+	return tx.rw.Set(tx.key(k), v)
+}
+
+func (tx prefixedRWTx) Delete(k []byte) error {
+	return tx.rw.Delete(tx.key(k))
+}
@@ -0,0 +1,96 @@
+package persist
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EncoderStat is the result of profiling a single encoder using
+// [EncoderReport].
+type EncoderStat struct {
+	// Name is the name of the encoder as given to EncoderReport.
+	Name string
+	// Size is the size of the encoded value in bytes.
+	Size int
+	// EncodeTime is the average time taken to encode the value.
+	EncodeTime time.Duration
+	// DecodeTime is the average time taken to decode the value.
+	DecodeTime time.Duration
+	// Err is the error returned while encoding or decoding the value, if any.
+	// The other fields except Name are zero if Err is not nil.
+	Err error
+}
+
+// encoderReportDuration is roughly how long each encoder is timed for in each
+// direction by EncoderReport.
+const encoderReportDuration = 20 * time.Millisecond
+
+// EncoderReport encodes and decodes v using each of the given encoders and
+// reports the encoded size and the average time taken by each. Use it to pick
+// an encoder for a value type based on data rather than guesswork, e.g.:
+//
+//	stats := persist.EncoderReport(sample, map[string]persist.Encoder[T]{
+//		"cbor": persist.CBOREncoder[T](),
+//		"json": persist.JSONEncoder[T](""),
+//	})
+//
+// The stats are sorted by name. Each encoder is timed for a short while, so
+// the report takes longer the more encoders are given.
+func EncoderReport[T any](v T, encoders map[string]Encoder[T]) []EncoderStat {
+	stats := make([]EncoderStat, 0, len(encoders))
+	for name, enc := range encoders {
+		stat, err := profileEncoder(v, enc)
+		if err != nil {
+			stat = EncoderStat{Err: err}
+		}
+		stat.Name = name
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+func profileEncoder[T any](v T, enc Encoder[T]) (EncoderStat, error) {
+	b, err := enc.Encode(v, nil)
+	if err != nil {
+		return EncoderStat{}, fmt.Errorf("encode: %w", err)
+	}
+	if _, err := enc.Decode(b); err != nil {
+		return EncoderStat{}, fmt.Errorf("decode: %w", err)
+	}
+
+	// Copy the encoded value, since encoding into buf below may overwrite b.
+	b = append([]byte(nil), b...)
+	buf := make([]byte, 0, len(b))
+
+	return EncoderStat{
+		Size: len(b),
+		EncodeTime: timeOp(func() {
+			buf, _ = enc.Encode(v, buf)
+		}),
+		DecodeTime: timeOp(func() {
+			enc.Decode(b)
+		}),
+	}, nil
+}
+
+// timeOp returns the average time taken by f. f is called repeatedly, doubling
+// the number of calls each round until a round takes at least
+// encoderReportDuration.
+func timeOp(f func()) time.Duration {
+	for n := 1; ; n *= 2 {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			f()
+		}
+		took := time.Since(start)
+		if took >= encoderReportDuration {
+			return took / time.Duration(n)
+		}
+	}
+}
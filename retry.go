@@ -0,0 +1,118 @@
+package persist
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how a driver wrapped using [WithRetry] retries its
+// transactions.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a transaction is attempted,
+	// including the first attempt. Values below 1 are treated as 1.
+	MaxAttempts int
+	// Retryable reports whether a failed transaction should be retried given
+	// the error it returned. If nil, [DefaultRetryable] is used.
+	//
+	// Errors returned by the function given to the transaction are never
+	// retried, since they are not caused by the driver; neither are errors
+	// that stop iteration early.
+	Retryable func(err error) bool
+	// InitialBackoff is how long to wait before the first retry. The wait is
+	// doubled after every retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries. 0 means no cap.
+	MaxBackoff time.Duration
+}
+
+// WithRetry wraps a driver so that AcquireRO and AcquireRW are retried with
+// exponential backoff according to policy. Since every Map operation goes
+// through these, this makes all of them retry.
+//
+// Transactions may be run more than once, which drivers are already allowed
+// to do, so the function given to them must not have side effects beyond the
+// transaction.
+func WithRetry(d Driver, policy RetryPolicy) Driver {
+	return retryDriver{d, policy}
+}
+
+type retryDriver struct {
+	Driver
+	policy RetryPolicy
+}
+
+var (
+	_ DriverUnwrapper        = retryDriver{}
+	_ DriverWithCapabilities = retryDriver{}
+)
+
+func (d retryDriver) Unwrap() Driver { return d.Driver }
+
+// Capabilities reports the capabilities of the wrapped driver, whose
+// transactions are passed through as they are.
+func (d retryDriver) Capabilities() DriverCapabilities {
+	return Capabilities(d.Driver)
+}
+
+// DefaultRetryable is the [RetryPolicy.Retryable] function used if none is
+// set. It retries transactions that failed with [ErrConflict] or with an error
+// that reports itself as temporary, such as some system call errors.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+func (d retryDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	return d.retry(func(failed *bool) error {
+		return d.Driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			err := f(tx)
+			*failed = err != nil
+			return err
+		})
+	})
+}
+
+func (d retryDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	return d.retry(func(failed *bool) error {
+		return d.Driver.AcquireRW(func(tx DriverReadWriteTx) error {
+			err := f(tx)
+			*failed = err != nil
+			return err
+		})
+	})
+}
+
+// retry runs f until it succeeds or must not be retried. f sets failed if the
+// function given to the transaction returned an error.
+func (d retryDriver) retry(f func(failed *bool) error) error {
+	retryable := d.policy.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+
+	backoff := d.policy.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		var failed bool
+		err := f(&failed)
+		if err == nil || attempt >= d.policy.MaxAttempts || failed {
+			return err
+		}
+		if errors.Is(err, driverStopIteration) || errors.Is(err, StopIteration) {
+			return err
+		}
+		if !retryable(err) {
+			return err
+		}
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if d.policy.MaxBackoff > 0 && backoff > d.policy.MaxBackoff {
+			backoff = d.policy.MaxBackoff
+		}
+	}
+}
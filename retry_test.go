@@ -0,0 +1,149 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+var errFlaky = errors.New("flaky")
+
+// flakyDriver fails the first fails transactions with err, or errFlaky if err
+// is nil.
+type flakyDriver struct {
+	Driver
+	fails    int
+	err      error
+	attempts int
+}
+
+func (d *flakyDriver) AcquireRO(f func(DriverReadOnlyTx) error) error {
+	if err := d.fail(); err != nil {
+		return err
+	}
+	return d.Driver.AcquireRO(f)
+}
+
+func (d *flakyDriver) AcquireRW(f func(DriverReadWriteTx) error) error {
+	if err := d.fail(); err != nil {
+		return err
+	}
+	return d.Driver.AcquireRW(f)
+}
+
+func (d *flakyDriver) fail() error {
+	d.attempts++
+	if d.attempts > d.fails {
+		return nil
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return errFlaky
+}
+
+func TestWithRetry(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		Retryable:      func(err error) bool { return errors.Is(err, errFlaky) },
+		InitialBackoff: time.Millisecond,
+	}
+
+	newMap := func(fails int) (Map[string, int], *flakyDriver) {
+		flaky := &flakyDriver{Driver: d, fails: fails}
+		return NewMapFromEncoders(WithRetry(flaky, policy), EncoderPair[string, int]{
+			Key:   CBOREncoder[string](),
+			Value: CBOREncoder[int](),
+		}), flaky
+	}
+
+	m, flaky := newMap(2)
+	err = m.Store("a", 1)
+	assert.NoError(t, err, "Store after 2 failures")
+	assert.Equal(t, 3, flaky.attempts, "attempts")
+
+	m, flaky = newMap(2)
+	v, err := m.Get("a")
+	assert.NoError(t, err, "Get after 2 failures")
+	assert.Equal(t, 1, v, "Get after 2 failures")
+	assert.Equal(t, 3, flaky.attempts, "attempts")
+
+	m, flaky = newMap(3)
+	err = m.Store("a", 2)
+	assert.IsError(t, err, errFlaky, "Store after 3 failures")
+	assert.Equal(t, 3, flaky.attempts, "attempts")
+
+	// Errors that are not retryable are returned immediately.
+	errBad := errors.New("bad")
+	m, flaky = newMap(0)
+	_, err = m.Update("a", func(int, bool) (int, error) { return 0, errBad })
+	assert.IsError(t, err, errBad, "Update")
+	assert.Equal(t, 1, flaky.attempts, "attempts")
+}
+
+func TestWithRetryDefault(t *testing.T) {
+	d, err := CBORDriver(filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "CBORDriver")
+	defer d.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	newMap := func(fails int, err error) (Map[string, int], *flakyDriver) {
+		flaky := &flakyDriver{Driver: d, fails: fails, err: err}
+		return NewMapFromEncoders(WithRetry(flaky, policy), EncoderPair[string, int]{
+			Key:   CBOREncoder[string](),
+			Value: CBOREncoder[int](),
+		}), flaky
+	}
+
+	m, flaky := newMap(2, fmt.Errorf("commit: %w", ErrConflict))
+	err = m.Store("a", 1)
+	assert.NoError(t, err, "Store after 2 conflicts")
+	assert.Equal(t, 3, flaky.attempts, "attempts")
+
+	m, flaky = newMap(1, nil)
+	err = m.Store("a", 1)
+	assert.IsError(t, err, errFlaky, "Store after 1 failure")
+	assert.Equal(t, 1, flaky.attempts, "attempts")
+
+	assert.NoError(t, m.Store("b", 2), "Store b")
+
+	// Errors returned by the transaction's function are never retried.
+	m, flaky = newMap(0, nil)
+	_, err = m.Update("missing", func(int, bool) (int, error) { return 0, ErrNotFound })
+	assert.IsError(t, err, ErrNotFound, "Update")
+	assert.Equal(t, 1, flaky.attempts, "attempts")
+
+	// Neither is breaking out of iteration.
+	m, flaky = newMap(0, nil)
+	var n int
+	m.All()(func(string, int) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n, "All")
+	assert.Equal(t, 1, flaky.attempts, "attempts")
+
+	m, flaky = newMap(0, nil)
+	n = 0
+	err = m.View(func(r MapReader[string, int]) error {
+		return r.Each(func(string, int) error {
+			n++
+			return StopIteration
+		})
+	})
+	assert.NoError(t, err, "View")
+	assert.Equal(t, 1, n, "Each")
+	assert.Equal(t, 1, flaky.attempts, "attempts")
+}
@@ -0,0 +1,204 @@
+package persist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// sliceLenKey is the reserved key that a Slice stores its length under.
+const sliceLenKey = reservedKeyPrefix + "slice.len"
+
+// ErrIndexOutOfRange is returned by [Slice] methods when an index is not
+// within the slice.
+var ErrIndexOutOfRange = errors.New("persist: slice index out of range")
+
+// Slice is a list of values that are stored element-wise, each under its
+// index, rather than as a single encoded slice. Appending to or changing a
+// single element therefore only writes that element, and elements can be read
+// without decoding the whole list. The length is stored alongside the
+// elements, so the underlying map must not hold anything else.
+type Slice[V any] struct {
+	m Map[int, V]
+}
+
+// NewSlice returns a new Slice stored in m.
+func NewSlice[V any](m Map[int, V]) Slice[V] {
+	return Slice[V]{m}
+}
+
+// Map returns the underlying map.
+func (s Slice[V]) Map() Map[int, V] {
+	return s.m
+}
+
+// Len returns the length of the slice.
+func (s Slice[V]) Len() (int, error) {
+	if s.m.driver == nil {
+		return 0, ErrNotInitialized
+	}
+
+	var n int
+	err := s.m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		var err error
+		n, err = s.len(tx)
+		return err
+	})
+	return n, err
+}
+
+func (s Slice[V]) len(tx DriverReadOnlyTx) (int, error) {
+	b, ok, err := tx.Get([]byte(sliceLenKey))
+	if err != nil {
+		return 0, &DriverError{"get length", err}
+	}
+	if !ok {
+		return 0, nil
+	}
+	if len(b) != 8 {
+		return 0, fmt.Errorf("persist: invalid slice length of %d bytes", len(b))
+	}
+	return int(binary.BigEndian.Uint64(b)), nil
+}
+
+// Append atomically appends vs to the end of the slice.
+func (s Slice[V]) Append(vs ...V) error {
+	if s.m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	return s.m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		n, err := s.len(tx)
+		if err != nil {
+			return err
+		}
+
+		for i, v := range vs {
+			if err := s.set(tx, n+i, v); err != nil {
+				return err
+			}
+		}
+
+		b := binary.BigEndian.AppendUint64(nil, uint64(n+len(vs)))
+		return driverError("set length", tx.Set([]byte(sliceLenKey), b))
+	})
+}
+
+// Get gets the element at index i. It returns [ErrIndexOutOfRange] if i is not
+// within the slice.
+func (s Slice[V]) Get(i int) (V, error) {
+	var v V
+	if s.m.driver == nil {
+		return v, ErrNotInitialized
+	}
+
+	err := s.m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		n, err := s.len(tx)
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= n {
+			return ErrIndexOutOfRange
+		}
+		v, err = s.get(tx, i)
+		return err
+	})
+	return v, err
+}
+
+// Set sets the element at index i. It returns [ErrIndexOutOfRange] if i is not
+// within the slice.
+func (s Slice[V]) Set(i int, v V) error {
+	if s.m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	return s.m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		n, err := s.len(tx)
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= n {
+			return ErrIndexOutOfRange
+		}
+		return s.set(tx, i, v)
+	})
+}
+
+// All returns an iterator over all elements of the slice in order.
+func (s Slice[V]) All() Seq2[int, V] {
+	return s.Range(0, -1)
+}
+
+// Range returns an iterator over the elements from index from up to but not
+// including to, in order. If to is negative or beyond the end of the slice,
+// then the iteration stops at the end of the slice. All elements are read
+// within a single transaction.
+func (s Slice[V]) Range(from, to int) Seq2[int, V] {
+	return func(yield func(int, V) bool) {
+		if s.m.driver == nil {
+			return
+		}
+		s.m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+			n, err := s.len(tx)
+			if err != nil {
+				return err
+			}
+			if to < 0 || to > n {
+				to = n
+			}
+
+			for i := max(from, 0); i < to; i++ {
+				v, err := s.get(tx, i)
+				if err != nil {
+					return err
+				}
+				if !yield(i, v) {
+					return driverStopIteration
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func (s Slice[V]) get(tx DriverReadOnlyTx, i int) (V, error) {
+	var v V
+
+	bk, err := s.m.kencoder.Encode(i, nil)
+	if err != nil {
+		return v, &EncodeError{"encode key", err}
+	}
+
+	bv, ok, err := tx.Get(bk)
+	if err != nil {
+		return v, &DriverError{"get value", err}
+	}
+	if !ok {
+		return v, fmt.Errorf("persist: slice element %d is missing", i)
+	}
+
+	v, err = s.m.valueEncoder(bk).Decode(bv)
+	if err != nil {
+		return v, &EncodeError{"decode value", err}
+	}
+	return v, nil
+}
+
+func (s Slice[V]) set(tx DriverReadWriteTx, i int, v V) error {
+	bk, err := s.m.kencoder.Encode(i, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := s.m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := s.m.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	return driverError("set value", tx.Set(bk, bv))
+}
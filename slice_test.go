@@ -0,0 +1,60 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSlice(t *testing.T) {
+	m, err := NewMap[int, string](CBORDriver, filepath.Join(t.TempDir(), "test.cbor"))
+	assert.NoError(t, err, "NewMap")
+	defer m.Close()
+
+	s := NewSlice(m)
+
+	n, err := s.Len()
+	assert.NoError(t, err, "Len empty")
+	assert.Equal(t, 0, n, "Len empty")
+
+	assert.NoError(t, s.Append("a", "b"), "Append a b")
+	assert.NoError(t, s.Append("c"), "Append c")
+	assert.NoError(t, s.Set(1, "B"), "Set 1")
+
+	n, err = s.Len()
+	assert.NoError(t, err, "Len")
+	assert.Equal(t, 3, n, "Len")
+
+	v, err := s.Get(2)
+	assert.NoError(t, err, "Get 2")
+	assert.Equal(t, "c", v, "Get 2")
+
+	_, err = s.Get(3)
+	assert.IsError(t, err, ErrIndexOutOfRange, "Get 3")
+	assert.IsError(t, s.Set(-1, "x"), ErrIndexOutOfRange, "Set -1")
+
+	var all []string
+	s.All()(func(i int, v string) bool {
+		assert.Equal(t, len(all), i, "index")
+		all = append(all, v)
+		return true
+	})
+	assert.Equal(t, []string{"a", "B", "c"}, all, "All")
+
+	var ranged []string
+	s.Range(1, 10)(func(_ int, v string) bool {
+		ranged = append(ranged, v)
+		return true
+	})
+	assert.Equal(t, []string{"B", "c"}, ranged, "Range")
+
+	// The length is stored under a reserved key, so the map only has the
+	// elements.
+	var keys []int
+	m.Keys()(func(k int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []int{0, 1, 2}, keys, "Keys")
+}
@@ -0,0 +1,109 @@
+package persist
+
+import "bytes"
+
+// Snapshot is a read-only view of a Map as it was at a single point in time.
+// It must be closed once it is no longer needed. A Snapshot must not be used
+// concurrently.
+type Snapshot[K, V any] struct {
+	MapReader[K, V]
+	tx DriverSnapshot
+}
+
+// Snapshot returns a read-only view of the map as it is now. All reads made
+// through the snapshot are consistent with each other, regardless of writes
+// made to the map in the meantime.
+//
+// If the driver implements [DriverSnapshotter], then the snapshot holds a
+// read-only transaction open until it is closed. For badger, this keeps
+// old versions of every key that is written in the meantime from being
+// garbage collected, so snapshots should not be held for long.
+//
+// Otherwise, the whole map is copied into memory within a single read-only
+// transaction, which costs as much memory as the encoded map itself.
+func (m Map[K, V]) Snapshot() (Snapshot[K, V], error) {
+	if m.driver == nil {
+		return Snapshot[K, V]{}, ErrNotInitialized
+	}
+
+	var tx DriverSnapshot
+
+	if s, ok := driverAs[DriverSnapshotter](m.driver); ok {
+		var err error
+		tx, err = s.Snapshot()
+		if err != nil {
+			return Snapshot[K, V]{}, err
+		}
+	} else {
+		copied := make(memorySnapshot)
+		err := m.driver.AcquireRO(func(rotx DriverReadOnlyTx) error {
+			return rotx.Each(func(k, v []byte) error {
+				copied[string(k)] = bytes.Clone(v)
+				return nil
+			})
+		})
+		if err != nil {
+			return Snapshot[K, V]{}, err
+		}
+		tx = copied
+	}
+
+	return Snapshot[K, V]{MapReader[K, V]{m, tx}, tx}, nil
+}
+
+// All returns an iterator over all key-value pairs in the snapshot.
+func (s Snapshot[K, V]) All() Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		s.Each(func(k K, v V) error {
+			if !yield(k, v) {
+				return driverStopIteration
+			}
+			return nil
+		})
+	}
+}
+
+// Keys returns an iterator over all keys in the snapshot.
+func (s Snapshot[K, V]) Keys() Seq[K] {
+	return func(yield func(K) bool) {
+		s.EachKey(func(k K) error {
+			if !yield(k) {
+				return driverStopIteration
+			}
+			return nil
+		})
+	}
+}
+
+// Close releases the snapshot.
+func (s Snapshot[K, V]) Close() error {
+	return s.tx.Close()
+}
+
+// memorySnapshot is a DriverSnapshot over a copy of a database.
+type memorySnapshot map[string][]byte
+
+func (s memorySnapshot) Get(k []byte) ([]byte, bool, error) {
+	v, ok := s[string(k)]
+	return v, ok, nil
+}
+
+func (s memorySnapshot) Each(f func(k, v []byte) error) error {
+	for k, v := range s {
+		if err := f([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s memorySnapshot) EachKey(f func(k []byte) error) error {
+	for k := range s {
+		if err := f([]byte(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s memorySnapshot) Close() error { return nil }
@@ -0,0 +1,115 @@
+package persist
+
+import "errors"
+
+// Stats are statistics about the encoded entries of a map.
+type Stats struct {
+	// Count is the number of entries.
+	Count int
+	// KeyBytes and ValueBytes are the total sizes of all encoded keys and
+	// values.
+	KeyBytes   int64
+	ValueBytes int64
+	// MinValueSize, MaxValueSize and AvgValueSize are the smallest, largest
+	// and mean sizes of an encoded value. They are 0 if the map is empty.
+	MinValueSize int
+	MaxValueSize int
+	AvgValueSize float64
+}
+
+// Stats computes statistics about the map's entries within a single read-only
+// transaction. Only the encoded sizes are looked at, so nothing is decoded.
+func (m Map[K, V]) Stats() (Stats, error) {
+	if m.driver == nil {
+		return Stats{}, ErrNotInitialized
+	}
+
+	var s Stats
+
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		s = Stats{}
+		return tx.Each(func(k, v []byte) error {
+			if isReservedKey(k) {
+				return nil
+			}
+
+			if s.Count == 0 || len(v) < s.MinValueSize {
+				s.MinValueSize = len(v)
+			}
+			if len(v) > s.MaxValueSize {
+				s.MaxValueSize = len(v)
+			}
+
+			s.Count++
+			s.KeyBytes += int64(len(k))
+			s.ValueBytes += int64(len(v))
+			return nil
+		})
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if s.Count > 0 {
+		s.AvgValueSize = float64(s.ValueBytes) / float64(s.Count)
+	}
+
+	return s, nil
+}
+
+// Reduce folds all key-value pairs of the map into an accumulator within a
+// single read-only transaction. fn is called for each pair with the current
+// accumulator, starting with init, and returns the next one. If decoding a
+// pair or fn fails, then the error is returned along with the accumulator as
+// it was before the failing pair. If fn returns [StopIteration], then the
+// accumulator as it was before that pair is returned without an error.
+//
+// This is a function rather than a method because methods cannot have type
+// parameters.
+func Reduce[K, V, A any](m Map[K, V], init A, fn func(acc A, k K, v V) (A, error)) (A, error) {
+	if m.driver == nil {
+		return init, ErrNotInitialized
+	}
+
+	acc := init
+	err := m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		acc = init
+		return m.each(tx, func(k K, v V) error {
+			next, err := fn(acc, k, v)
+			if err != nil {
+				return err
+			}
+			acc = next
+			return nil
+		})
+	})
+	return acc, ignoreStop(err)
+}
+
+// Find returns the first key-value pair of the map for which pred returns
+// true, reading within a single read-only transaction. The scan stops at the
+// first match. If no pair matches, then ok is false.
+//
+// Pairs are visited in the order of [Map.All], so "first" is only meaningful
+// for drivers that iterate in order, see [Map.IsOrdered].
+func Find[K, V any](m Map[K, V], pred func(K, V) bool) (k K, v V, ok bool, err error) {
+	if m.driver == nil {
+		return k, v, false, ErrNotInitialized
+	}
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return m.each(tx, func(fk K, fv V) error {
+			if !pred(fk, fv) {
+				return nil
+			}
+			k, v, ok = fk, fv, true
+			return driverStopIteration
+		})
+	})
+	if err != nil && !errors.Is(err, driverStopIteration) {
+		var zk K
+		var zv V
+		return zk, zv, false, err
+	}
+	return k, v, ok, nil
+}
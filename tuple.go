@@ -0,0 +1,165 @@
+package persist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Tuple is a compound key made of multiple parts. See [KeyBuilder].
+type Tuple []any
+
+// KeyBuilder is an Encoder for compound keys. Each part of a [Tuple] is
+// encoded with a tag byte for its type, so keys never collide regardless of
+// what the parts contain, and encoded keys sort in the same order as their
+// parts, compared one by one. Tuples that are a prefix of another sort first,
+// so all keys sharing leading parts can be found using a prefix scan.
+//
+// The supported part types are string, []byte, and all integer types. When
+// decoding, strings and byte slices are returned as-is, signed integers as
+// int64 and unsigned integers as uint64. Parts of different types sort by type:
+// byte slices, then strings, then signed integers, then unsigned integers.
+//
+// Strings and byte slices are not length-prefixed, since that would sort
+// shorter parts first regardless of their contents. Instead, they are
+// terminated by a zero byte, with zero bytes within them escaped.
+type KeyBuilder struct{}
+
+var _ Encoder[Tuple] = KeyBuilder{}
+
+const (
+	tupleTagBytes  = 0x01
+	tupleTagString = 0x02
+	tupleTagInt    = 0x03
+	tupleTagUint   = 0x04
+)
+
+// tupleEscape follows a zero byte within a string or byte slice part. A zero
+// byte followed by anything else terminates the part.
+const tupleEscape = 0xFF
+
+// EncodeKey encodes the given parts as a key using [KeyBuilder].
+func EncodeKey(parts ...any) ([]byte, error) {
+	return KeyBuilder{}.Encode(parts, nil)
+}
+
+// DecodeKey decodes a key encoded using [KeyBuilder].
+func DecodeKey(b []byte) (Tuple, error) {
+	return KeyBuilder{}.Decode(b)
+}
+
+func (KeyBuilder) Encode(t Tuple, buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	for i, part := range t {
+		switch part := part.(type) {
+		case []byte:
+			buf = appendTupleBytes(append(buf, tupleTagBytes), part)
+		case string:
+			buf = appendTupleBytes(append(buf, tupleTagString), []byte(part))
+		case int:
+			buf = appendTupleInt(buf, int64(part))
+		case int8:
+			buf = appendTupleInt(buf, int64(part))
+		case int16:
+			buf = appendTupleInt(buf, int64(part))
+		case int32:
+			buf = appendTupleInt(buf, int64(part))
+		case int64:
+			buf = appendTupleInt(buf, part)
+		case uint:
+			buf = appendTupleUint(buf, uint64(part))
+		case uint8:
+			buf = appendTupleUint(buf, uint64(part))
+		case uint16:
+			buf = appendTupleUint(buf, uint64(part))
+		case uint32:
+			buf = appendTupleUint(buf, uint64(part))
+		case uint64:
+			buf = appendTupleUint(buf, part)
+		default:
+			return nil, fmt.Errorf("persist: unsupported key part %d of type %T", i, part)
+		}
+	}
+	return buf, nil
+}
+
+func appendTupleBytes(buf, b []byte) []byte {
+	for {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			break
+		}
+		buf = append(buf, b[:i+1]...)
+		buf = append(buf, tupleEscape)
+		b = b[i+1:]
+	}
+	buf = append(buf, b...)
+	return append(buf, 0)
+}
+
+func appendTupleInt(buf []byte, n int64) []byte {
+	// Flipping the sign bit makes negative numbers sort before positive ones.
+	buf = append(buf, tupleTagInt)
+	return binary.BigEndian.AppendUint64(buf, uint64(n)^(1<<63))
+}
+
+func appendTupleUint(buf []byte, n uint64) []byte {
+	buf = append(buf, tupleTagUint)
+	return binary.BigEndian.AppendUint64(buf, n)
+}
+
+func (KeyBuilder) Decode(b []byte) (Tuple, error) {
+	var t Tuple
+	for len(b) > 0 {
+		tag := b[0]
+		b = b[1:]
+
+		switch tag {
+		case tupleTagBytes, tupleTagString:
+			part, n, err := readTupleBytes(b)
+			if err != nil {
+				return nil, fmt.Errorf("persist: key part %d: %w", len(t), err)
+			}
+			b = b[n:]
+			if tag == tupleTagString {
+				t = append(t, string(part))
+			} else {
+				t = append(t, part)
+			}
+		case tupleTagInt, tupleTagUint:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("persist: key part %d: unexpected end of key", len(t))
+			}
+			n := binary.BigEndian.Uint64(b)
+			b = b[8:]
+			if tag == tupleTagInt {
+				t = append(t, int64(n^(1<<63)))
+			} else {
+				t = append(t, n)
+			}
+		default:
+			return nil, fmt.Errorf("persist: key part %d: unknown tag 0x%02X", len(t), tag)
+		}
+	}
+	return t, nil
+}
+
+// readTupleBytes reads an escaped string or byte slice part. It returns the
+// unescaped part and the number of bytes read, including the terminator.
+func readTupleBytes(b []byte) ([]byte, int, error) {
+	part := []byte{}
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0 {
+			part = append(part, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == tupleEscape {
+			part = append(part, 0)
+			i++
+			continue
+		}
+		return part, i + 1, nil
+	}
+	return nil, 0, errors.New("unterminated string")
+}
@@ -0,0 +1,60 @@
+package persist
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestKeyBuilder(t *testing.T) {
+	// Tuples in ascending order.
+	tuples := []Tuple{
+		{[]byte{}},
+		{[]byte{0}},
+		{[]byte{0, 0}},
+		{[]byte{0, 1}},
+		{"a"},
+		{"a", int64(math.MinInt64)},
+		{"a", int64(-1)},
+		{"a", int64(0)},
+		{"a", int64(math.MaxInt64)},
+		{"a", uint64(0)},
+		{"a", uint64(math.MaxUint64)},
+		{"a\x00", "b"},
+		{"a/b", "c"},
+		{"ab"},
+		{"tenant", int64(2), "user", int64(1)},
+		{"tenant", int64(10), "user", int64(1)},
+	}
+
+	keys := make([][]byte, len(tuples))
+	for i, tuple := range tuples {
+		var err error
+		keys[i], err = EncodeKey(tuple...)
+		assert.NoError(t, err, "EncodeKey %v", tuple)
+
+		decoded, err := DecodeKey(keys[i])
+		assert.NoError(t, err, "DecodeKey %v", tuple)
+		assert.Equal(t, tuple, decoded, "DecodeKey")
+	}
+
+	assert.True(t, sort.SliceIsSorted(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	}), "encoded keys must sort like their tuples")
+
+	// Smaller integer types are widened.
+	k, err := EncodeKey(int8(-3), uint16(3))
+	assert.NoError(t, err, "EncodeKey small ints")
+	decoded, err := DecodeKey(k)
+	assert.NoError(t, err, "DecodeKey small ints")
+	assert.Equal(t, Tuple{int64(-3), uint64(3)}, decoded, "DecodeKey small ints")
+
+	_, err = EncodeKey(1.5)
+	assert.Error(t, err, "EncodeKey float")
+
+	_, err = DecodeKey([]byte{tupleTagString, 'a'})
+	assert.Error(t, err, "DecodeKey unterminated")
+}
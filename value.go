@@ -1,5 +1,10 @@
 package persist
 
+import (
+	"context"
+	"fmt"
+)
+
 const valueKey valueKeyT = 0
 
 type valueKeyT = int
@@ -8,14 +13,38 @@ type valueKeyT = int
 type Value[V any] interface {
 	// Store sets the value.
 	Store(value V) error
-	// Load gets the value.
+	// Load gets the value. The returned bool reports whether a value was
+	// stored, even if that value is nil.
 	Load() (V, bool, error)
+	// Get gets the value like Load, except it returns [ErrNotFound] if no
+	// value was stored, so that absence cannot be mistaken for a stored zero
+	// value.
+	Get() (V, error)
+	// LoadOr gets the value like Load, except it returns def if no value was
+	// stored.
+	LoadOr(def V) (V, error)
+	// Exists reports whether a value was stored without decoding it.
+	Exists() (bool, error)
 	// LoadOrStore gets the value, or stores the value if it doesn't exist.
 	LoadOrStore(value V) (actual V, loaded bool, err error)
 	// LoadAndDelete gets the value and deletes it.
 	LoadAndDelete() (V, bool, error)
+	// Update atomically updates the value. See [Map.Update].
+	Update(f func(v V, ok bool) (V, error)) (V, error)
 	// Delete deletes the value.
 	Delete() error
+	// Subscribe returns a channel that receives the new value every time it
+	// is stored, until ctx is done, after which the channel is closed.
+	// Deletions are not reported.
+	//
+	// The channel only holds the latest value: if the consumer falls behind,
+	// then older values are dropped in favor of newer ones, so writers are
+	// never blocked.
+	//
+	// If the driver implements [DriverWatcher], then all writes to the value
+	// are reported, including those made through other handles. Otherwise,
+	// only writes made through this Value and its copies are reported.
+	Subscribe(ctx context.Context) (<-chan V, error)
 	// Close closes the value.
 	Close() error
 }
@@ -27,7 +56,7 @@ func NewValue[V any](driverOpener DriverOpenFunc, path string) (Value[V], error)
 	if err != nil {
 		return nil, err
 	}
-	return mappedValue[valueKeyT, V]{m, valueKey}, nil
+	return newMappedValue[valueKeyT, V](m, valueKey), nil
 }
 
 // NewValueWithDefault returns a new [Value] using the default CBOR encoder and
@@ -45,20 +74,82 @@ func NewValueWithDefault[V any](driverOpener DriverOpenFunc, path string, def V)
 	return v, nil
 }
 
+// NewNamedValue returns a new [Value] like [NewValue], except that the value is
+// stored under the given name as its literal key. Use this to keep several
+// values, or values and maps, in the same database without their keys
+// colliding.
+func NewNamedValue[V any](driverOpener DriverOpenFunc, path, name string) (Value[V], error) {
+	driver, err := driverOpener(path)
+	if err != nil {
+		return nil, err
+	}
+	m := NewMapFromEncoders(driver, EncoderPair[string, V]{
+		Key:   StringEncoder[string](),
+		Value: CBOREncoder[V](),
+	})
+	return newMappedValue(m, name), nil
+}
+
+// NewValueFromEncoder returns a new [Value] over the given driver that encodes
+// the value using enc. The value is stored under the same key as [NewValue],
+// so either can be used to open the same database as long as the encoders
+// agree.
+func NewValueFromEncoder[V any](driver Driver, enc Encoder[V]) Value[V] {
+	m := NewMapFromEncoders(driver, EncoderPair[valueKeyT, V]{
+		Key:   CBOREncoder[valueKeyT](),
+		Value: enc,
+	})
+	return newMappedValue[valueKeyT, V](m, valueKey)
+}
+
 // NewMappedValue returns a new [Value] using the provided map and key.
 func NewMappedValue[K, V any](m Map[K, V], key K) Value[V] {
-	return mappedValue[K, V]{m, key}
+	return newMappedValue(m, key)
+}
+
+// MigrateValue copies the value in src into dst, e.g. to move a value from a
+// shared map created using [NewMappedValue] into its own database. If src has
+// no value, then dst's value is deleted, so dst always ends up matching src.
+// src is left untouched.
+func MigrateValue[V any](src, dst Value[V]) error {
+	v, ok, err := src.Load()
+	if err != nil {
+		return fmt.Errorf("load source: %w", err)
+	}
+
+	if !ok {
+		if err := dst.Delete(); err != nil {
+			return fmt.Errorf("delete destination: %w", err)
+		}
+		return nil
+	}
+
+	if err := dst.Store(v); err != nil {
+		return fmt.Errorf("store destination: %w", err)
+	}
+	return nil
 }
 
 // mappedValue is a type-safe value with a custom key that persists to disk.
 type mappedValue[K, V any] struct {
 	m Map[K, V]
 	k K
+	// subs are the subscribers notified by this value's own writes. They are
+	// only used if the driver cannot watch for changes.
+	subs *valueSubscribers[V]
+}
+
+func newMappedValue[K, V any](m Map[K, V], k K) mappedValue[K, V] {
+	return mappedValue[K, V]{m, k, &valueSubscribers[V]{}}
 }
 
 // Store sets the value.
 func (m mappedValue[K, V]) Store(value V) error {
-	return m.m.Store(m.k, value)
+	if err := m.m.Store(m.k, value); err != nil {
+		return err
+	}
+	m.subs.notify(value)
+	return nil
 }
 
 // Load gets the value.
@@ -66,9 +157,28 @@ func (m mappedValue[K, V]) Load() (V, bool, error) {
 	return m.m.Load(m.k)
 }
 
+// Get gets the value or returns ErrNotFound.
+func (m mappedValue[K, V]) Get() (V, error) {
+	return m.m.Get(m.k)
+}
+
+// LoadOr gets the value or returns def.
+func (m mappedValue[K, V]) LoadOr(def V) (V, error) {
+	return m.m.LoadOr(m.k, def)
+}
+
+// Exists reports whether the value exists.
+func (m mappedValue[K, V]) Exists() (bool, error) {
+	return m.m.Contains(m.k)
+}
+
 // LoadOrStore gets the value, or stores the value if it doesn't exist.
 func (m mappedValue[K, V]) LoadOrStore(value V) (actual V, loaded bool, err error) {
-	return m.m.LoadOrStore(m.k, value)
+	actual, loaded, err = m.m.LoadOrStore(m.k, value)
+	if err == nil && !loaded {
+		m.subs.notify(actual)
+	}
+	return
 }
 
 // LoadAndDelete gets the value and deletes it.
@@ -76,6 +186,15 @@ func (m mappedValue[K, V]) LoadAndDelete() (V, bool, error) {
 	return m.m.LoadAndDelete(m.k)
 }
 
+// Update atomically updates the value.
+func (m mappedValue[K, V]) Update(f func(v V, ok bool) (V, error)) (V, error) {
+	v, err := m.m.Update(m.k, f)
+	if err == nil {
+		m.subs.notify(v)
+	}
+	return v, err
+}
+
 // Delete deletes the value.
 func (m mappedValue[K, V]) Delete() error {
 	return m.m.Delete(m.k)
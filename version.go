@@ -0,0 +1,162 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LoadVersion is like [Map.Load], except it also returns the version of the
+// key, which can be passed to [Map.StoreIfVersion] later. The version is 0 if
+// the key does not exist. The driver's transactions must implement
+// [DriverVersionedTx], otherwise an error wrapping [errors.ErrUnsupported] is
+// returned.
+func (m Map[K, V]) LoadVersion(k K) (v V, version uint64, ok bool, err error) {
+	if m.driver == nil {
+		err = ErrNotInitialized
+		return
+	}
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		err = &EncodeError{"encode key", err}
+		return
+	}
+
+	err = m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		vtx, isVersioned := tx.(DriverVersionedTx)
+		if !isVersioned {
+			return errVersionUnsupported
+		}
+
+		var bv []byte
+		var err error
+
+		bv, version, ok, err = vtx.GetVersion(bk)
+		if err != nil {
+			return &DriverError{"get value", err}
+		}
+		if ok {
+			v, err = m.valueEncoder(bk).Decode(bv)
+			if err != nil {
+				return &EncodeError{"decode value", err}
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		err = txError(err)
+	}
+	return
+}
+
+// StoreIfVersion stores a key-value pair only if the version of the key is
+// still version, as returned by [Map.LoadVersion]. Otherwise, nothing is
+// stored and an error wrapping [ErrVersionMismatch] is returned. A version of
+// 0 means that the key must not exist. The driver's read-write transactions
+// must implement [DriverVersionedRWTx], otherwise an error wrapping
+// [errors.ErrUnsupported] is returned.
+//
+// To store several keys conditionally within one transaction, use
+// [Map.StoreManyIfVersion].
+func (m Map[K, V]) StoreIfVersion(k K, v V, version uint64) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bk, err := m.kencoder.Encode(k, nil)
+	if err != nil {
+		return &EncodeError{"encode key", err}
+	}
+
+	bv, err := m.valueEncoder(bk).Encode(v, nil)
+	if err != nil {
+		return &EncodeError{"encode value", err}
+	}
+
+	if err := m.checkSize(bk, bv); err != nil {
+		return err
+	}
+
+	err = m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		vtx, ok := tx.(DriverVersionedRWTx)
+		if !ok {
+			return errVersionUnsupported
+		}
+		if err := vtx.SetIfVersion(bk, bv, version); err != nil {
+			return &DriverError{"set value", err}
+		}
+		return m.dropMeta(tx, bk)
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return txError(err)
+}
+
+// VersionedPair is a key-value pair to be stored by [Map.StoreManyIfVersion]
+// only if the version of the key is still Version.
+type VersionedPair[K, V any] struct {
+	Key     K
+	Value   V
+	Version uint64
+}
+
+// StoreManyIfVersion is like [Map.StoreIfVersion], except it stores all of the
+// given pairs within a single read-write transaction: either every key is
+// still at its version and all pairs are stored, or nothing is stored. If a
+// key was changed, then a [*BatchError] naming the first such pair and
+// wrapping [ErrVersionMismatch] is returned.
+//
+// Together with [Map.LoadVersion], this allows optimistic concurrency control
+// across multiple keys: load the versions of all keys involved, compute the
+// new values, then store them all conditionally, retrying from the start on
+// ErrVersionMismatch.
+func (m Map[K, V]) StoreManyIfVersion(pairs []VersionedPair[K, V]) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	bks := make([][]byte, len(pairs))
+	bvs := make([][]byte, len(pairs))
+
+	for i, p := range pairs {
+		bk, err := m.kencoder.Encode(p.Key, nil)
+		if err != nil {
+			return &BatchError[K]{i, p.Key, &EncodeError{"encode key", err}}
+		}
+
+		bv, err := m.valueEncoder(bk).Encode(p.Value, nil)
+		if err != nil {
+			return &BatchError[K]{i, p.Key, &EncodeError{"encode value", err}}
+		}
+
+		if err := m.checkSize(bk, bv); err != nil {
+			return &BatchError[K]{i, p.Key, err}
+		}
+
+		bks[i] = bk
+		bvs[i] = bv
+	}
+
+	err := m.driver.AcquireRW(func(tx DriverReadWriteTx) error {
+		vtx, ok := tx.(DriverVersionedRWTx)
+		if !ok {
+			return errVersionUnsupported
+		}
+		for i, p := range pairs {
+			if err := vtx.SetIfVersion(bks[i], bvs[i], p.Version); err != nil {
+				return &BatchError[K]{i, p.Key, &DriverError{"set value", err}}
+			}
+			if err := m.dropMeta(tx, bks[i]); err != nil {
+				return &BatchError[K]{i, p.Key, err}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return txError(err)
+}
+
+var errVersionUnsupported = fmt.Errorf("persist: driver does not support versions: %w", errors.ErrUnsupported)
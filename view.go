@@ -0,0 +1,83 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MapReader reads from a Map within a single read-only transaction, so all of
+// its reads observe the same consistent snapshot. A MapReader is only valid
+// while its transaction is open, i.e. within the function given to [Map.View]
+// or until its [Snapshot] is closed.
+type MapReader[K, V any] struct {
+	m  Map[K, V]
+	tx DriverReadOnlyTx
+}
+
+// View calls f with a MapReader over a single read-only transaction. The
+// error returned by f is returned as-is.
+func (m Map[K, V]) View(f func(r MapReader[K, V]) error) error {
+	if m.driver == nil {
+		return ErrNotInitialized
+	}
+
+	return m.driver.AcquireRO(func(tx DriverReadOnlyTx) error {
+		return f(MapReader[K, V]{m: m, tx: tx})
+	})
+}
+
+// Get gets a value by key. It behaves like [Map.Load].
+func (r MapReader[K, V]) Get(k K) (V, bool, error) {
+	var v V
+
+	bk, err := r.m.kencoder.Encode(k, nil)
+	if err != nil {
+		return v, false, fmt.Errorf("encode key: %w", err)
+	}
+
+	bv, ok, err := r.tx.Get(bk)
+	if err != nil {
+		return v, false, fmt.Errorf("get value: %w", err)
+	}
+	if !ok {
+		return v, false, nil
+	}
+
+	v, err = r.m.valueEncoder(bk).Decode(bv)
+	if err != nil {
+		return v, false, fmt.Errorf("decode value: %w", err)
+	}
+
+	return v, true, nil
+}
+
+// Each calls f for each key-value pair in the map. If f returns an error, then
+// iteration stops and the error is returned as-is, unless it is
+// [StopIteration], in which case nil is returned.
+func (r MapReader[K, V]) Each(f func(k K, v V) error) error {
+	return ignoreStop(r.m.each(r.tx, f))
+}
+
+// EachKey calls f for each key in the map. If f returns an error, then
+// iteration stops and the error is returned as-is, unless it is
+// [StopIteration], in which case nil is returned.
+func (r MapReader[K, V]) EachKey(f func(k K) error) error {
+	return ignoreStop(r.tx.EachKey(func(bk []byte) error {
+		if isReservedKey(bk) {
+			return nil
+		}
+		k, err := r.m.kencoder.Decode(bk)
+		if err != nil {
+			return fmt.Errorf("decode key: %w", err)
+		}
+		return f(k)
+	}))
+}
+
+// ignoreStop returns nil if err is [StopIteration], or err otherwise.
+func ignoreStop(err error) error {
+	if errors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
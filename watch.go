@@ -0,0 +1,269 @@
+package persist
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ChangeOp is the type of change made to a key.
+type ChangeOp uint8
+
+const (
+	// ChangeSet means that the key was set to a new value.
+	ChangeSet ChangeOp = iota
+	// ChangeDelete means that the key was deleted.
+	ChangeDelete
+)
+
+// String returns the name of the operation.
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeSet:
+		return "set"
+	case ChangeDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("ChangeOp(%d)", uint8(op))
+	}
+}
+
+// Change is a single change made to a map.
+type Change[K, V any] struct {
+	Op  ChangeOp
+	Key K
+	// Value is the new value. It is the zero value if Op is ChangeDelete.
+	Value V
+}
+
+// changesBufferSize is the size of the channel returned by Map.Changes.
+const changesBufferSize = 64
+
+// Changes returns a channel that receives every change made to the map after
+// Changes returns, until ctx is done, after which the channel is closed. The
+// driver must implement [DriverWatcher], otherwise an error wrapping
+// [errors.ErrUnsupported] is returned.
+//
+// Changes are delivered in commit order. The channel is buffered, but once the
+// buffer is full, committing new changes blocks until the consumer catches up
+// or ctx is done. The consumer must therefore not write to the map while the
+// channel is full. Changes whose key or value fail to decode are dropped.
+//
+// Some drivers, such as badgerdb, register the watcher asynchronously, so
+// changes committed right after Changes returns may be missed.
+func (m Map[K, V]) Changes(ctx context.Context) (<-chan Change[K, V], error) {
+	if m.driver == nil {
+		return nil, ErrNotInitialized
+	}
+
+	w, ok := driverAs[DriverWatcher](m.driver)
+	if !ok {
+		return nil, fmt.Errorf("persist: driver does not support Changes: %w", errors.ErrUnsupported)
+	}
+
+	ch := make(chan Change[K, V], changesBufferSize)
+
+	done, err := w.Watch(ctx, func(changes []DriverChange) {
+		for _, c := range changes {
+			if isReservedKey(c.Key) {
+				continue
+			}
+
+			change, err := m.decodeChange(c)
+			if err != nil {
+				continue
+			}
+
+			select {
+			case ch <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-done
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+func (m Map[K, V]) decodeChange(c DriverChange) (Change[K, V], error) {
+	var change Change[K, V]
+	var err error
+
+	change.Key, err = m.kencoder.Decode(c.Key)
+	if err != nil {
+		return change, fmt.Errorf("decode key: %w", err)
+	}
+
+	if c.Deleted {
+		change.Op = ChangeDelete
+		return change, nil
+	}
+
+	change.Op = ChangeSet
+	change.Value, err = m.valueEncoder(c.Key).Decode(c.Value)
+	if err != nil {
+		return change, fmt.Errorf("decode value: %w", err)
+	}
+
+	return change, nil
+}
+
+// Subscribe subscribes to the value. It uses the driver's watcher if there is
+// one, otherwise it falls back to the value's own subscribers.
+func (m mappedValue[K, V]) Subscribe(ctx context.Context) (<-chan V, error) {
+	ch := make(chan V, 1)
+
+	w, ok := driverAs[DriverWatcher](m.m.driver)
+	if !ok {
+		m.subs.add(ctx, ch)
+		return ch, nil
+	}
+
+	bk, err := m.m.kencoder.Encode(m.k, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encode key: %w", err)
+	}
+	bk = bytes.Clone(bk)
+
+	done, err := w.Watch(ctx, func(changes []DriverChange) {
+		for _, c := range changes {
+			if c.Deleted || !bytes.Equal(c.Key, bk) {
+				continue
+			}
+			v, err := m.m.valueEncoder(bk).Decode(c.Value)
+			if err != nil {
+				continue
+			}
+			sendLatest(ch, v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-done
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// sendLatest sends v into ch, which must be buffered, replacing the value
+// that is already buffered if needed. It must not be called concurrently for
+// the same channel.
+func sendLatest[V any](ch chan V, v V) {
+	for {
+		select {
+		case ch <- v:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+// valueSubscribers are the channels subscribed to a Value.
+type valueSubscribers[V any] struct {
+	mu sync.Mutex
+	m  map[chan V]struct{}
+}
+
+// add subscribes ch until ctx is done, after which ch is closed.
+func (s *valueSubscribers[V]) add(ctx context.Context, ch chan V) {
+	s.mu.Lock()
+	if s.m == nil {
+		s.m = make(map[chan V]struct{})
+	}
+	s.m[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		delete(s.m, ch)
+		s.mu.Unlock()
+
+		close(ch)
+	}()
+}
+
+// notify sends v to all subscribers.
+func (s *valueSubscribers[V]) notify(v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.m {
+		sendLatest(ch, v)
+	}
+}
+
+// driverWatchers implements the bookkeeping of DriverWatcher for drivers that
+// publish their own changes.
+type driverWatchers struct {
+	mu   sync.Mutex
+	m    map[int]func([]DriverChange)
+	next int
+}
+
+// watch registers f until ctx is done.
+func (w *driverWatchers) watch(ctx context.Context, f func([]DriverChange)) <-chan struct{} {
+	w.mu.Lock()
+	if w.m == nil {
+		w.m = make(map[int]func([]DriverChange))
+	}
+	id := w.next
+	w.next++
+	w.m[id] = f
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+
+		w.mu.Lock()
+		delete(w.m, id)
+		w.mu.Unlock()
+
+		close(done)
+	}()
+
+	return done
+}
+
+// active returns true if there are any registered watchers.
+func (w *driverWatchers) active() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.m) > 0
+}
+
+// publish calls all registered watchers with the given changes. The caller
+// must ensure that publish is called in commit order.
+func (w *driverWatchers) publish(changes []DriverChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, f := range w.m {
+		f(changes)
+	}
+}